@@ -2,92 +2,244 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
+	_ "time/tzdata" // clinic time zones must resolve in minimal containers
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 
+	"github.com/harentsoaR/dentist-api/internal/config"
+	"github.com/harentsoaR/dentist-api/internal/database"
 	"github.com/harentsoaR/dentist-api/internal/handlers"
+	"github.com/harentsoaR/dentist-api/internal/health"
+	"github.com/harentsoaR/dentist-api/internal/jobs"
+	"github.com/harentsoaR/dentist-api/internal/logging"
+	"github.com/harentsoaR/dentist-api/internal/metrics"
 	"github.com/harentsoaR/dentist-api/internal/middleware"
+	"github.com/harentsoaR/dentist-api/internal/ratelimit"
+	"github.com/harentsoaR/dentist-api/internal/repository"
 	"github.com/harentsoaR/dentist-api/internal/services" // Import the new service
+	"github.com/harentsoaR/dentist-api/internal/tracing"
+	"github.com/harentsoaR/dentist-api/internal/utils"
+	"github.com/harentsoaR/dentist-api/internal/version"
 )
 
 func main() {
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, relying on environment variables.")
-	}
-	log.Printf("MONGO_URI: %s", os.Getenv("MONGO_URI"))
-	log.Printf("MONGO_DATABASE: %s", os.Getenv("MONGO_DATABASE"))
-	log.Printf("API_PORT: %s", os.Getenv("API_PORT"))
-	if os.Getenv("JWT_SECRET") != "" {
-		log.Println("JWT_SECRET is SET.")
+	// --- Configuration ---
+	// Log as JSON from the very start; the configured level and format apply once loaded.
+	logging.Setup(os.Stderr, "json", "info")
+	cfg, err := config.Load()
+	if err != nil {
+		fatal("failed to load configuration", err)
+	}
+	migrateOnly := len(os.Args) > 1 && os.Args[1] == "migrate"
+	if migrateOnly {
+		err = cfg.ValidateDatabase()
 	} else {
-		log.Println("JWT_SECRET is NOT SET.")
+		err = cfg.Validate()
+	}
+	if err != nil {
+		fatal("invalid configuration", err)
+	}
+	logging.Setup(os.Stderr, cfg.Logging.Format, cfg.Logging.Level)
+	build := version.Get()
+	slog.Info("starting dentist-api", "version", build.Version, "commit", build.Commit, "built", build.BuildTime)
+	slog.Info("configuration loaded", "config", cfg.Redacted())
+
+	// --- Tracing ---
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("failed to set up tracing", err)
 	}
 
 	// --- Database Connection ---
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(os.Getenv("MONGO_URI")))
+	connectCtx, connectCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer connectCancel()
+	clientOpts := options.Client().ApplyURI(cfg.Mongo.URI).
+		SetMonitor(database.CombineMonitors(metrics.MongoMonitor(), otelmongo.NewMonitor()))
+	client, err := mongo.Connect(connectCtx, clientOpts)
+	if err != nil {
+		fatal("failed to connect to MongoDB", err)
+	}
+	defer func() {
+		// The connect context has long expired by now, so disconnect with a fresh one
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := client.Disconnect(ctx); err != nil {
+			slog.Warn("MongoDB disconnect failed", "error", err)
+		}
+	}()
+	db := client.Database(cfg.Mongo.Database)
+	slog.Info("connected to MongoDB", "database", cfg.Mongo.Database)
+
+	// --- Schema: migrations and indexes ---
+	// `api migrate` applies them and exits; the server also applies them on startup.
+	bootstrapCtx, bootstrapCancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer bootstrapCancel()
+	if err := database.Bootstrap(bootstrapCtx, db); err != nil {
+		fatal("failed to prepare database", err)
+	}
+	slog.Info("database migrations and indexes are up to date")
+	if migrateOnly {
+		return
+	}
+
+	// --- Token Signing Keys ---
+	keys, err := utils.LoadKeySet(cfg.JWT.KeysDir, cfg.JWT.ActiveKID, cfg.JWT.Issuer, cfg.JWT.Audience, cfg.JWT.TTL)
 	if err != nil {
-		log.Fatalf("Failed to connect to MongoDB: %v", err)
+		fatal("failed to load JWT keys", err)
 	}
-	defer client.Disconnect(ctx)
-	db := client.Database(os.Getenv("MONGO_DATABASE"))
-	log.Println("Successfully connected to MongoDB!")
+	slog.Info("JWT signing keys loaded", "verification_keys", len(keys.JWKS().Keys))
 
 	// --- Initialize Services ---
-	notificationSvc := services.NewNotificationService()
+	notificationSvc := services.NewNotificationService(cfg.Notifications)
+	chatModel, err := services.NewChatModel(cfg.Chat)
+	if err != nil {
+		fatal("failed to set up the chat model", err)
+	}
+	slog.Info("chat model selected", "provider", chatModel.Provider(), "model", chatModel.Model())
 
 	// --- Initialize Handlers with DB and Services ---
-	h := handlers.NewHandler(db, notificationSvc)
+	repos := repository.NewMongoRepositories(db)
+	notificationSvc.Log = repos.Notifications
+	h := handlers.NewHandler(repos, notificationSvc, keys)
+	h.RequireVerifiedContact = cfg.Accounts.RequireVerifiedContact
+	h.DefaultPhoneCountry = cfg.Accounts.DefaultPhoneCountry
+	h.ChatModel = chatModel
+	h.ChatHistory = cfg.Chat.History
+	h.RequestTimeout = cfg.Server.RequestTimeout
+	h.ChatTimeout = cfg.Chat.Timeout
+	h.MetricsToken = cfg.Server.MetricsToken
+	h.IdempotencyTTL = cfg.Server.IdempotencyTTL
+	h.AuditRetention = cfg.Audit.Retention
+
+	// --- Rate Limiting ---
+	policies, _ := cfg.RateLimit.Policies() // Checked by Validate
+	switch cfg.RateLimit.Store {
+	case "memory":
+		h.Limiter = ratelimit.New(ratelimit.NewMemoryStore(), policies)
+	case "mongo":
+		h.Limiter = ratelimit.New(ratelimit.NewMongoStore(db), policies)
+	}
+
+	// --- Readiness Checks ---
+	h.Health.Add(&health.Check{Name: "mongo", Critical: true, Run: func(ctx context.Context) error {
+		return client.Ping(ctx, nil)
+	}})
+	h.Health.Add(&health.Check{Name: "notifications", Run: func(context.Context) error {
+		return notificationSvc.CheckConfig()
+	}})
+	// The AI provider is billed per call, so don't ask it on every probe
+	h.Health.Add(&health.Check{Name: "chat", CacheFor: time.Minute, Run: h.PingChat})
+
+	// --- Metrics ---
+	err = metrics.RegisterScheduledAppointments(h.CountScheduledAppointments)
+	if err != nil {
+		fatal("failed to register metrics", err)
+	}
+
+	// --- Background Jobs ---
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	purge := &jobs.Purge{Users: repos.Users, Appointments: repos.Appointments, Retention: cfg.Deletion.Retention}
+	go purge.Run(jobsCtx, cfg.Deletion.PurgeInterval)
 
 	// --- Gin Router ---
 	r := gin.New()
-	r.Use(gin.Logger())
-	r.Use(gin.Recovery())
+	// Only the configured load balancers may set the client IP through
+	// X-Forwarded-For; it keys the per-IP rate limits and the audit log
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		fatal("invalid TRUSTED_PROXIES", err)
+	}
+	// Spans for every request but the probes, which would drown the traces
+	r.Use(otelgin.Middleware(tracing.ServiceName, otelgin.WithFilter(func(req *http.Request) bool {
+		switch req.URL.Path {
+		case "/healthz", "/readyz", "/metrics":
+			return false
+		}
+		return true
+	})))
+	r.Use(middleware.RequestID())
+	r.Use(middleware.Logger())
+	r.Use(middleware.Recovery())
+	r.Use(middleware.Metrics())
 
 	// ---  Middleware ---
 	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"https://dentaheal.netlify.app", "http://localhost:3000"},
+		AllowOrigins:     cfg.CORS.AllowOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", middleware.RequestIDHeader, middleware.IdempotencyKeyHeader, "If-Match"},
+		ExposeHeaders:    []string{middleware.RequestIDHeader, middleware.IdempotentReplayHeader, "ETag", "Retry-After", "Link", "X-Next-Cursor", "X-Total-Count"},
 		AllowCredentials: true,
 	}))
 
 	// --- Routes ---
-	authRoutes := r.Group("/auth")
-	{
-		// Assuming you will move these handlers into the handlers package
-		authRoutes.POST("/register", h.RegisterUser)
-		authRoutes.POST("/login", h.Login)
-	}
-
-	apiRoutes := r.Group("/api")
-	apiRoutes.Use(middleware.AuthMiddleware()) // Protect all /api routes
-	{
-		// Appointment Routes
-		apiRoutes.GET("/appointments", h.GetAppointments)    // Get appointments with filters
-		apiRoutes.POST("/appointments", h.CreateAppointment) // Create a new appointment
-		apiRoutes.GET("/appointment/user/:id", h.GetAppointment)
-		apiRoutes.PUT("/appointments/:id", h.UpdateAppointment)          // Update an appointment (dentist/staff)
-		apiRoutes.PATCH("/appointments/:id/cancel", h.CancelAppointment) // Cancel an appointment (dentist/staff)
-
-		// other existing routes
-		apiRoutes.POST("/chat", h.HandleChat)
-		apiRoutes.GET("/user/:id", h.GetCurrentUser)
-		apiRoutes.PUT("/user/:id", h.UpdateCurrentUser)
-	}
-
-	port := os.Getenv("API_PORT")
-	if port == "" {
-		port = "8080" // Default port
-	}
-	log.Printf("Starting server on port %s", port)
-	r.Run(":" + port)
+	h.RegisterRoutes(r)
+
+	// The write timeout must leave room for the slowest handler (the chat)
+	writeTimeout := cfg.Server.WriteTimeout
+	if writeTimeout == 0 {
+		writeTimeout = max(cfg.Server.RequestTimeout, cfg.Chat.Timeout) + 5*time.Second
+	}
+	srv := &http.Server{
+		Addr:              ":" + cfg.Server.Port,
+		Handler:           r,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+
+	// --- Graceful Shutdown ---
+	stop, stopCancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopCancel()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("starting server", "port", cfg.Server.Port)
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			fatal("server failed", err)
+		}
+	case <-stop.Done():
+		slog.Info("shutdown signal received, draining requests")
+		// Fail readiness first and give load balancers time to notice
+		// before the listener stops accepting connections.
+		h.Health.SetDraining()
+		time.Sleep(cfg.Server.DrainDelay)
+	}
+
+	stopJobs()
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer shutdownCancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("HTTP server did not drain cleanly", "error", err)
+	}
+	if err := notificationSvc.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("notification flush incomplete", "error", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Warn("trace flush incomplete", "error", err)
+	}
+	slog.Info("server stopped")
+}
+
+// fatal logs err and exits. Deferred cleanups don't run, as with log.Fatal.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
@@ -0,0 +1,162 @@
+// Package apierror defines the error body every endpoint returns and maps
+// the errors handlers run into (storage, validation, auth, deadlines) onto it.
+//
+//	{
+//	  "status": 400,
+//	  "code": "validation_failed",
+//	  "message": "Some fields are invalid",
+//	  "errors": [{"field": "startTime", "code": "invalid_format", "message": "must be an RFC 3339 timestamp"}],
+//	  "requestId": "3f2a...",
+//	  "error": "Some fields are invalid"
+//	}
+//
+// "error" repeats the message for clients written against the old format.
+package apierror
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Codes shared by several endpoints. Handlers may use more specific ones.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeInvalidBody      = "invalid_body"
+	CodeValidation       = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeTooManyRequests  = "too_many_requests"
+	CodeTimeout          = "timeout"
+	CodeUpstream         = "upstream_error"
+	CodeUnavailable      = "unavailable"
+	CodeInternal         = "internal_error"
+	CodePreconditionFail = "precondition_failed"
+	CodeNoClinic         = "no_clinic"
+)
+
+// FieldError points at one invalid request field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is an error that knows how it should be reported to the client.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Fields  []FieldError
+	// Cause is logged for 5xx responses but never sent to the client.
+	Cause error
+}
+
+// New returns an error with the given status. An empty code is derived from
+// the status.
+func New(status int, code, message string) *Error {
+	if code == "" {
+		code = codeForStatus(status)
+	}
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// Internal hides cause behind a generic message.
+func Internal(message string, cause error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: message, Cause: cause}
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Message)
+	if len(e.Fields) > 0 {
+		parts := make([]string, len(e.Fields))
+		for i, f := range e.Fields {
+			parts[i] = f.Field + " " + f.Message
+		}
+		msg += " (" + strings.Join(parts, "; ") + ")"
+	}
+	if e.Cause != nil {
+		msg += ": " + e.Cause.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Invalid is a 400 for a single bad field.
+func Invalid(field, code, message string) *Error {
+	var v Validation
+	v.Add(field, code, message)
+	return v.Err().(*Error)
+}
+
+// Validation collects field errors; Err returns nil when there are none.
+//
+//	var v apierror.Validation
+//	v.Add("startTime", "invalid_format", "must be an RFC 3339 timestamp")
+//	if err := v.Err(); err != nil { ... }
+type Validation struct {
+	fields []FieldError
+}
+
+func (v *Validation) Add(field, code, message string) {
+	v.fields = append(v.fields, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Has reports whether field already has an error, to avoid piling up
+// follow-on errors for a field that failed to parse.
+func (v *Validation) Has(field string) bool {
+	for _, f := range v.fields {
+		if f.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *Validation) Err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return &Error{
+		Status:  http.StatusBadRequest,
+		Code:    CodeValidation,
+		Message: "Some fields are invalid",
+		Fields:  v.fields,
+	}
+}
+
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusPreconditionFailed:
+		return CodePreconditionFail
+	case http.StatusUnprocessableEntity:
+		return CodeValidation
+	case http.StatusTooManyRequests:
+		return CodeTooManyRequests
+	case http.StatusBadGateway:
+		return CodeUpstream
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	case http.StatusGatewayTimeout:
+		return CodeTimeout
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
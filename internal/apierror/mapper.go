@@ -0,0 +1,131 @@
+package apierror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/harentsoaR/dentist-api/internal/repository"
+	"github.com/harentsoaR/dentist-api/internal/tenant"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func init() {
+	// Report validation failures with the JSON field names clients send
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return f.Name
+			}
+			return name
+		})
+	}
+}
+
+// From maps any error onto an *Error. Unknown errors become a 500 whose
+// message says nothing about the cause.
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var validationErrs validator.ValidationErrors
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &validationErrs):
+		return fromValidation(validationErrs)
+	case errors.As(err, &typeErr):
+		e := New(http.StatusBadRequest, CodeValidation, "Some fields are invalid")
+		e.Fields = []FieldError{{Field: typeErr.Field, Code: "invalid_type", Message: "must be a " + jsonType(typeErr.Type)}}
+		return e
+	case errors.As(err, &syntaxErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return New(http.StatusBadRequest, CodeInvalidBody, "Request body is not valid JSON")
+	case errors.Is(err, repository.ErrNotFound), errors.Is(err, mongo.ErrNoDocuments):
+		return New(http.StatusNotFound, CodeNotFound, "Resource not found")
+	case errors.Is(err, repository.ErrDuplicate), mongo.IsDuplicateKeyError(err):
+		return New(http.StatusConflict, CodeConflict, "Resource already exists")
+	case errors.Is(err, tenant.ErrNoClinic):
+		return New(http.StatusForbidden, CodeNoClinic, "Select a clinic first")
+	case errors.Is(err, repository.ErrVersionConflict):
+		return New(http.StatusPreconditionFailed, CodePreconditionFail, "The resource was changed by someone else; reload it and try again")
+	case errors.Is(err, context.DeadlineExceeded), mongo.IsTimeout(err):
+		return &Error{Status: http.StatusGatewayTimeout, Code: CodeTimeout, Message: "The request took too long", Cause: err}
+	case errors.Is(err, context.Canceled):
+		// The client went away; nobody will read this
+		return &Error{Status: http.StatusServiceUnavailable, Code: CodeUnavailable, Message: "Request cancelled", Cause: err}
+	}
+	return Internal("Internal server error", err)
+}
+
+// FromBinding maps a ShouldBindJSON failure; anything unexpected is still a 400.
+func FromBinding(err error) *Error {
+	e := From(err)
+	if e.Status >= 500 {
+		return New(http.StatusBadRequest, CodeInvalidBody, "Invalid request body")
+	}
+	return e
+}
+
+func fromValidation(errs validator.ValidationErrors) *Error {
+	var v Validation
+	for _, fe := range errs {
+		field := fe.Namespace()
+		// Drop the struct name: "RegisterUserRequest.email" -> "email"
+		if _, rest, ok := strings.Cut(field, "."); ok {
+			field = rest
+		}
+		v.Add(field, fe.Tag(), validationMessage(fe))
+	}
+	return v.Err().(*Error)
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters", fe.Param())
+		}
+		return "must be at least " + fe.Param()
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters", fe.Param())
+		}
+		return "must be at most " + fe.Param()
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	}
+	return "is invalid (" + fe.Tag() + ")"
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	}
+	return "object"
+}
@@ -0,0 +1,102 @@
+package apierror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/harentsoaR/dentist-api/internal/repository"
+	"github.com/harentsoaR/dentist-api/internal/tenant"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestFrom(t *testing.T) {
+	var v struct {
+		Age int `json:"age"`
+	}
+	syntaxErr := json.Unmarshal([]byte(`{"age":`), &v)
+	typeErr := json.Unmarshal([]byte(`{"age":"old"}`), &v)
+	handlerErr := New(http.StatusForbidden, "", "Permission denied.")
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{"handler error", handlerErr, http.StatusForbidden, CodeForbidden},
+		{"wrapped handler error", fmt.Errorf("booking: %w", handlerErr), http.StatusForbidden, CodeForbidden},
+		{"malformed JSON", syntaxErr, http.StatusBadRequest, CodeInvalidBody},
+		{"wrong JSON type", typeErr, http.StatusBadRequest, CodeValidation},
+		{"not found", fmt.Errorf("loading: %w", repository.ErrNotFound), http.StatusNotFound, CodeNotFound},
+		{"no documents", mongo.ErrNoDocuments, http.StatusNotFound, CodeNotFound},
+		{"duplicate", repository.ErrDuplicate, http.StatusConflict, CodeConflict},
+		{"duplicate field", &repository.DuplicateError{Field: "email"}, http.StatusConflict, CodeConflict},
+		{"no clinic", tenant.ErrNoClinic, http.StatusForbidden, CodeNoClinic},
+		{"version conflict", repository.ErrVersionConflict, http.StatusPreconditionFailed, CodePreconditionFail},
+		{"deadline", context.DeadlineExceeded, http.StatusGatewayTimeout, CodeTimeout},
+		{"cancelled", context.Canceled, http.StatusServiceUnavailable, CodeUnavailable},
+		{"unknown", errors.New("connection reset by peer"), http.StatusInternalServerError, CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := From(tt.err)
+			if got.Status != tt.wantStatus || got.Code != tt.wantCode {
+				t.Fatalf("From(%v) = %d %s, want %d %s", tt.err, got.Status, got.Code, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+
+	// The cause of a 500 is kept for the logs, not put in the message
+	got := From(errors.New("dial tcp 10.0.0.3:27017: connection refused"))
+	if got.Message != "Internal server error" || got.Cause == nil {
+		t.Fatalf("unexpected internal error: %+v", got)
+	}
+	if got := From(typeErr); len(got.Fields) != 1 || got.Fields[0] != (FieldError{Field: "age", Code: "invalid_type", Message: "must be a number"}) {
+		t.Fatalf("unexpected type error fields: %+v", got.Fields)
+	}
+}
+
+func TestFromValidation(t *testing.T) {
+	var req struct {
+		Email    string `json:"email" binding:"required,email"`
+		Password string `json:"password" binding:"min=8"`
+		Role     string `json:"role" binding:"omitempty,oneof=client staff"`
+	}
+	req.Email = "not an email"
+	req.Password = "short"
+	req.Role = "admin"
+
+	got := From(binding.Validator.ValidateStruct(&req))
+	if got.Status != http.StatusBadRequest || got.Code != CodeValidation {
+		t.Fatalf("unexpected error: %+v", got)
+	}
+	// Fields are named as clients send them
+	want := []FieldError{
+		{Field: "email", Code: "email", Message: "must be a valid email address"},
+		{Field: "password", Code: "min", Message: "must be at least 8 characters"},
+		{Field: "role", Code: "oneof", Message: "must be one of: client, staff"},
+	}
+	if len(got.Fields) != len(want) {
+		t.Fatalf("fields = %+v, want %+v", got.Fields, want)
+	}
+	for i := range want {
+		if got.Fields[i] != want[i] {
+			t.Errorf("field %d = %+v, want %+v", i, got.Fields[i], want[i])
+		}
+	}
+}
+
+func TestFromBinding(t *testing.T) {
+	// Whatever went wrong reading the body, it is the client's request
+	if got := FromBinding(errors.New("http: request body too large")); got.Status != http.StatusBadRequest || got.Code != CodeInvalidBody {
+		t.Fatalf("unexpected error: %+v", got)
+	}
+	if got := FromBinding(New(http.StatusConflict, "", "taken")); got.Status != http.StatusConflict {
+		t.Fatalf("a mapped error must keep its status, got %+v", got)
+	}
+}
@@ -0,0 +1,41 @@
+package apierror
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harentsoaR/dentist-api/internal/logging"
+)
+
+// Problem is the JSON error body.
+type Problem struct {
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	RequestID string       `json:"requestId,omitempty"`
+	// Error duplicates Message for older clients.
+	Error string `json:"error"`
+}
+
+// Respond maps err, logs it when it is our fault, and aborts the request
+// with the problem body.
+func Respond(c *gin.Context, err error) {
+	e := From(err)
+	ctx := c.Request.Context()
+	if e.Status >= http.StatusInternalServerError {
+		slog.ErrorContext(ctx, "request failed", "status", e.Status, "code", e.Code, "error", e)
+	}
+	c.Error(e)
+
+	c.Header("Content-Type", "application/problem+json")
+	c.AbortWithStatusJSON(e.Status, Problem{
+		Status:    e.Status,
+		Code:      e.Code,
+		Message:   e.Message,
+		Errors:    e.Fields,
+		RequestID: logging.RequestID(ctx),
+		Error:     e.Message,
+	})
+}
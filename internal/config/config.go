@@ -0,0 +1,472 @@
+// Package config loads the API settings once at startup. Values come, in
+// increasing priority, from built-in defaults, an optional YAML file
+// (CONFIG_FILE, or ./config.yaml when present), a .env file and the process
+// environment.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/harentsoaR/dentist-api/internal/ratelimit"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is read when CONFIG_FILE is not set and the file exists.
+const DefaultFile = "config.yaml"
+
+type Config struct {
+	Server        Server        `yaml:"server" json:"server"`
+	Logging       Logging       `yaml:"logging" json:"logging"`
+	Tracing       Tracing       `yaml:"tracing" json:"tracing"`
+	Mongo         Mongo         `yaml:"mongo" json:"mongo"`
+	JWT           JWT           `yaml:"jwt" json:"jwt"`
+	CORS          CORS          `yaml:"cors" json:"cors"`
+	Accounts      Accounts      `yaml:"accounts" json:"accounts"`
+	Notifications Notifications `yaml:"notifications" json:"notifications"`
+	Chat          Chat          `yaml:"chat" json:"chat"`
+	RateLimit     RateLimit     `yaml:"rateLimit" json:"rateLimit"`
+	Audit         Audit         `yaml:"audit" json:"audit"`
+	Deletion      Deletion      `yaml:"deletion" json:"deletion"`
+}
+
+type Server struct {
+	Port              string        `yaml:"port" json:"port" env:"API_PORT"`
+	RequestTimeout    time.Duration `yaml:"requestTimeout" json:"requestTimeout" env:"REQUEST_TIMEOUT"`
+	ShutdownTimeout   time.Duration `yaml:"shutdownTimeout" json:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT"`
+	DrainDelay        time.Duration `yaml:"drainDelay" json:"drainDelay" env:"SHUTDOWN_DRAIN_DELAY"` // /readyz fails this long before the listener closes
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout" json:"readHeaderTimeout" env:"HTTP_READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `yaml:"readTimeout" json:"readTimeout" env:"HTTP_READ_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout" json:"writeTimeout" env:"HTTP_WRITE_TIMEOUT"` // 0 = derived from the handler timeouts
+	IdleTimeout       time.Duration `yaml:"idleTimeout" json:"idleTimeout" env:"HTTP_IDLE_TIMEOUT"`
+	IdempotencyTTL    time.Duration `yaml:"idempotencyTtl" json:"idempotencyTtl" env:"IDEMPOTENCY_TTL"`         // How long responses are replayed for a retried Idempotency-Key
+	MetricsToken      string        `yaml:"metricsToken" json:"metricsToken" env:"METRICS_TOKEN" secret:"true"` // Empty = /metrics is open
+	// TrustedProxies lists the load balancers (IPs or CIDRs) whose
+	// X-Forwarded-For is believed. Empty = clients connect directly, and
+	// the header is ignored so it can't dodge the per-IP rate limits.
+	TrustedProxies []string `yaml:"trustedProxies" json:"trustedProxies" env:"TRUSTED_PROXIES"`
+}
+
+type Logging struct {
+	Level  string `yaml:"level" json:"level" env:"LOG_LEVEL"`    // debug, info, warn, error
+	Format string `yaml:"format" json:"format" env:"LOG_FORMAT"` // json or text
+}
+
+type Tracing struct {
+	Exporter    string  `yaml:"exporter" json:"exporter" env:"TRACING_EXPORTER"`              // none, stdout or otlp
+	Endpoint    string  `yaml:"endpoint" json:"endpoint" env:"TRACING_ENDPOINT" secret:"url"` // Full OTLP/HTTP URL; empty = OTEL_EXPORTER_OTLP_* variables
+	SampleRatio float64 `yaml:"sampleRatio" json:"sampleRatio" env:"TRACING_SAMPLE_RATIO"`    // Fraction of new traces recorded
+}
+
+type Mongo struct {
+	URI      string `yaml:"uri" json:"uri" env:"MONGO_URI" secret:"url"`
+	Database string `yaml:"database" json:"database" env:"MONGO_DATABASE"`
+}
+
+type JWT struct {
+	KeysDir   string        `yaml:"keysDir" json:"keysDir" env:"JWT_KEYS_DIR"`
+	ActiveKID string        `yaml:"activeKid" json:"activeKid" env:"JWT_ACTIVE_KID"`
+	Issuer    string        `yaml:"issuer" json:"issuer" env:"JWT_ISSUER"`
+	Audience  string        `yaml:"audience" json:"audience" env:"JWT_AUDIENCE"`
+	TTL       time.Duration `yaml:"ttl" json:"ttl" env:"JWT_TTL"`
+}
+
+type CORS struct {
+	AllowOrigins []string `yaml:"allowOrigins" json:"allowOrigins" env:"CORS_ALLOW_ORIGINS"`
+}
+
+type Accounts struct {
+	RequireVerifiedContact bool   `yaml:"requireVerifiedContact" json:"requireVerifiedContact" env:"REQUIRE_VERIFIED_CONTACT"`
+	DefaultPhoneCountry    string `yaml:"defaultPhoneCountry" json:"defaultPhoneCountry" env:"DEFAULT_PHONE_COUNTRY_CODE"`
+}
+
+type Notifications struct {
+	TextbeltKey          string        `yaml:"textbeltKey" json:"textbeltKey" env:"TEXTBELT_API_KEY" secret:"true"`
+	SMTPHost             string        `yaml:"smtpHost" json:"smtpHost" env:"SMTP_HOST"`
+	SMTPPort             string        `yaml:"smtpPort" json:"smtpPort" env:"SMTP_PORT"`
+	SMTPUsername         string        `yaml:"smtpUsername" json:"smtpUsername" env:"SMTP_USERNAME"`
+	SMTPPassword         string        `yaml:"smtpPassword" json:"smtpPassword" env:"SMTP_PASSWORD" secret:"true"`
+	SMTPFrom             string        `yaml:"smtpFrom" json:"smtpFrom" env:"SMTP_FROM"`
+	EmailVerificationURL string        `yaml:"emailVerificationUrl" json:"emailVerificationUrl" env:"EMAIL_VERIFICATION_URL"`
+	SendTimeout          time.Duration `yaml:"sendTimeout" json:"sendTimeout" env:"NOTIFICATION_TIMEOUT"`
+}
+
+// Chat selects the model behind the assistant. The OpenAI-compatible
+// provider also works against local servers such as Ollama.
+type Chat struct {
+	Provider     string        `yaml:"provider" json:"provider" env:"CHAT_PROVIDER"`          // gemini, openai or fake (canned replies, no network)
+	Model        string        `yaml:"model" json:"model" env:"CHAT_MODEL"`                   // Empty = gemini-1.5-flash for gemini; required for openai
+	BaseURL      string        `yaml:"baseUrl" json:"baseUrl" env:"CHAT_BASE_URL"`            // API root; empty = the provider's public endpoint
+	Temperature  float64       `yaml:"temperature" json:"temperature" env:"CHAT_TEMPERATURE"` // 0 (deterministic) to 2
+	History      int           `yaml:"history" json:"history" env:"CHAT_HISTORY"`             // Earlier messages of a conversation sent with each question
+	GeminiAPIKey string        `yaml:"geminiApiKey" json:"geminiApiKey" env:"GEMINI_API_KEY" secret:"true"`
+	APIKey       string        `yaml:"apiKey" json:"apiKey" env:"CHAT_API_KEY" secret:"true"` // openai; local servers need none
+	Timeout      time.Duration `yaml:"timeout" json:"timeout" env:"CHAT_TIMEOUT"`
+}
+
+type Audit struct {
+	Retention time.Duration `yaml:"retention" json:"retention" env:"AUDIT_RETENTION"` // 0 = keep forever; applies to entries written from now on
+}
+
+// Deletion governs soft-deleted users and appointments.
+type Deletion struct {
+	Retention     time.Duration `yaml:"retention" json:"retention" env:"DELETED_RETENTION"`      // How long deleted records can be restored before they are purged
+	PurgeInterval time.Duration `yaml:"purgeInterval" json:"purgeInterval" env:"PURGE_INTERVAL"` // How often the purge job runs
+}
+
+// RateLimit sets the token buckets of the abusable routes. Rates read
+// "count/period" (e.g. 10/1m); an empty rate means unlimited.
+type RateLimit struct {
+	Store          string `yaml:"store" json:"store" env:"RATE_LIMIT_STORE"` // none, memory (per instance) or mongo (shared)
+	LoginPerIP     string `yaml:"loginPerIp" json:"loginPerIp" env:"RATE_LIMIT_LOGIN_IP"`
+	RegisterPerIP  string `yaml:"registerPerIp" json:"registerPerIp" env:"RATE_LIMIT_REGISTER_IP"`
+	BookingPerIP   string `yaml:"bookingPerIp" json:"bookingPerIp" env:"RATE_LIMIT_BOOKING_IP"`
+	BookingPerUser string `yaml:"bookingPerUser" json:"bookingPerUser" env:"RATE_LIMIT_BOOKING_USER"`
+	ChatPerIP      string `yaml:"chatPerIp" json:"chatPerIp" env:"RATE_LIMIT_CHAT_IP"`
+	ChatPerUser    string `yaml:"chatPerUser" json:"chatPerUser" env:"RATE_LIMIT_CHAT_USER"`
+	VerifyPerIP    string `yaml:"verifyPerIp" json:"verifyPerIp" env:"RATE_LIMIT_VERIFY_IP"`
+	VerifyPerUser  string `yaml:"verifyPerUser" json:"verifyPerUser" env:"RATE_LIMIT_VERIFY_USER"`
+	ResendPerIP    string `yaml:"resendPerIp" json:"resendPerIp" env:"RATE_LIMIT_RESEND_IP"`
+	ResendPerUser  string `yaml:"resendPerUser" json:"resendPerUser" env:"RATE_LIMIT_RESEND_USER"`
+}
+
+// Policies parses the rates into per-route policies.
+func (r RateLimit) Policies() (map[string]ratelimit.Policy, error) {
+	var errs []error
+	parse := func(name, spec string) ratelimit.Rate {
+		rate, err := ratelimit.ParseRate(spec)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+		return rate
+	}
+	policies := map[string]ratelimit.Policy{
+		ratelimit.RouteLogin:    {PerIP: parse("RATE_LIMIT_LOGIN_IP", r.LoginPerIP)},
+		ratelimit.RouteRegister: {PerIP: parse("RATE_LIMIT_REGISTER_IP", r.RegisterPerIP)},
+		ratelimit.RouteBooking: {
+			PerIP:   parse("RATE_LIMIT_BOOKING_IP", r.BookingPerIP),
+			PerUser: parse("RATE_LIMIT_BOOKING_USER", r.BookingPerUser),
+		},
+		ratelimit.RouteChat: {
+			PerIP:   parse("RATE_LIMIT_CHAT_IP", r.ChatPerIP),
+			PerUser: parse("RATE_LIMIT_CHAT_USER", r.ChatPerUser),
+		},
+		ratelimit.RouteVerify: {
+			PerIP:   parse("RATE_LIMIT_VERIFY_IP", r.VerifyPerIP),
+			PerUser: parse("RATE_LIMIT_VERIFY_USER", r.VerifyPerUser),
+		},
+		ratelimit.RouteResend: {
+			PerIP:   parse("RATE_LIMIT_RESEND_IP", r.ResendPerIP),
+			PerUser: parse("RATE_LIMIT_RESEND_USER", r.ResendPerUser),
+		},
+	}
+	return policies, errors.Join(errs...)
+}
+
+// Default returns the settings used when nothing overrides them.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:              "8080",
+			RequestTimeout:    15 * time.Second,
+			ShutdownTimeout:   20 * time.Second,
+			DrainDelay:        5 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       15 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			IdempotencyTTL:    24 * time.Hour,
+		},
+		Logging: Logging{Level: "info", Format: "json"},
+		Tracing: Tracing{Exporter: "none", SampleRatio: 1},
+		JWT:     JWT{Issuer: "dentist-api", Audience: "dentist-app", TTL: 24 * time.Hour},
+		CORS: CORS{
+			AllowOrigins: []string{"https://dentaheal.netlify.app", "http://localhost:3000"},
+		},
+		Accounts: Accounts{DefaultPhoneCountry: "261"},
+		Notifications: Notifications{
+			SMTPPort:    "587",
+			SendTimeout: 15 * time.Second,
+		},
+		Chat:     Chat{Provider: "gemini", Temperature: 0.7, History: 20, Timeout: 45 * time.Second},
+		Audit:    Audit{Retention: 2 * 365 * 24 * time.Hour},
+		Deletion: Deletion{Retention: 30 * 24 * time.Hour, PurgeInterval: time.Hour},
+		// Each chat message costs Gemini quota, so it is the tightest
+		RateLimit: RateLimit{
+			Store:          "memory",
+			LoginPerIP:     "10/1m",
+			RegisterPerIP:  "5/1h",
+			BookingPerIP:   "30/1h",
+			BookingPerUser: "10/1h",
+			ChatPerIP:      "60/1h",
+			ChatPerUser:    "20/1h",
+			VerifyPerIP:    "30/1h",
+			VerifyPerUser:  "10/1h",
+			ResendPerIP:    "10/1h",
+			ResendPerUser:  "5/1h",
+		},
+	}
+}
+
+// Load builds the configuration from defaults, the YAML file, .env and the
+// environment. It does not validate; call Validate once you know which parts
+// the command needs.
+func Load() (*Config, error) {
+	// .env only fills variables that are not already set
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading .env: %w", err)
+	}
+
+	cfg := Default()
+
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		if _, err := os.Stat(DefaultFile); err == nil {
+			path = DefaultFile
+		}
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading config file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	}
+
+	if err := applyEnv(reflect.ValueOf(cfg).Elem()); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// ValidateDatabase checks what is needed to reach MongoDB (enough for `migrate`).
+func (c *Config) ValidateDatabase() error {
+	var errs []error
+	if c.Mongo.URI == "" {
+		errs = append(errs, errors.New("MONGO_URI is required"))
+	}
+	if c.Mongo.Database == "" {
+		errs = append(errs, errors.New("MONGO_DATABASE is required"))
+	}
+	return errors.Join(errs...)
+}
+
+// countryCodePattern matches an ITU calling code, e.g. 261 or 33.
+var countryCodePattern = regexp.MustCompile(`^[0-9]{1,3}$`)
+
+// Validate checks everything the API server needs, reporting every problem
+// at once so a bad deployment fails fast with a useful message.
+func (c *Config) Validate() error {
+	errs := []error{c.ValidateDatabase()}
+
+	if c.JWT.KeysDir == "" {
+		errs = append(errs, errors.New("JWT_KEYS_DIR is required"))
+	}
+	if c.JWT.ActiveKID == "" {
+		errs = append(errs, errors.New("JWT_ACTIVE_KID is required"))
+	}
+	// Tokens without both claims could be replayed against another service
+	if c.JWT.Issuer == "" {
+		errs = append(errs, errors.New("JWT_ISSUER is required"))
+	}
+	if c.JWT.Audience == "" {
+		errs = append(errs, errors.New("JWT_AUDIENCE is required"))
+	}
+	if !slices.Contains([]string{"debug", "info", "warn", "error"}, strings.ToLower(c.Logging.Level)) {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL %q must be debug, info, warn or error", c.Logging.Level))
+	}
+	if !slices.Contains([]string{"json", "text"}, strings.ToLower(c.Logging.Format)) {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT %q must be json or text", c.Logging.Format))
+	}
+	if !slices.Contains([]string{"none", "stdout", "otlp"}, c.Tracing.Exporter) {
+		errs = append(errs, fmt.Errorf("TRACING_EXPORTER %q must be none, stdout or otlp", c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, errors.New("TRACING_SAMPLE_RATIO must be between 0 and 1"))
+	}
+	if c.Audit.Retention < 0 {
+		errs = append(errs, errors.New("AUDIT_RETENTION cannot be negative"))
+	}
+	if c.Server.DrainDelay < 0 {
+		errs = append(errs, errors.New("SHUTDOWN_DRAIN_DELAY cannot be negative"))
+	}
+	if c.JWT.TTL <= 0 {
+		errs = append(errs, errors.New("JWT_TTL must be positive"))
+	}
+	if _, err := strconv.Atoi(c.Server.Port); err != nil {
+		errs = append(errs, fmt.Errorf("API_PORT %q is not a number", c.Server.Port))
+	}
+	if len(c.CORS.AllowOrigins) == 0 {
+		errs = append(errs, errors.New("CORS_ALLOW_ORIGINS must list at least one origin"))
+	}
+	for _, origin := range c.CORS.AllowOrigins {
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("CORS origin %q must be a scheme://host URL", origin))
+		}
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			errs = append(errs, fmt.Errorf("TRUSTED_PROXIES entry %q must be an IP address or CIDR", proxy))
+		}
+	}
+	if c.Accounts.DefaultPhoneCountry == "" {
+		errs = append(errs, errors.New("DEFAULT_PHONE_COUNTRY_CODE is required"))
+	} else if !countryCodePattern.MatchString(c.Accounts.DefaultPhoneCountry) {
+		errs = append(errs, fmt.Errorf("DEFAULT_PHONE_COUNTRY_CODE %q must be 1 to 3 digits, without the +", c.Accounts.DefaultPhoneCountry))
+	}
+	if !slices.Contains([]string{"none", "memory", "mongo"}, c.RateLimit.Store) {
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_STORE %q must be none, memory or mongo", c.RateLimit.Store))
+	}
+	if _, err := c.RateLimit.Policies(); err != nil {
+		errs = append(errs, err)
+	}
+	if !slices.Contains([]string{"gemini", "openai", "fake"}, c.Chat.Provider) {
+		errs = append(errs, fmt.Errorf("CHAT_PROVIDER %q must be gemini, openai or fake", c.Chat.Provider))
+	}
+	if c.Chat.Provider == "openai" && c.Chat.Model == "" {
+		errs = append(errs, errors.New("CHAT_MODEL is required for the openai provider"))
+	}
+	if c.Chat.BaseURL != "" {
+		if u, err := url.Parse(c.Chat.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("CHAT_BASE_URL %q must be a scheme://host URL", c.Chat.BaseURL))
+		}
+	}
+	if c.Chat.Temperature < 0 || c.Chat.Temperature > 2 {
+		errs = append(errs, errors.New("CHAT_TEMPERATURE must be between 0 and 2"))
+	}
+	if c.Chat.History < 0 {
+		errs = append(errs, errors.New("CHAT_HISTORY cannot be negative"))
+	}
+	if (c.Notifications.SMTPHost == "") != (c.Notifications.SMTPFrom == "") {
+		errs = append(errs, errors.New("SMTP_HOST and SMTP_FROM must be set together"))
+	}
+	for name, d := range map[string]time.Duration{
+		"REQUEST_TIMEOUT":      c.Server.RequestTimeout,
+		"SHUTDOWN_TIMEOUT":     c.Server.ShutdownTimeout,
+		"CHAT_TIMEOUT":         c.Chat.Timeout,
+		"NOTIFICATION_TIMEOUT": c.Notifications.SendTimeout,
+		"IDEMPOTENCY_TTL":      c.Server.IdempotencyTTL,
+		"DELETED_RETENTION":    c.Deletion.Retention,
+		"PURGE_INTERVAL":       c.Deletion.PurgeInterval,
+	} {
+		if d <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy that is safe to log: secrets are masked and
+// credentials are stripped from connection strings.
+func (c *Config) Redacted() Config {
+	redacted := *c
+	redacted.CORS.AllowOrigins = append([]string(nil), c.CORS.AllowOrigins...)
+	redacted.Server.TrustedProxies = append([]string(nil), c.Server.TrustedProxies...)
+	redact(reflect.ValueOf(&redacted).Elem())
+	return redacted
+}
+
+// String renders the redacted configuration as JSON.
+func (c *Config) String() string {
+	redacted := c.Redacted()
+	data, _ := json.Marshal(redacted)
+	return string(data)
+}
+
+func redact(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct && field.Type() != reflect.TypeOf(time.Duration(0)) {
+			redact(field)
+			continue
+		}
+		if field.Kind() != reflect.String || field.String() == "" {
+			continue
+		}
+		switch t.Field(i).Tag.Get("secret") {
+		case "true":
+			field.SetString("****")
+		case "url":
+			if u, err := url.Parse(field.String()); err == nil {
+				field.SetString(u.Redacted())
+			} else {
+				field.SetString("****")
+			}
+		}
+	}
+}
+
+// applyEnv overrides every field tagged `env:"NAME"` whose variable is set.
+func applyEnv(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := applyEnv(field); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := t.Field(i).Tag.Get("env")
+		raw, ok := os.LookupEnv(name)
+		if name == "" || !ok {
+			continue
+		}
+		raw = strings.TrimSpace(raw)
+
+		switch field.Interface().(type) {
+		case string:
+			field.SetString(raw)
+		case bool:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return fmt.Errorf("%s: %q is not a boolean", name, raw)
+			}
+			field.SetBool(b)
+		case int:
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return fmt.Errorf("%s: %q is not a whole number", name, raw)
+			}
+			field.SetInt(int64(n))
+		case float64:
+			f, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %q is not a number", name, raw)
+			}
+			field.SetFloat(f)
+		case time.Duration:
+			d, err := time.ParseDuration(raw)
+			if err != nil {
+				return fmt.Errorf("%s: %q is not a duration (e.g. 15s, 2m)", name, raw)
+			}
+			field.SetInt(int64(d))
+		case []string:
+			var list []string
+			for _, item := range strings.Split(raw, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+			field.Set(reflect.ValueOf(list))
+		default:
+			return fmt.Errorf("%s: unsupported config field type %s", name, field.Type())
+		}
+	}
+	return nil
+}
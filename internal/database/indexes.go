@@ -0,0 +1,170 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CaseInsensitive compares strings ignoring case (but not accents), used for
+// the unique email index.
+var CaseInsensitive = &options.Collation{Locale: "en", Strength: 2}
+
+// Text index weights: a match on a name ranks above one on an email,
+// phone, service or note. The in-memory repositories rank with the same
+// weights.
+var (
+	UserTextWeights        = bson.D{{Key: "fullName", Value: 10}, {Key: "email", Value: 5}, {Key: "phone", Value: 5}}
+	AppointmentTextWeights = bson.D{{Key: "patientName", Value: 10}, {Key: "service", Value: 5}, {Key: "notes", Value: 2}}
+)
+
+// textIndex indexes every weighted field for $text search. The "none"
+// language disables stemming, which would mangle names; text indexes
+// (version 3) already ignore case and accents.
+func textIndex(weights bson.D) mongo.IndexModel {
+	keys := bson.D{}
+	for _, w := range weights {
+		keys = append(keys, bson.E{Key: w.Key, Value: "text"})
+	}
+	return mongo.IndexModel{
+		Keys:    keys,
+		Options: options.Index().SetName("search_text").SetWeights(weights).SetDefaultLanguage("none"),
+	}
+}
+
+// indexes lists every index the API relies on, per collection.
+var indexes = map[string][]mongo.IndexModel{
+	"users": {
+		{
+			Keys:    bson.D{{Key: "email", Value: 1}},
+			Options: options.Index().SetName("email_unique").SetUnique(true).SetCollation(CaseInsensitive),
+		},
+		{
+			// Erased accounts have no phone, so only non-empty numbers count
+			Keys: bson.D{{Key: "phone", Value: 1}},
+			Options: options.Index().SetName("phone_unique").SetUnique(true).
+				SetPartialFilterExpression(bson.M{"phone": bson.M{"$gt": ""}}),
+		},
+		{
+			Keys:    bson.D{{Key: "clinicIds", Value: 1}, {Key: "role", Value: 1}},
+			Options: options.Index().SetName("clinicIds_role"),
+		},
+		textIndex(UserTextWeights),
+		{
+			// Only deleted users have deletedAt: the purge job's lookup
+			Keys:    bson.D{{Key: "deletedAt", Value: 1}},
+			Options: options.Index().SetName("deletedAt").SetSparse(true),
+		},
+	},
+	"appointments": {
+		{
+			Keys:    bson.D{{Key: "startTime", Value: 1}},
+			Options: options.Index().SetName("startTime"),
+		},
+		{
+			// Keyset pagination sorts on (startTime, _id)
+			Keys:    bson.D{{Key: "startTime", Value: 1}, {Key: "_id", Value: 1}},
+			Options: options.Index().SetName("startTime_id"),
+		},
+		{
+			// Every query is scoped to a clinic
+			Keys:    bson.D{{Key: "clinicId", Value: 1}, {Key: "startTime", Value: 1}, {Key: "_id", Value: 1}},
+			Options: options.Index().SetName("clinicId_startTime_id"),
+		},
+		{
+			Keys:    bson.D{{Key: "patientId", Value: 1}, {Key: "startTime", Value: -1}},
+			Options: options.Index().SetName("patientId_startTime"),
+		},
+		{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "startTime", Value: 1}},
+			Options: options.Index().SetName("status_startTime"),
+		},
+		textIndex(AppointmentTextWeights),
+		{
+			Keys:    bson.D{{Key: "deletedAt", Value: 1}},
+			Options: options.Index().SetName("deletedAt").SetSparse(true),
+		},
+	},
+	"auditLog": {
+		{
+			Keys:    bson.D{{Key: "targetType", Value: 1}, {Key: "targetId", Value: 1}, {Key: "_id", Value: -1}},
+			Options: options.Index().SetName("target"),
+		},
+		{
+			Keys:    bson.D{{Key: "actorId", Value: 1}, {Key: "_id", Value: -1}},
+			Options: options.Index().SetName("actorId"),
+		},
+		{
+			Keys:    bson.D{{Key: "clinicId", Value: 1}, {Key: "_id", Value: -1}},
+			Options: options.Index().SetName("clinicId"),
+		},
+		{
+			Keys:    bson.D{{Key: "at", Value: -1}},
+			Options: options.Index().SetName("at"),
+		},
+		{
+			// Retention: entries without expiresAt are kept
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetName("expiresAt_ttl").SetExpireAfterSeconds(0),
+		},
+	},
+	"conversations": {
+		{
+			// Each user's list, most recently active first, within a clinic
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "clinicId", Value: 1}, {Key: "updatedAt", Value: -1}},
+			Options: options.Index().SetName("userId_clinicId_updatedAt"),
+		},
+	},
+	"notifications": {
+		{
+			// The data export and erasure, within a clinic
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "clinicId", Value: 1}, {Key: "sentAt", Value: -1}},
+			Options: options.Index().SetName("userId_clinicId_sentAt"),
+		},
+	},
+	"idempotencyKeys": {
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetName("expiresAt_ttl").SetExpireAfterSeconds(0),
+		},
+	},
+	"rateLimits": {
+		{
+			// Idle buckets are full again by expiresAt, so they can go
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetName("expiresAt_ttl").SetExpireAfterSeconds(0),
+		},
+	},
+	"verificationTokens": {
+		{
+			Keys:    bson.D{{Key: "tokenHash", Value: 1}},
+			Options: options.Index().SetName("tokenHash"),
+		},
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "purpose", Value: 1}},
+			Options: options.Index().SetName("userId_purpose"),
+		},
+		{
+			// Let MongoDB drop expired tokens on its own
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetName("expiresAt_ttl").SetExpireAfterSeconds(0),
+		},
+	},
+}
+
+// EnsureIndexes creates any missing index. It is idempotent and safe to run
+// on every startup.
+func EnsureIndexes(ctx context.Context, db *mongo.Database) error {
+	for collection, models := range indexes {
+		if _, err := db.Collection(collection).Indexes().CreateMany(ctx, models); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return fmt.Errorf("creating unique index on %s: existing documents contain duplicates, clean them up first: %w", collection, err)
+			}
+			return fmt.Errorf("creating indexes on %s: %w", collection, err)
+		}
+	}
+	return nil
+}
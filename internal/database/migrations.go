@@ -0,0 +1,344 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/harentsoaR/dentist-api/internal/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Migration is a one-off data change. Versions must be unique and are applied
+// in increasing order; never edit a migration once it has shipped. Up may run
+// again after a crash, so it must leave already-migrated data unchanged.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+}
+
+// Migration states. Records written before states existed have none and
+// count as done.
+const (
+	migrationPending = "pending"
+	migrationDone    = "done"
+)
+
+// A pending claim is renewed every migrationLease/3 while its migration runs.
+// One that has not been renewed for migrationLease belongs to an instance that
+// died, and is taken over; migrations must therefore be safe to re-run.
+const (
+	migrationLease        = 2 * time.Minute
+	migrationPollInterval = 2 * time.Second
+)
+
+// migrationRecord is stored in the schemaMigrations collection.
+type migrationRecord struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	State       string    `bson:"state,omitempty"`
+	Owner       string    `bson:"owner,omitempty"` // Instance running a pending migration
+	ClaimedAt   time.Time `bson:"claimedAt,omitempty"`
+	AppliedAt   time.Time `bson:"appliedAt,omitempty"`
+}
+
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "trim and lowercase user emails",
+		Up:          lowercaseEmails,
+	},
+	{
+		Version:     2,
+		Description: "normalize user phone numbers to E.164",
+		Up:          normalizePhones,
+	},
+	{
+		Version:     3,
+		Description: "start appointment versions at 1",
+		Up:          versionAppointments,
+	},
+	{
+		Version:     4,
+		Description: "file existing users, appointments and audit entries under a first clinic",
+		Up:          assignDefaultClinic,
+	},
+	{
+		Version:     5,
+		Description: "drop the phone index replaced by phone_unique",
+		Up:          dropPhoneIndex,
+	},
+	{
+		Version:     6,
+		Description: "give each clinic its own copy of the price list the chat prompt hard-coded",
+		Up:          seedClinicServices,
+	},
+}
+
+// Bootstrap applies pending migrations, then makes sure every index exists.
+func Bootstrap(ctx context.Context, db *mongo.Database) error {
+	if err := RunMigrations(ctx, db); err != nil {
+		return err
+	}
+	return EnsureIndexes(ctx, db)
+}
+
+// RunMigrations applies every migration that is not done yet. A migration is
+// claimed by inserting its record as pending, and marked done only once Up
+// succeeds. Other instances wait while it is pending, so none serves against
+// a half-migrated schema, and take it over if its claim goes stale.
+func RunMigrations(ctx context.Context, db *mongo.Database) error {
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	collection := db.Collection("schemaMigrations")
+	owner := primitive.NewObjectID().Hex()
+
+	for _, m := range migrations {
+		claimed, err := claimMigration(ctx, collection, m, owner)
+		if err != nil {
+			return fmt.Errorf("migration %d: %w", m.Version, err)
+		}
+		if !claimed {
+			continue // Done, by us earlier or by another instance
+		}
+
+		slog.InfoContext(ctx, "applying migration", "version", m.Version, "description", m.Description)
+		if err := runClaimed(ctx, collection, m, owner); err != nil {
+			// Release the claim so the migration is retried next time
+			collection.DeleteOne(ctx, bson.M{"_id": m.Version, "owner": owner})
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Description, err)
+		}
+		res, err := collection.UpdateOne(ctx, bson.M{"_id": m.Version, "owner": owner}, bson.M{
+			"$set":   bson.M{"state": migrationDone, "appliedAt": time.Now().UTC()},
+			"$unset": bson.M{"owner": "", "claimedAt": ""},
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d: recording it as done: %w", m.Version, err)
+		}
+		if res.MatchedCount == 0 {
+			// Our claim went stale and another instance took it over; it
+			// re-runs the migration and records it
+			slog.WarnContext(ctx, "migration claim was taken over", "version", m.Version)
+		}
+	}
+	return nil
+}
+
+// claimMigration returns true once owner holds the claim on m, and false if
+// m is already done. It waits while another instance holds a live claim.
+func claimMigration(ctx context.Context, collection *mongo.Collection, m Migration, owner string) (bool, error) {
+	for {
+		now := time.Now().UTC()
+		_, err := collection.InsertOne(ctx, migrationRecord{
+			Version: m.Version, Description: m.Description,
+			State: migrationPending, Owner: owner, ClaimedAt: now,
+		})
+		if err == nil {
+			return true, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return false, err
+		}
+
+		var record migrationRecord
+		if err := collection.FindOne(ctx, bson.M{"_id": m.Version}).Decode(&record); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				continue // The claim was just released; try again
+			}
+			return false, err
+		}
+		if record.State != migrationPending {
+			return false, nil
+		}
+
+		if now.Sub(record.ClaimedAt) > migrationLease {
+			// Conditional on the stale claim, so only one instance wins it
+			res, err := collection.UpdateOne(ctx,
+				bson.M{"_id": m.Version, "state": migrationPending, "owner": record.Owner, "claimedAt": record.ClaimedAt},
+				bson.M{"$set": bson.M{"owner": owner, "claimedAt": now}})
+			if err != nil {
+				return false, err
+			}
+			if res.MatchedCount == 1 {
+				slog.WarnContext(ctx, "taking over stale migration claim", "version", m.Version, "claimed_at", record.ClaimedAt)
+				return true, nil
+			}
+			continue
+		}
+
+		slog.InfoContext(ctx, "waiting for another instance to apply migration", "version", m.Version)
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(migrationPollInterval):
+		}
+	}
+}
+
+// runClaimed runs m, renewing owner's claim until it returns.
+func runClaimed(ctx context.Context, collection *mongo.Collection, m Migration, owner string) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(migrationLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if _, err := collection.UpdateOne(ctx, bson.M{"_id": m.Version, "owner": owner},
+					bson.M{"$set": bson.M{"claimedAt": time.Now().UTC()}}); err != nil {
+					slog.WarnContext(ctx, "renewing migration claim failed", "version", m.Version, "error", err)
+				}
+			}
+		}
+	}()
+	return m.Up(ctx, collection.Database())
+}
+
+func lowercaseEmails(ctx context.Context, db *mongo.Database) error {
+	users := db.Collection("users")
+	cursor, err := users.Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID    primitive.ObjectID `bson:"_id"`
+			Email string             `bson:"email"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		normalized := strings.ToLower(strings.TrimSpace(doc.Email))
+		if normalized == doc.Email {
+			continue
+		}
+		if _, err := users.UpdateOne(ctx, bson.M{"_id": doc.ID}, bson.M{"$set": bson.M{"email": normalized}}); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func normalizePhones(ctx context.Context, db *mongo.Database) error {
+	users := db.Collection("users")
+	cursor, err := users.Find(ctx, bson.M{"phone": bson.M{"$nin": bson.A{"", nil}}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID    primitive.ObjectID `bson:"_id"`
+			Phone string             `bson:"phone"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		normalized, err := utils.NormalizePhone(doc.Phone, utils.DefaultCountryCode)
+		if errors.Is(err, utils.ErrInvalidPhone) {
+			// Leave it for the user to fix; they cannot verify it anyway
+			slog.WarnContext(ctx, "migration: invalid phone number left unchanged", "user_id", doc.ID.Hex())
+			continue
+		}
+		if normalized == doc.Phone {
+			continue
+		}
+		if _, err := users.UpdateOne(ctx, bson.M{"_id": doc.ID}, bson.M{"$set": bson.M{"phone": normalized}}); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// versionAppointments gives existing appointments the version that
+// optimistic updates compare against.
+func versionAppointments(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("appointments").UpdateMany(ctx,
+		bson.M{"version": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"version": 1}})
+	return err
+}
+
+// DefaultClinicName names the clinic that existing data is filed under when
+// multi-clinic support is introduced. Admins can rename it later.
+const DefaultClinicName = "Main clinic"
+
+// assignDefaultClinic creates the first clinic, unless one exists already,
+// and files everything that predates clinics under it.
+func assignDefaultClinic(ctx context.Context, db *mongo.Database) error {
+	clinics := db.Collection("clinics")
+	var clinic struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	err := clinics.FindOne(ctx, bson.M{}).Decode(&clinic)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		clinic.ID = primitive.NewObjectID()
+		_, err = clinics.InsertOne(ctx, bson.M{"_id": clinic.ID, "name": DefaultClinicName, "createdAt": time.Now().UTC()})
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, m := range []struct {
+		collection, field string
+		value             any
+	}{
+		{"users", "clinicIds", bson.A{clinic.ID}},
+		{"appointments", "clinicId", clinic.ID},
+		{"auditLog", "clinicId", clinic.ID.Hex()},
+	} {
+		if _, err := db.Collection(m.collection).UpdateMany(ctx,
+			bson.M{m.field: bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{m.field: m.value}}); err != nil {
+			return fmt.Errorf("%s: %w", m.collection, err)
+		}
+	}
+	return nil
+}
+
+// dropPhoneIndex removes the old non-unique phone index so EnsureIndexes can
+// build phone_unique on the same key. Duplicate numbers must be cleaned up
+// by hand first; EnsureIndexes reports them.
+func dropPhoneIndex(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("users").Indexes().DropOne(ctx, "phone")
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && (cmdErr.Name == "IndexNotFound" || cmdErr.Name == "NamespaceNotFound") {
+		return nil // Fresh database, or already dropped
+	}
+	return err
+}
+
+// legacyServices is the price list the chat prompt used to hard-code, in USD.
+var legacyServices = bson.A{
+	bson.M{"name": "Standard Check-up", "price": 75},
+	bson.M{"name": "Teeth Cleaning", "price": 120},
+	bson.M{"name": "X-Ray", "price": 50},
+	bson.M{"name": "Filling", "price": 150, "maxPrice": 300},
+	bson.M{"name": "Whitening", "price": 400},
+}
+
+// seedClinicServices copies the former global price list into every clinic
+// that has none, so each branch's assistant keeps quoting it until an admin
+// edits that branch's list. Clinics billing in another currency are left
+// empty: the USD prices would be wrong there.
+func seedClinicServices(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("clinics").UpdateMany(ctx,
+		bson.M{
+			"settings.services": bson.M{"$exists": false},
+			"settings.currency": bson.M{"$in": bson.A{nil, "", "USD"}},
+		},
+		bson.M{"$set": bson.M{"settings.services": legacyServices, "settings.currency": "USD"}})
+	return err
+}
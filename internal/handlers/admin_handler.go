@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harentsoaR/dentist-api/internal/apierror"
+	"github.com/harentsoaR/dentist-api/internal/models"
+	"github.com/harentsoaR/dentist-api/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Deleted users and appointments stay in the database, hidden, until the
+// purge job removes them after the retention period. Until then an admin
+// can bring them back.
+
+// --- DELETE USER (Admin Only) ---
+func (h *Handler) DeleteUser(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userRole, _ := c.Get("userRole")
+	if userRole != "admin" {
+		respondError(c, http.StatusForbidden, "Permission denied.")
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	if userID.Hex() == c.GetString("userID") {
+		respondError(c, http.StatusBadRequest, "You cannot delete your own account here")
+		return
+	}
+
+	user, err := h.Users.FindByID(ctx, userID)
+	if err == nil {
+		err = h.Users.SoftDelete(ctx, userID, c.GetString("userID"))
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			respondError(c, http.StatusNotFound, "User not found")
+			return
+		}
+		fail(c, err)
+		return
+	}
+	h.recordAudit(c, models.AuditUserDeleted, models.AuditTargetUser, userID.Hex(), user, nil)
+
+	c.Status(http.StatusNoContent)
+}
+
+// --- RESTORE USER (Admin Only) ---
+func (h *Handler) RestoreUser(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userRole, _ := c.Get("userRole")
+	if userRole != "admin" {
+		respondError(c, http.StatusForbidden, "Permission denied.")
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	user, err := h.Users.Restore(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			respondError(c, http.StatusNotFound, "No deleted user with this ID")
+			return
+		}
+		fail(c, err)
+		return
+	}
+	h.recordAudit(c, models.AuditUserRestored, models.AuditTargetUser, userID.Hex(), nil, user)
+
+	c.JSON(http.StatusOK, user)
+}
+
+// --- SET USER ROLE (Admin Only) ---
+
+// SetUserRole gives a user one of models.AssignableRoles. The user's
+// current tokens keep the old role until they expire.
+func (h *Handler) SetUserRole(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userRole, _ := c.Get("userRole")
+	if userRole != "admin" {
+		respondError(c, http.StatusForbidden, "Permission denied.")
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	if !slices.Contains(models.AssignableRoles, req.Role) {
+		fail(c, apierror.Invalid("role", "oneof", "must be one of: "+strings.Join(models.AssignableRoles, ", ")))
+		return
+	}
+
+	user, err := h.Users.FindByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			respondError(c, http.StatusNotFound, "User not found")
+			return
+		}
+		fail(c, err)
+		return
+	}
+	// Admins are appointed and removed in the database
+	if user.Role == "admin" {
+		respondError(c, http.StatusForbidden, "Admin accounts are managed in the database")
+		return
+	}
+	before := *user
+	user.Role = req.Role
+	if err := h.Users.Update(ctx, user); err != nil {
+		fail(c, err)
+		return
+	}
+	h.recordAudit(c, models.AuditUserRoleChanged, models.AuditTargetUser, userID.Hex(), &before, user)
+
+	c.JSON(http.StatusOK, user)
+}
+
+// --- RESTORE APPOINTMENT (Admin Only) ---
+func (h *Handler) RestoreAppointment(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userRole, _ := c.Get("userRole")
+	if userRole != "admin" {
+		respondError(c, http.StatusForbidden, "Permission denied.")
+		return
+	}
+
+	appointmentID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid appointment ID")
+		return
+	}
+
+	apt, err := h.Appointments.Restore(ctx, appointmentID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			respondError(c, http.StatusNotFound, "No deleted appointment with this ID")
+			return
+		}
+		fail(c, err)
+		return
+	}
+	h.recordAudit(c, models.AuditAppointmentRestored, models.AuditTargetAppointment, appointmentID.Hex(), nil, apt)
+
+	c.Header("ETag", appointmentETag(apt))
+	c.JSON(http.StatusOK, apt)
+}
@@ -1,51 +1,73 @@
 package handlers
 
 import (
-	"context"
+	"errors"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/harentsoaR/dentist-api/internal/apierror"
+	"github.com/harentsoaR/dentist-api/internal/metrics"
 	"github.com/harentsoaR/dentist-api/internal/models"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/harentsoaR/dentist-api/internal/repository"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // --- CREATE APPOINTMENT (Enhanced with Notifications) ---
 func (h *Handler) CreateAppointment(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	var req struct {
-		StartTime string `json:"startTime"`
-		EndTime   string `json:"endTime"`
-		Service   string `json:"service"`
+		StartTime string `json:"startTime" binding:"required"`
+		EndTime   string `json:"endTime" binding:"required"`
+		Service   string `json:"service" binding:"required"`
+		Notes     string `json:"notes" binding:"max=2000"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+	if !bindJSON(c, &req) {
 		return
 	}
 
-	startTime, err1 := time.Parse(time.RFC3339, req.StartTime)
-	endTime, err2 := time.Parse(time.RFC3339, req.EndTime)
-	if err1 != nil || err2 != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time format, use RFC3339"})
+	var v apierror.Validation
+	startTime := parseTimeField(&v, "startTime", req.StartTime)
+	endTime := parseTimeField(&v, "endTime", req.EndTime)
+	checkTimeRange(&v, startTime, endTime)
+	if err := v.Err(); err != nil {
+		fail(c, err)
 		return
 	}
 
 	userIDHex, _ := c.Get("userID")
 	userRole, _ := c.Get("userRole")
 	if userRole != "client" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only clients can book appointments."})
+		respondError(c, http.StatusForbidden, "Only clients can book appointments.")
 		return
 	}
 
 	patientID, _ := primitive.ObjectIDFromHex(userIDHex.(string))
 
+	clinic, err := h.currentClinic(ctx)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	checkOpeningHours(&v, clinic, startTime, endTime)
+	if err := v.Err(); err != nil {
+		fail(c, err)
+		return
+	}
+
 	// Get full patient details for notifications
-	var patient models.User
-	userCollection := h.DB.Collection("users")
-	err := userCollection.FindOne(context.TODO(), bson.M{"_id": patientID}).Decode(&patient)
+	patient, err := h.Users.FindByID(ctx, patientID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not find user details"})
+		fail(c, apierror.Internal("Could not find user details", err))
+		return
+	}
+
+	if h.RequireVerifiedContact && !patient.HasVerifiedContact() {
+		respondError(c, http.StatusForbidden, "Please verify your email address or phone number before booking an appointment.")
 		return
 	}
 
@@ -56,162 +78,211 @@ func (h *Handler) CreateAppointment(c *gin.Context) {
 		StartTime:   startTime,
 		EndTime:     endTime,
 		Service:     req.Service,
-		Status:      "Scheduled", // Set default status
+		Notes:       strings.TrimSpace(req.Notes),
+		Status:      models.StatusScheduled, // Set default status
 	}
 
-	collection := h.DB.Collection("appointments")
-	_, err = collection.InsertOne(context.TODO(), apt)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create appointment"})
+	if err := h.Appointments.Create(ctx, &apt); err != nil {
+		fail(c, err)
 		return
 	}
 
+	metrics.AppointmentsBooked.Inc()
+	h.recordAudit(c, models.AuditAppointmentCreated, models.AuditTargetAppointment, apt.ID.Hex(), nil, &apt)
+
 	// --- NOTIFICATION ---
-	h.NotificationSvc.SendAppointmentConfirmationSMS(&patient, &apt)
+	h.NotificationSvc.SendAppointmentConfirmationSMS(ctx, patient, &apt, clinic)
 
+	c.Header("ETag", appointmentETag(&apt))
+	c.Header("Location", "/api/appointments/"+apt.ID.Hex())
 	c.JSON(http.StatusCreated, apt)
 }
 
-// --- GET APPOINTMENTS (with Filtering & Sorting) ---
-func (h *Handler) GetAppointments(c *gin.Context) {
-	filter := bson.M{}
-
-	// Filter by date range (e.g., /api/appointments?startDate=2024-07-01&endDate=2024-07-31)
+// applyDateFilters reads the startDate/endDate/status query parameters
+// (e.g. ?startDate=2024-07-01&endDate=2024-07-31&status=Scheduled) into q,
+// recording invalid ones in v.
+func applyDateFilters(c *gin.Context, q *repository.AppointmentQuery, v *apierror.Validation) {
 	if startDateStr := c.Query("startDate"); startDateStr != "" {
 		if startDate, err := time.Parse("2006-01-02", startDateStr); err == nil {
-			filter["startTime"] = bson.M{"$gte": startDate}
+			q.From = &startDate
+		} else {
+			v.Add("startDate", "invalid_format", "must be a date in YYYY-MM-DD format")
 		}
 	}
 	if endDateStr := c.Query("endDate"); endDateStr != "" {
 		if endDate, err := time.Parse("2006-01-02", endDateStr); err == nil {
-			// Add 24 hours to include the entire end day
+			// Add time to include the entire end day
 			endDate = endDate.Add(23*time.Hour + 59*time.Minute)
-			if f, ok := filter["startTime"].(bson.M); ok {
-				f["$lte"] = endDate
-			} else {
-				filter["startTime"] = bson.M{"$lte": endDate}
-			}
+			q.To = &endDate
+		} else {
+			v.Add("endDate", "invalid_format", "must be a date in YYYY-MM-DD format")
 		}
 	}
-
-	// Filter by status (e.g., /api/appointments?status=Scheduled)
+	if q.From != nil && q.To != nil && q.To.Before(*q.From) {
+		v.Add("endDate", "out_of_range", "must not be before startDate")
+	}
 	if status := c.Query("status"); status != "" {
-		filter["status"] = status
+		if slices.Contains(models.AppointmentStatuses, status) {
+			q.Status = status
+		} else {
+			v.Add("status", "oneof", "must be one of: "+strings.Join(models.AppointmentStatuses, ", "))
+		}
+	}
+}
+
+// parseTimeField parses an RFC 3339 timestamp, recording a field error in v
+// when it is malformed.
+func parseTimeField(v *apierror.Validation, field, value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		v.Add(field, "invalid_format", "must be an RFC 3339 timestamp, e.g. 2024-07-01T09:30:00Z")
+	}
+	return t
+}
+
+// checkTimeRange records an error when the appointment would end before it starts.
+func checkTimeRange(v *apierror.Validation, start, end time.Time) {
+	if v.Has("startTime") || v.Has("endTime") {
+		return
+	}
+	if !end.After(start) {
+		v.Add("endTime", "out_of_range", "must be after startTime")
+	}
+}
+
+// checkOpeningHours adds an error unless [start, end) falls within the
+// clinic's opening hours. It is skipped when the times are already invalid.
+func checkOpeningHours(v *apierror.Validation, clinic *models.Clinic, start, end time.Time) {
+	if v.Has("startTime") || v.Has("endTime") {
+		return
 	}
+	if !clinic.Settings.IsOpen(start, end) {
+		v.Add("startTime", "outside_opening_hours",
+			"must fall within the clinic's opening hours ("+clinic.Settings.DescribeOpeningHours()+", "+clinic.Settings.Location().String()+" time)")
+	}
+}
 
-	// Sort by start time to "group" by date
-	findOptions := options.Find().SetSort(bson.D{{Key: "startTime", Value: 1}}) // 1 for ascending
+// --- GET APPOINTMENTS (with Filtering & Sorting) ---
+func (h *Handler) GetAppointments(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var q repository.AppointmentQuery
+	var v apierror.Validation
+	applyDateFilters(c, &q, &v)
+	// Sorted by start time (ascending) to "group" by date, unless ?sort= says otherwise
+	page := parsePage(c, "startTime", &v)
+	if err := v.Err(); err != nil {
+		fail(c, err)
+		return
+	}
+	page.apply(&q)
 
-	collection := h.DB.Collection("appointments")
-	cursor, err := collection.Find(context.TODO(), filter, findOptions)
+	appointments, err := h.Appointments.List(ctx, q)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve appointments"})
+		fail(c, err)
 		return
 	}
-	defer cursor.Close(context.TODO())
 
-	var appointments []models.Appointment
-	if err = cursor.All(context.TODO(), &appointments); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode appointments"})
+	h.respondAppointmentPage(c, q, page, appointments)
+}
+
+// --- GET ONE APPOINTMENT ---
+
+// GetAppointmentByID returns one appointment with its ETag, to send back in
+// If-Match when editing it. Clients only see their own.
+func (h *Handler) GetAppointmentByID(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	appointmentID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid appointment ID")
+		return
+	}
+
+	apt, err := h.Appointments.FindByID(ctx, appointmentID)
+	userRole, _ := c.Get("userRole")
+	if err == nil && userRole == "client" && apt.PatientID.Hex() != c.GetString("userID") {
+		err = repository.ErrNotFound // Don't reveal other patients' bookings
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			respondError(c, http.StatusNotFound, "Appointment not found")
+			return
+		}
+		fail(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, appointments)
+	c.Header("ETag", appointmentETag(apt))
+	c.JSON(http.StatusOK, apt)
 }
 
 // --- GET APPOINTMENTS FOR A USER (with Role-Based Filtering) ---
 func (h *Handler) GetAppointment(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	// --- SECURITY & ROLE-BASED LOGIC ---
 	// Get user info from the context (set by your JWT middleware)
 	userIDHex, _ := c.Get("userID")
 	userRole, _ := c.Get("userRole")
 
-	// Start with an empty filter
-	filter := bson.M{}
+	var q repository.AppointmentQuery
 
 	// If the user is a 'client', force the filter to only include their appointments
 	if userRole == "client" {
 		patientID, err := primitive.ObjectIDFromHex(userIDHex.(string))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID in token"})
+			respondError(c, http.StatusUnauthorized, "Invalid user ID in token")
 			return
 		}
-		filter["patientId"] = patientID
+		q.PatientID = &patientID
 	}
 	// If the user is a 'dentist' or 'staff', the filter remains empty, so they can see all appointments.
-	// We can add more specific filters for them later if needed (e.g., filter by a specific patient ID from a query param).
-
-	// --- EXISTING FILTERING LOGIC (Can be combined with the role-based filter) ---
-
-	// Filter by date range (e.g., /api/appointments?startDate=2024-07-01&endDate=2024-07-31)
-	if startDateStr := c.Query("startDate"); startDateStr != "" {
-		if startDate, err := time.Parse("2006-01-02", startDateStr); err == nil {
-			filter["startTime"] = bson.M{"$gte": startDate}
-		}
-	}
-	if endDateStr := c.Query("endDate"); endDateStr != "" {
-		if endDate, err := time.Parse("2006-01-02", endDateStr); err == nil {
-			// Add time to include the entire end day
-			endDate = endDate.Add(23*time.Hour + 59*time.Minute)
-			if f, ok := filter["startTime"].(bson.M); ok {
-				f["$lte"] = endDate
-			} else {
-				filter["startTime"] = bson.M{"$lte": endDate}
-			}
-		}
-	}
 
-	// Filter by status (e.g., /api/appointments?status=Scheduled)
-	if status := c.Query("status"); status != "" {
-		filter["status"] = status
-	}
+	var v apierror.Validation
+	applyDateFilters(c, &q, &v)
 
 	// For staff/dentists who might want to look up a specific patient's appointments
 	if userRole != "client" {
 		if patientIDQuery := c.Query("patientId"); patientIDQuery != "" {
 			pID, err := primitive.ObjectIDFromHex(patientIDQuery)
 			if err == nil {
-				filter["patientId"] = pID
+				q.PatientID = &pID
+			} else {
+				v.Add("patientId", "invalid_format", "must be a valid ID")
 			}
 		}
 	}
-
-	// Sort by start time to "group" by date
-	findOptions := options.Find().SetSort(bson.D{{Key: "startTime", Value: -1}}) // -1 for descending (newest first)
-
-	collection := h.DB.Collection("appointments")
-	cursor, err := collection.Find(context.TODO(), filter, findOptions)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve appointments"})
+	// Newest first by default
+	page := parsePage(c, "-startTime", &v)
+	if err := v.Err(); err != nil {
+		fail(c, err)
 		return
 	}
-	defer cursor.Close(context.TODO())
+	page.apply(&q)
 
-	var appointments []models.Appointment
-	if err = cursor.All(context.TODO(), &appointments); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode appointments"})
+	appointments, err := h.Appointments.List(ctx, q)
+	if err != nil {
+		fail(c, err)
 		return
 	}
 
-	// It's good practice to return an empty array instead of `nil` if no appointments are found
-	if appointments == nil {
-		appointments = make([]models.Appointment, 0)
-	}
-
-	c.JSON(http.StatusOK, appointments)
+	h.respondAppointmentPage(c, q, page, appointments)
 }
 
 // --- UPDATE APPOINTMENT (Dentist/Staff Only) ---
 func (h *Handler) UpdateAppointment(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	userRole, _ := c.Get("userRole")
 	if userRole != "dentist" && userRole != "staff" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied."})
+		respondError(c, http.StatusForbidden, "Permission denied.")
 		return
 	}
 
 	appointmentID, err := primitive.ObjectIDFromHex(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid appointment ID"})
+		respondError(c, http.StatusBadRequest, "Invalid appointment ID")
 		return
 	}
 
@@ -220,84 +291,191 @@ func (h *Handler) UpdateAppointment(c *gin.Context) {
 		EndTime   *string `json:"endTime,omitempty"`
 		Service   *string `json:"service,omitempty"`
 		Status    *string `json:"status,omitempty"`
+		Notes     *string `json:"notes,omitempty" binding:"omitempty,max=2000"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+	if !bindJSON(c, &req) {
 		return
 	}
 
-	updateFields := bson.M{}
-	if req.StartTime != nil {
-		if t, err := time.Parse(time.RFC3339, *req.StartTime); err == nil {
-			updateFields["startTime"] = t
+	if req.StartTime == nil && req.EndTime == nil && req.Service == nil && req.Status == nil && req.Notes == nil {
+		respondError(c, http.StatusBadRequest, "No fields to update")
+		return
+	}
+
+	apt, err := h.Appointments.FindByID(ctx, appointmentID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			respondError(c, http.StatusNotFound, "Appointment not found")
+			return
 		}
+		fail(c, err)
+		return
+	}
+	if !checkIfMatch(c, appointmentETag(apt)) {
+		return
+	}
+	before := *apt
+
+	// Every field is checked before anything is changed: a bad value is a
+	// 400, never silently dropped.
+	var v apierror.Validation
+	if req.StartTime != nil {
+		apt.StartTime = parseTimeField(&v, "startTime", *req.StartTime)
 	}
 	if req.EndTime != nil {
-		if t, err := time.Parse(time.RFC3339, *req.EndTime); err == nil {
-			updateFields["endTime"] = t
+		apt.EndTime = parseTimeField(&v, "endTime", *req.EndTime)
+	}
+	if req.StartTime != nil || req.EndTime != nil {
+		checkTimeRange(&v, apt.StartTime, apt.EndTime)
+		// A reschedule must land within opening hours, as a booking does
+		clinic, err := h.Clinics.FindByID(ctx, apt.ClinicID)
+		if err != nil {
+			fail(c, err)
+			return
 		}
+		checkOpeningHours(&v, clinic, apt.StartTime, apt.EndTime)
 	}
 	if req.Service != nil {
-		updateFields["service"] = *req.Service
+		if strings.TrimSpace(*req.Service) == "" {
+			v.Add("service", "required", "cannot be empty")
+		}
+		apt.Service = strings.TrimSpace(*req.Service)
 	}
 	if req.Status != nil {
-		updateFields["status"] = *req.Status
+		if !slices.Contains(models.AppointmentStatuses, *req.Status) {
+			v.Add("status", "oneof", "must be one of: "+strings.Join(models.AppointmentStatuses, ", "))
+		}
+		apt.Status = *req.Status
 	}
-
-	if len(updateFields) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+	if req.Notes != nil {
+		apt.Notes = strings.TrimSpace(*req.Notes)
+	}
+	if err := v.Err(); err != nil {
+		fail(c, err)
 		return
 	}
 
-	collection := h.DB.Collection("appointments")
-	_, err = collection.UpdateOne(context.TODO(), bson.M{"_id": appointmentID}, bson.M{"$set": updateFields})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update appointment"})
+	if err := h.Appointments.Update(ctx, apt); err != nil {
+		fail(c, err)
 		return
 	}
 
+	h.recordAudit(c, models.AuditAppointmentUpdated, models.AuditTargetAppointment, apt.ID.Hex(), &before, apt)
+
+	c.Header("ETag", appointmentETag(apt))
 	c.JSON(http.StatusOK, gin.H{"message": "Appointment updated successfully"})
 }
 
 // --- CANCEL APPOINTMENT (Dentist/Staff Only) ---
 func (h *Handler) CancelAppointment(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	userRole, _ := c.Get("userRole")
 	if userRole != "dentist" && userRole != "staff" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied."})
+		respondError(c, http.StatusForbidden, "Permission denied.")
 		return
 	}
 
 	appointmentID, err := primitive.ObjectIDFromHex(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid appointment ID"})
+		respondError(c, http.StatusBadRequest, "Invalid appointment ID")
 		return
 	}
 
-	collection := h.DB.Collection("appointments")
-
 	// Find the appointment first to get patient info for notification
-	var apt models.Appointment
-	err = collection.FindOne(context.TODO(), bson.M{"_id": appointmentID}).Decode(&apt)
+	apt, err := h.Appointments.FindByID(ctx, appointmentID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+		if errors.Is(err, repository.ErrNotFound) {
+			respondError(c, http.StatusNotFound, "Appointment not found")
+			return
+		}
+		fail(c, err)
+		return
+	}
+	if !checkIfMatch(c, appointmentETag(apt)) {
 		return
 	}
 
 	// Update the status to "Cancelled"
-	_, err = collection.UpdateOne(context.TODO(), bson.M{"_id": appointmentID}, bson.M{"$set": bson.M{"status": "Cancelled"}})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel appointment"})
+	before := *apt
+	apt.Status = models.StatusCancelled
+	if err := h.Appointments.Update(ctx, apt); err != nil {
+		fail(c, err)
 		return
 	}
+	metrics.AppointmentsCancelled.Inc()
+	h.recordAudit(c, models.AuditAppointmentCancelled, models.AuditTargetAppointment, apt.ID.Hex(), &before, apt)
 
 	// Find patient details for notification
-	var patient models.User
-	userCollection := h.DB.Collection("users")
-	err = userCollection.FindOne(context.TODO(), bson.M{"_id": apt.PatientID}).Decode(&patient)
-	if err == nil {
-		apt.Status = "Cancelled" // Manually update status for the notification object
-		h.NotificationSvc.SendAppointmentConfirmationSMS(&patient, &apt)
+	if patient, err := h.Users.FindByID(ctx, apt.PatientID); err == nil {
+		clinic, _ := h.Clinics.FindByID(ctx, apt.ClinicID)
+		h.NotificationSvc.SendAppointmentConfirmationSMS(ctx, patient, apt, clinic)
 	}
 
+	c.Header("ETag", appointmentETag(apt))
 	c.JSON(http.StatusOK, gin.H{"message": "Appointment cancelled successfully"})
 }
+
+// --- DELETE APPOINTMENT (Dentist/Staff/Admin) ---
+
+// DeleteAppointment hides the appointment; an admin can restore it until
+// the purge job removes it. Cancelling is still the normal way to call off
+// a booking: deleting is for entries made by mistake.
+func (h *Handler) DeleteAppointment(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userRole, _ := c.Get("userRole")
+	if userRole != "dentist" && userRole != "staff" && userRole != "admin" {
+		respondError(c, http.StatusForbidden, "Permission denied.")
+		return
+	}
+
+	appointmentID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid appointment ID")
+		return
+	}
+
+	apt, err := h.Appointments.FindByID(ctx, appointmentID)
+	if err == nil {
+		err = h.Appointments.SoftDelete(ctx, appointmentID, c.GetString("userID"))
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			respondError(c, http.StatusNotFound, "Appointment not found")
+			return
+		}
+		fail(c, err)
+		return
+	}
+	h.recordAudit(c, models.AuditAppointmentDeleted, models.AuditTargetAppointment, appointmentID.Hex(), apt, nil)
+
+	c.Status(http.StatusNoContent)
+}
+
+// --- Optimistic concurrency ---
+
+// appointmentETag is the strong ETag of an appointment's current version.
+func appointmentETag(apt *models.Appointment) string {
+	return `"` + strconv.FormatInt(apt.Version, 10) + `"`
+}
+
+// checkIfMatch makes edits conditional: without an If-Match header the
+// request is refused with 428, and if it doesn't list the current ETag
+// (someone saved in between) with 412, so the UI reloads instead of
+// overwriting. "*" matches any version.
+func checkIfMatch(c *gin.Context, etag string) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		apierror.Respond(c, apierror.New(http.StatusPreconditionRequired, "precondition_required", "The If-Match header is required; send the ETag you last read"))
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		if candidate = strings.TrimSpace(candidate); candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	c.Header("ETag", etag)
+	apierror.Respond(c, apierror.New(http.StatusPreconditionFailed, "", "The appointment was changed by someone else; reload it and try again"))
+	return false
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harentsoaR/dentist-api/internal/apierror"
+	"github.com/harentsoaR/dentist-api/internal/middleware"
+	"github.com/harentsoaR/dentist-api/internal/models"
+	"github.com/harentsoaR/dentist-api/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// auditIgnoredFields change on every write and say nothing about the edit.
+var auditIgnoredFields = []string{"id", "version"}
+
+// recordAudit appends an entry for a change made by the current request. before
+// is nil for creations. The change has already happened, so a failure to
+// record it is logged rather than turned into an error response.
+func (h *Handler) recordAudit(c *gin.Context, action, targetType, targetID string, before, after any) {
+	if h.Audit == nil {
+		return
+	}
+	// Still record the change if the client has gone away
+	ctx := context.WithoutCancel(c.Request.Context())
+
+	entry := &models.AuditEntry{
+		ID:         primitive.NewObjectID(),
+		At:         time.Now().UTC(),
+		ActorID:    c.GetString("userID"),
+		ActorRole:  c.GetString("userRole"),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IP:         c.ClientIP(),
+		RequestID:  middleware.GetRequestID(c),
+	}
+	changes, err := auditDiff(before, after)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to diff audited change", "action", action, "error", err)
+	}
+	entry.Changes = changes
+	if h.AuditRetention > 0 {
+		expiresAt := entry.At.Add(h.AuditRetention)
+		entry.ExpiresAt = &expiresAt
+	}
+
+	if err := h.Audit.Append(ctx, entry); err != nil {
+		slog.ErrorContext(ctx, "failed to write audit entry", "action", action, "target_id", targetID, "error", err)
+	}
+}
+
+// auditDiff lists the top-level fields whose JSON value differs between
+// before and after. Fields hidden from the API (passwords) never appear.
+func auditDiff(before, after any) ([]models.FieldChange, error) {
+	from, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range from {
+		names = append(names, name)
+	}
+	for name := range to {
+		if _, ok := from[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	var changes []models.FieldChange
+	for _, name := range names {
+		if slices.Contains(auditIgnoredFields, name) || reflect.DeepEqual(from[name], to[name]) {
+			continue
+		}
+		changes = append(changes, models.FieldChange{Field: name, From: from[name], To: to[name]})
+	}
+	return changes, nil
+}
+
+func jsonFields(v any) (map[string]any, error) {
+	fields := map[string]any{}
+	if rv := reflect.ValueOf(v); !rv.IsValid() || (rv.Kind() == reflect.Pointer && rv.IsNil()) {
+		return fields, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return fields, json.Unmarshal(data, &fields)
+}
+
+// --- AUDIT LOG (Admin and Staff Only) ---
+
+// GetAuditLog lists audit entries, newest first. Filters: actorId, action,
+// targetType, targetId, from and to (RFC 3339). Pages are chained through
+// the Link header (?before=<last id>).
+func (h *Handler) GetAuditLog(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userRole, _ := c.Get("userRole")
+	if userRole != "admin" && userRole != "staff" {
+		respondError(c, http.StatusForbidden, "Permission denied.")
+		return
+	}
+
+	q := repository.AuditQuery{
+		ActorID:    c.Query("actorId"),
+		Action:     c.Query("action"),
+		TargetType: c.Query("targetType"),
+		TargetID:   c.Query("targetId"),
+	}
+	var v apierror.Validation
+	if raw := c.Query("from"); raw != "" {
+		from := parseTimeField(&v, "from", raw)
+		q.From = &from
+	}
+	if raw := c.Query("to"); raw != "" {
+		to := parseTimeField(&v, "to", raw)
+		q.To = &to
+	}
+	if raw := c.Query("before"); raw != "" {
+		before, err := primitive.ObjectIDFromHex(raw)
+		if err != nil {
+			v.Add("before", "invalid_format", "must be a valid ID")
+		}
+		q.Before = &before
+	}
+	limit := int64(DefaultPageSize)
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 1 || n > MaxPageSize {
+			v.Add("limit", "out_of_range", fmt.Sprintf("must be between 1 and %d", MaxPageSize))
+		}
+		limit = n
+	}
+	if err := v.Err(); err != nil {
+		fail(c, err)
+		return
+	}
+	q.Limit = limit + 1
+
+	entries, err := h.Audit.List(ctx, q)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	if int64(len(entries)) > limit {
+		entries = entries[:limit]
+		next := *c.Request.URL
+		params := next.Query()
+		params.Set("before", entries[len(entries)-1].ID.Hex())
+		next.RawQuery = params.Encode()
+		c.Header("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
@@ -3,100 +3,185 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"log/slog"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/harentsoaR/dentist-api/internal/apierror"
 	"github.com/harentsoaR/dentist-api/internal/models"
+	"github.com/harentsoaR/dentist-api/internal/repository"
+	"github.com/harentsoaR/dentist-api/internal/tenant"
 	"github.com/harentsoaR/dentist-api/internal/utils"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type RegisterUserRequest struct {
 	FullName string `json:"fullName" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=8"`
-	Role     string `json:"role"`
+	Role     string `json:"role"`                     // Only "client"; other roles are given by an admin
 	Phone    string `json:"phone" binding:"required"` // Ajout du champ phone avec validation
+	ClinicID string `json:"clinicId"`                 // Optional while there is a single clinic
+}
+
+// normalizeEmail is how emails are stored and looked up; the unique index on
+// users.email is case-insensitive as a second line of defence.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// duplicateAccountMessage names the contact detail another account already
+// uses, from a repository.ErrDuplicate.
+func duplicateAccountMessage(err error) string {
+	var dup *repository.DuplicateError
+	if errors.As(err, &dup) && dup.Field == "phone" {
+		return "An account with this phone number already exists"
+	}
+	return "An account with this email already exists"
 }
 
 // RegisterUser is a METHOD of the Handler struct.
 func (h *Handler) RegisterUser(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	var req RegisterUserRequest // Utilise notre nouvelle structure de requête
 
-	// ShouldBindJSON va maintenant lire le mot de passe ET valider les champs
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	// bindJSON lit le mot de passe ET valide les champs (400 avec le détail des champs invalides)
+	if !bindJSON(c, &req) {
 		return
 	}
 
 	// Nous construisons maintenant manuellement notre modèle `User` pour la base de données
 	hashedPassword, err := utils.HashPassword(req.Password)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		fail(c, apierror.Internal("Failed to hash password", err))
 		return
 	}
 
-	// Définir le rôle par défaut si non fourni
-	role := req.Role
-	if role == "" {
-		role = "client"
+	phone, err := utils.NormalizePhone(req.Phone, h.DefaultPhoneCountry)
+	if err != nil {
+		fail(c, apierror.Invalid("phone", "invalid_format", "must be a valid phone number"))
+		return
 	}
 
-	user := models.User{
-		ID:       primitive.NewObjectID(),
-		FullName: req.FullName,
-		Email:    req.Email,
-		Password: hashedPassword, // Le mot de passe haché est maintenant stocké
-		Role:     role,
-		Phone:    req.Phone, // Ajout du champ phone
+	// Staff roles open patient records, so an admin grants them (SetUserRole)
+	if req.Role != "" && req.Role != "client" {
+		fail(c, apierror.Invalid("role", "oneof", "must be client; other roles are given by an admin"))
+		return
 	}
 
-	collection := h.DB.Collection("users")
-	_, err = collection.InsertOne(context.TODO(), user)
+	clinicID, err := h.registrationClinic(ctx, req.ClinicID)
 	if err != nil {
-		// Gérer le cas où l'email existe déjà
-		if mongo.IsDuplicateKeyError(err) {
-			c.JSON(http.StatusConflict, gin.H{"error": "An account with this email already exists"})
+		fail(c, err)
+		return
+	}
+
+	user := models.User{
+		ID:        primitive.NewObjectID(),
+		FullName:  req.FullName,
+		Email:     normalizeEmail(req.Email),
+		Password:  hashedPassword, // Le mot de passe haché est maintenant stocké
+		Role:      "client",
+		Phone:     phone, // Numéro normalisé au format E.164
+		ClinicIDs: []primitive.ObjectID{clinicID},
+	}
+
+	if err := h.Users.Create(ctx, &user); err != nil {
+		// Gérer le cas où l'email ou le téléphone existe déjà
+		if errors.Is(err, repository.ErrDuplicate) {
+			respondError(c, http.StatusConflict, duplicateAccountMessage(err))
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		fail(c, apierror.Internal("Failed to create user", err))
 		return
 	}
 
+	// The route is public, so no clinic came with the request: file the entry
+	// (and the verification email) under the clinic joined
+	ctx = tenant.WithClinic(ctx, clinicID)
+	c.Request = c.Request.WithContext(ctx)
+	h.recordAudit(c, models.AuditUserCreated, models.AuditTargetUser, user.ID.Hex(), nil, &user)
+
+	// The account exists even if the email cannot be sent; the user can ask for a resend.
+	if err := h.issueEmailVerification(ctx, &user); err != nil {
+		slog.ErrorContext(ctx, "failed to issue verification email", "user_id", user.ID.Hex(), "error", err)
+	}
+
 	// Le tag `json:"-"` sur `user.Password` dans la structure `models.User`
 	// empêchera le mot de passe haché d'être renvoyé ici. C'est parfait.
 	c.JSON(http.StatusCreated, user)
 }
 
+// registrationClinic resolves the clinic a new account joins. It may be
+// omitted when there is only one.
+func (h *Handler) registrationClinic(ctx context.Context, clinicIDHex string) (primitive.ObjectID, error) {
+	if clinicIDHex == "" {
+		clinics, err := h.Clinics.List(ctx)
+		if err != nil {
+			return primitive.NilObjectID, err
+		}
+		if len(clinics) != 1 {
+			return primitive.NilObjectID, apierror.Invalid("clinicId", "required", "is required")
+		}
+		return clinics[0].ID, nil
+	}
+	clinicID, err := primitive.ObjectIDFromHex(clinicIDHex)
+	if err != nil {
+		return primitive.NilObjectID, apierror.Invalid("clinicId", "invalid_format", "must be a clinic ID")
+	}
+	if _, err := h.Clinics.FindByID(ctx, clinicID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return primitive.NilObjectID, apierror.Invalid("clinicId", "not_found", "is not a known clinic")
+		}
+		return primitive.NilObjectID, err
+	}
+	return clinicID, nil
+}
+
 // Login is a METHOD of the Handler struct.
 func (h *Handler) Login(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	var loginReq struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		// ClinicID picks the clinic to act for; by default the user's first
+		ClinicID string `json:"clinicId"`
 	}
-	if err := c.ShouldBindJSON(&loginReq); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+	if !bindJSON(c, &loginReq) {
 		return
 	}
 
-	var user models.User
-	collection := h.DB.Collection("users")
-	err := collection.FindOne(context.TODO(), bson.M{"email": loginReq.Email}).Decode(&user)
+	user, err := h.Users.FindByEmail(ctx, normalizeEmail(loginReq.Email))
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		respondError(c, http.StatusUnauthorized, "Invalid credentials")
 		return
 	}
 
 	if !utils.CheckPasswordHash(loginReq.Password, user.Password) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		respondError(c, http.StatusUnauthorized, "Invalid credentials")
 		return
 	}
 
-	token, err := utils.GenerateJWT(user.ID.Hex(), user.Role)
+	clinicID := ""
+	if len(user.ClinicIDs) > 0 {
+		clinicID = user.ClinicIDs[0].Hex()
+	}
+	if loginReq.ClinicID != "" {
+		if err := h.checkClinicAccess(ctx, user, loginReq.ClinicID); err != nil {
+			fail(c, err)
+			return
+		}
+		clinicID = loginReq.ClinicID
+	}
+
+	token, err := h.Keys.GenerateJWT(user.ID.Hex(), user.Role, clinicID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		fail(c, apierror.Internal("Could not generate token", err))
 		return
 	}
 
@@ -107,74 +192,220 @@ func (h *Handler) Login(c *gin.Context) {
 
 // GetCurrentUser retrieves the profile of the currently authenticated user.
 func (h *Handler) GetCurrentUser(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	// Get userID from the context (set by auth middleware)
 	userIDHex, exists := c.Get("userID")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		respondError(c, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
 
 	userID, err := primitive.ObjectIDFromHex(userIDHex.(string))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		respondError(c, http.StatusUnauthorized, "Invalid user ID in token")
 		return
 	}
 
-	var user models.User
-	collection := h.DB.Collection("users")
-	err = collection.FindOne(context.TODO(), bson.M{"_id": userID}).Decode(&user)
+	user, err := h.Users.FindByID(ctx, userID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		respondError(c, http.StatusNotFound, "User not found")
 		return
 	}
 
 	c.JSON(http.StatusOK, user)
 }
 
-// UpdateCurrentUser allows a user to update their own profile (e.g., full name).
+// UpdateProfileRequest lists the profile fields a user may change. Omitted
+// fields are left untouched; an empty string clears an optional field.
+type UpdateProfileRequest struct {
+	FullName          *string                  `json:"fullName"`
+	Email             *string                  `json:"email" binding:"omitempty,email"`
+	Phone             *string                  `json:"phone"`
+	DateOfBirth       *string                  `json:"dateOfBirth"` // YYYY-MM-DD
+	Gender            *string                  `json:"gender"`
+	Address           *models.Address          `json:"address"`
+	EmergencyContact  *models.EmergencyContact `json:"emergencyContact"`
+	PreferredLanguage *string                  `json:"preferredLanguage"`
+	PreferredChannel  *string                  `json:"preferredChannel"`
+}
+
+// UpdateCurrentUser allows a user to update their own profile. Changing the
+// email or phone resets its verification and sends a new token or code.
 func (h *Handler) UpdateCurrentUser(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	userIDHex, _ := c.Get("userID")
 	userID, _ := primitive.ObjectIDFromHex(userIDHex.(string))
 
-	// Define a struct for the update request to control what can be changed
-	var req struct {
-		FullName string `json:"fullName"`
-		// Add other updatable fields here, e.g., Email string `json:"email"`
+	var req UpdateProfileRequest
+	if !bindJSON(c, &req) {
+		return
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+	user, err := h.Users.FindByID(ctx, userID)
+	if err != nil {
+		respondError(c, http.StatusNotFound, "User not found")
 		return
 	}
+	before := *user
+
+	changed := false
 
-	// Create the update document for MongoDB
-	update := bson.M{
-		"$set": bson.M{},
+	if req.FullName != nil {
+		name := strings.TrimSpace(*req.FullName)
+		if name == "" {
+			fail(c, apierror.Invalid("fullName", "required", "cannot be empty"))
+			return
+		}
+		user.FullName = name
+		changed = true
 	}
 
-	// Only add fields to the update if they were provided in the request
-	if req.FullName != "" {
-		update["$set"].(bson.M)["fullName"] = req.FullName
+	emailChanged := false
+	if req.Email != nil {
+		email := normalizeEmail(*req.Email)
+		if email == "" {
+			fail(c, apierror.Invalid("email", "required", "cannot be empty"))
+			return
+		}
+		if email != user.Email {
+			taken, err := h.Users.EmailTaken(ctx, email, userID)
+			if err != nil {
+				fail(c, apierror.Internal("Failed to update user profile", err))
+				return
+			}
+			if taken {
+				respondError(c, http.StatusConflict, "An account with this email already exists")
+				return
+			}
+			user.Email = email
+			user.EmailVerified = false
+			emailChanged = true
+		}
+		changed = true
 	}
 
-	// If nothing to update, return
-	if len(update["$set"].(bson.M)) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No update fields provided"})
-		return
+	phoneChanged := false
+	if req.Phone != nil {
+		phone, err := utils.NormalizePhone(*req.Phone, h.DefaultPhoneCountry)
+		if err != nil {
+			fail(c, apierror.Invalid("phone", "invalid_format", "must be a valid phone number"))
+			return
+		}
+		if phone != user.Phone {
+			taken, err := h.Users.PhoneTaken(ctx, phone, userID)
+			if err != nil {
+				fail(c, apierror.Internal("Failed to update user profile", err))
+				return
+			}
+			if taken {
+				respondError(c, http.StatusConflict, "An account with this phone number already exists")
+				return
+			}
+			user.Phone = phone
+			user.PhoneVerified = false
+			phoneChanged = true
+		}
+		changed = true
 	}
 
-	collection := h.DB.Collection("users")
-	result, err := collection.UpdateOne(context.TODO(), bson.M{"_id": userID}, update)
+	if req.DateOfBirth != nil {
+		if *req.DateOfBirth == "" {
+			user.DateOfBirth = nil
+		} else {
+			dob, err := time.Parse("2006-01-02", *req.DateOfBirth)
+			if err != nil || dob.After(time.Now()) {
+				fail(c, apierror.Invalid("dateOfBirth", "invalid_format", "must be a past date in YYYY-MM-DD format"))
+				return
+			}
+			user.DateOfBirth = &dob
+		}
+		changed = true
+	}
 
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user profile"})
+	if req.Gender != nil {
+		if *req.Gender != "" && !slices.Contains(models.Genders, *req.Gender) {
+			fail(c, apierror.Invalid("gender", "oneof", "must be one of: "+strings.Join(models.Genders, ", ")))
+			return
+		}
+		user.Gender = *req.Gender
+		changed = true
+	}
+	if req.PreferredLanguage != nil {
+		if *req.PreferredLanguage != "" && !slices.Contains(models.PreferredLanguages, *req.PreferredLanguage) {
+			fail(c, apierror.Invalid("preferredLanguage", "oneof", "must be one of: "+strings.Join(models.PreferredLanguages, ", ")))
+			return
+		}
+		user.PreferredLanguage = *req.PreferredLanguage
+		changed = true
+	}
+	if req.PreferredChannel != nil {
+		if *req.PreferredChannel != "" && !slices.Contains(models.PreferredChannels, *req.PreferredChannel) {
+			fail(c, apierror.Invalid("preferredChannel", "oneof", "must be one of: "+strings.Join(models.PreferredChannels, ", ")))
+			return
+		}
+		user.PreferredChannel = *req.PreferredChannel
+		changed = true
+	}
+
+	if req.Address != nil {
+		user.Address = req.Address
+		changed = true
+	}
+	if req.EmergencyContact != nil {
+		if req.EmergencyContact.Name == "" {
+			fail(c, apierror.Invalid("emergencyContact.name", "required", "is required"))
+			return
+		}
+		phone, err := utils.NormalizePhone(req.EmergencyContact.Phone, h.DefaultPhoneCountry)
+		if err != nil {
+			fail(c, apierror.Invalid("emergencyContact.phone", "invalid_format", "must be a valid phone number"))
+			return
+		}
+		req.EmergencyContact.Phone = phone
+		user.EmergencyContact = req.EmergencyContact
+		changed = true
+	}
+
+	// If nothing to update, return
+	if !changed {
+		respondError(c, http.StatusBadRequest, "No update fields provided")
 		return
 	}
 
-	if result.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	if err := h.Users.Update(ctx, user); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrDuplicate):
+			respondError(c, http.StatusConflict, duplicateAccountMessage(err))
+		case errors.Is(err, repository.ErrNotFound):
+			respondError(c, http.StatusNotFound, "User not found")
+		default:
+			fail(c, apierror.Internal("Failed to update user profile", err))
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Profile updated successfully"})
+	h.recordAudit(c, models.AuditUserUpdated, models.AuditTargetUser, user.ID.Hex(), &before, user)
+
+	// Re-verification goes to the new contact details
+	if emailChanged {
+		if err := h.issueEmailVerification(ctx, user); err != nil {
+			slog.ErrorContext(ctx, "failed to issue verification email", "user_id", user.ID.Hex(), "error", err)
+		}
+	}
+	if phoneChanged {
+		if err := h.issuePhoneVerification(ctx, user); err != nil {
+			slog.ErrorContext(ctx, "failed to issue phone verification", "user_id", user.ID.Hex(), "error", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Profile updated successfully", "user": user})
+}
+
+// GetJWKS publishes the public keys used to sign access tokens so other
+// services can verify them without sharing a secret.
+func (h *Handler) GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.Keys.JWKS())
 }
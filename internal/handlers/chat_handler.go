@@ -2,159 +2,331 @@
 package handlers
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/harentsoaR/dentist-api/internal/apierror"
+	"github.com/harentsoaR/dentist-api/internal/metrics"
+	"github.com/harentsoaR/dentist-api/internal/models"
+	"github.com/harentsoaR/dentist-api/internal/repository"
+	"github.com/harentsoaR/dentist-api/internal/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// --- Structures pour la requête et la réponse Gemini ---
+// clinicPrompt is the assistant's instructions. Clinic facts come from the
+// clinic's settings; a fact that is not configured is referred to the clinic
+// rather than left for the model to invent.
+func clinicPrompt(clinic *models.Clinic) string {
+	settings := &clinic.Settings
+	unknown := "please contact the clinic directly"
 
-// GeminiRequestPart définit une partie d'un message.
-type GeminiRequestPart struct {
-	Text string `json:"text"`
-}
-
-// GeminiRequestContent définit un tour de conversation avec un rôle et des parties.
-type GeminiRequestContent struct {
-	Role  string              `json:"role"`
-	Parts []GeminiRequestPart `json:"parts"`
-}
-
-// GeminiRequestBody est la structure principale du corps de la requête.
-type GeminiRequestBody struct {
-	Contents []GeminiRequestContent `json:"contents"`
-}
-
-// --- Structures pour parser la réponse de Gemini ---
+	address := unknown
+	if settings.Address != nil && settings.Address.String() != "" {
+		address = settings.Address.String()
+	}
+	hours := unknown
+	if len(settings.OpeningHours) > 0 {
+		hours = settings.DescribeOpeningHours() + " (" + settings.Location().String() + " time)"
+	}
+	var contact []string
+	if settings.Contact.Phone != "" {
+		contact = append(contact, "phone "+settings.Contact.Phone)
+	}
+	if settings.Contact.Email != "" {
+		contact = append(contact, "email "+settings.Contact.Email)
+	}
+	if settings.Contact.Website != "" {
+		contact = append(contact, "website "+settings.Contact.Website)
+	}
+	contactLine := unknown
+	if len(contact) > 0 {
+		contactLine = strings.Join(contact, ", ")
+	}
+	services := unknown
+	if len(settings.Services) > 0 {
+		services = settings.DescribeServices()
+	}
+	cancellation := unknown
+	switch policy := settings.CancellationPolicy; {
+	case policy.Description != "":
+		cancellation = policy.Description
+	case policy.MinNoticeHours > 0:
+		cancellation = fmt.Sprintf("appointments must be cancelled at least %d hours in advance", policy.MinNoticeHours)
+	}
 
-// GeminiResponsePart définit une partie de la réponse.
-type GeminiResponsePart struct {
-	Text string `json:"text"`
+	return fmt.Sprintf(`You are a helpful and friendly assistant for the '%s' dental clinic. You must follow these rules:
+1. Your knowledge base is strictly limited to the services, prices and clinic facts below.
+2. Answer questions politely based ONLY on this information.
+3. If asked about anything else (e.g., medical advice), you MUST respond with: "I can only provide information on our services, prices and the clinic. For any other questions, please contact the clinic directly."
+4. Do not make up services, prices or clinic facts. Quote prices exactly as listed, in the listed currency.
+5. You should be able to speak in all languages including Malagasy.
+Clinic facts:
+- Services and prices: %s
+- Address: %s
+- Opening hours: %s
+- Contact: %s
+- Cancellation policy: %s`, clinic.Name, services, address, hours, contactLine, cancellation)
 }
 
-// GeminiResponseCandidate contient une réponse potentielle du modèle.
-type GeminiResponseCandidate struct {
-	Content struct {
-		Parts []GeminiResponsePart `json:"parts"`
-		Role  string               `json:"role"`
-	} `json:"content"`
-}
+// MaxConversationMessages caps what a conversation keeps; older messages
+// are dropped as new ones arrive.
+const MaxConversationMessages = 200
 
-// GeminiResponseBody est la structure principale de la réponse de l'API.
-type GeminiResponseBody struct {
-	Candidates []GeminiResponseCandidate `json:"candidates"`
-}
+// conversationTitleLength is how many characters of the opening question
+// title a conversation.
+const conversationTitleLength = 80
 
-// HandleChat gère les requêtes de chat en communiquant manuellement avec l'API Gemini.
+// HandleChat répond aux questions des patients avec le modèle configuré.
+// Without conversationId the question starts a new conversation; with it,
+// the latest messages of that conversation are sent along so follow-up
+// questions make sense.
 func (h *Handler) HandleChat(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	// 1. Lire le message de l'utilisateur depuis la requête entrante.
-	// Nous attendons un format simple : {"message": "votre question ici"}
+	// Nous attendons : {"message": "votre question ici", "conversationId": "..."}
 	var req struct {
-		Message string `json:"message"`
+		Message        string `json:"message" binding:"max=4000"`
+		ConversationID string `json:"conversationId"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Message) == "" {
+		fail(c, apierror.Invalid("message", "required", "cannot be empty"))
+		return
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format, expecting {\"message\": \"...\"}"})
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		respondError(c, http.StatusUnauthorized, "Invalid user ID in token")
 		return
 	}
-	if req.Message == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Message cannot be empty"})
+	if h.ChatModel == nil {
+		respondError(c, http.StatusServiceUnavailable, "The assistant is not configured")
 		return
 	}
 
-	// 2. Construire l'URL et le corps de la requête pour l'API Gemini.
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	// On utilise l'URL et le modèle que vous avez confirmés comme fonctionnels.
-	url := "https://generativelanguage.googleapis.com/v1beta/models/gemini-1.5-flash:generateContent?key=" + apiKey
+	// 2. Retrouver la conversation, s'il y en a une.
+	var conv *models.Conversation
+	if req.ConversationID != "" {
+		id, err := primitive.ObjectIDFromHex(req.ConversationID)
+		if err != nil {
+			fail(c, apierror.Invalid("conversationId", "invalid_format", "must be a valid ID"))
+			return
+		}
+		if conv, err = h.Conversations.FindByID(ctx, id, userID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				respondError(c, http.StatusNotFound, "Conversation not found")
+				return
+			}
+			fail(c, err)
+			return
+		}
+	}
 
-	// Définition du "System Prompt" : les instructions et la personnalité du chatbot.
-	systemPrompt := `You are a helpful and friendly assistant for the 'DentistFlow' dental clinic. You must follow these rules:
-1. Your knowledge base is strictly limited to the following services and prices:
-   - Standard Check-up: $75, Teeth Cleaning: $120, X-Ray: $50, Filling: $150-$300, Whitening: $400.
-2. Answer questions politely based ONLY on this information.
-3. If asked about anything else (e.g., opening hours, medical advice), you MUST respond with: "I can only provide information on our services and prices. For any other questions, please contact the clinic directly."
-4. Do not make up services or prices.
-5.You should be able to speak in all languages including Malagasy and automatically convert the price too accordin to the language of the user
-6.If the user asks about the clinic's location, you must respond with: "Our clinic is located at 123 Main St, Anytown, USA. You can find us on Google Maps.
-7.If the user asks about the clinic's opening hours, you must respond with: "Our clinic is open from 9:00 AM to 5:00 PM, Monday to Friday.apiKey.
-8.If the user asks about the clinic's email, you must respond with: "Our clinic's email is rakotonarivomegane@gmail.com.`
-
-	// Création du corps de la requête avec les instructions et la question de l'utilisateur.
-	requestBody := GeminiRequestBody{
-		Contents: []GeminiRequestContent{
-			{
-				Role:  "user", // Rôle "user" pour donner les instructions.
-				Parts: []GeminiRequestPart{{Text: systemPrompt}},
-			},
-			{
-				Role:  "model", // Rôle "model" pour simuler la confirmation des instructions.
-				Parts: []GeminiRequestPart{{Text: "Understood. I will strictly follow these rules and only answer questions based on the provided service list."}},
-			},
-			{
-				Role:  "user", // Rôle "user" pour la question réelle de l'utilisateur.
-				Parts: []GeminiRequestPart{{Text: req.Message}},
-			},
-		},
-	}
-
-	// Conversion de la structure Go en JSON.
-	jsonBody, err := json.Marshal(requestBody)
+	// 3. Le "System Prompt" est construit à partir des réglages de la clinique.
+	clinic, err := h.currentClinic(ctx)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create request body"})
+		fail(c, err)
 		return
 	}
+	chatReq := services.ChatRequest{System: clinicPrompt(clinic)}
+	if conv != nil {
+		history := conv.Messages[max(0, len(conv.Messages)-h.ChatHistory):]
+		// Gemini refuses a history that opens on the model's turn, and the
+		// others lose the question it answered; an odd window starts there
+		for len(history) > 0 && history[0].Role != models.ChatRoleUser {
+			history = history[1:]
+		}
+		for _, msg := range history {
+			chatReq.Messages = append(chatReq.Messages, services.ChatMessage{Role: msg.Role, Text: msg.Text})
+		}
+	}
+	chatReq.Messages = append(chatReq.Messages, services.ChatMessage{Role: services.ChatRoleUser, Text: req.Message})
+
+	// 4. Interroger le modèle. The request context carries the chat deadline
+	// and is cancelled if the client disconnects.
+	asked := time.Now().UTC()
+	reply, err := h.ChatModel.Generate(ctx, chatReq)
+	if err != nil {
+		metrics.ChatUpstreamDuration.WithLabelValues("failure").Observe(time.Since(asked).Seconds())
+		fail(c, chatError(err))
+		return
+	}
+	metrics.ChatUpstreamDuration.WithLabelValues("success").Observe(time.Since(asked).Seconds())
+	metrics.ChatTokens.WithLabelValues("prompt").Add(float64(reply.InputTokens))
+	metrics.ChatTokens.WithLabelValues("completion").Add(float64(reply.OutputTokens))
 
-	// 3. Créer et envoyer la requête HTTP POST.
-	httpReq, err := http.NewRequestWithContext(context.Background(), "POST", url, bytes.NewBuffer(jsonBody))
+	// 5. Enregistrer l'échange. Only answered questions are kept, so a
+	// failed call can simply be retried.
+	exchange := []models.ChatMessage{
+		{Role: models.ChatRoleUser, Text: req.Message, At: asked},
+		{Role: models.ChatRoleAssistant, Text: reply.Text, At: time.Now().UTC()},
+	}
+	if conv == nil {
+		conv = &models.Conversation{
+			ID:        primitive.NewObjectID(),
+			UserID:    userID,
+			Title:     conversationTitle(req.Message),
+			Messages:  exchange,
+			CreatedAt: asked,
+			UpdatedAt: asked,
+		}
+		err = h.Conversations.Create(ctx, conv)
+	} else {
+		err = h.Conversations.Append(ctx, conv.ID, userID, exchange, MaxConversationMessages)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create HTTP request"})
+		fail(c, err)
 		return
 	}
-	httpReq.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	httpResp, err := client.Do(httpReq)
+	// 6. Renvoyer la réponse à notre frontend.
+	c.JSON(http.StatusOK, gin.H{
+		"success":        true,
+		"message":        reply.Text,
+		"conversationId": conv.ID.Hex(),
+	})
+}
+
+// conversationTitle shortens the opening question to a one-line title.
+func conversationTitle(question string) string {
+	title := strings.Join(strings.Fields(question), " ")
+	if runes := []rune(title); len(runes) > conversationTitleLength {
+		title = strings.TrimSpace(string(runes[:conversationTitleLength-1])) + "…"
+	}
+	return title
+}
+
+// chatError maps a failed model call to the problem returned to the client.
+// The provider's details stay in the logs.
+func chatError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return err // Answered 504 like any other deadline
+	}
+	message := "AI service returned an error"
+	if errors.Is(err, services.ErrEmptyReply) {
+		message = "AI returned an empty or invalid response"
+	}
+	return &apierror.Error{Status: http.StatusInternalServerError, Code: apierror.CodeUpstream, Message: message, Cause: err}
+}
+
+// PingChat checks that the AI provider answers with our credentials, for
+// the readiness probe.
+func (h *Handler) PingChat(ctx context.Context) error {
+	if h.ChatModel == nil {
+		return errors.New("no chat model is configured")
+	}
+	if err := h.ChatModel.Ping(ctx); err != nil {
+		return fmt.Errorf("%s: %w", h.ChatModel.Provider(), err)
+	}
+	return nil
+}
+
+// --- CONVERSATIONS ---
+
+// ConversationSummary is a conversation as listed, without its messages.
+type ConversationSummary struct {
+	ID           primitive.ObjectID `json:"id"`
+	Title        string             `json:"title"`
+	MessageCount int                `json:"messageCount"`
+	CreatedAt    time.Time          `json:"createdAt"`
+	UpdatedAt    time.Time          `json:"updatedAt"`
+}
+
+// GetConversations lists the caller's conversations in the current clinic,
+// most recently active first (?limit=, default DefaultPageSize).
+func (h *Handler) GetConversations(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send request to AI service"})
+		respondError(c, http.StatusUnauthorized, "Invalid user ID in token")
 		return
 	}
-	defer httpResp.Body.Close()
+	limit := int64(DefaultPageSize)
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 1 || n > MaxPageSize {
+			fail(c, apierror.Invalid("limit", "out_of_range", fmt.Sprintf("must be between 1 and %d", MaxPageSize)))
+			return
+		}
+		limit = n
+	}
 
-	// 4. Lire et parser la réponse de Gemini.
-	respBody, err := io.ReadAll(httpResp.Body)
+	conversations, err := h.Conversations.List(ctx, userID, limit)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read AI response"})
+		fail(c, err)
 		return
 	}
+	summaries := make([]ConversationSummary, len(conversations))
+	for i, conv := range conversations {
+		summaries[i] = ConversationSummary{
+			ID:           conv.ID,
+			Title:        conv.Title,
+			MessageCount: len(conv.Messages),
+			CreatedAt:    conv.CreatedAt,
+			UpdatedAt:    conv.UpdatedAt,
+		}
+	}
+	c.JSON(http.StatusOK, summaries)
+}
 
-	// Vérifier les codes d'erreur HTTP (ex: 400, 401, etc.).
-	if httpResp.StatusCode != http.StatusOK {
-		// Afficher l'erreur brute de Gemini dans la console du serveur pour le débogage.
-		fmt.Printf("[DEBUG] Gemini Error Response: %s\n", string(respBody))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "AI service returned an error"})
+// GetConversation returns one of the caller's conversations with its messages.
+func (h *Handler) GetConversation(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		respondError(c, http.StatusUnauthorized, "Invalid user ID in token")
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid conversation ID")
 		return
 	}
 
-	var geminiResp GeminiResponseBody
-	if err := json.Unmarshal(respBody, &geminiResp); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse AI response"})
+	conv, err := h.Conversations.FindByID(ctx, id, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			respondError(c, http.StatusNotFound, "Conversation not found")
+			return
+		}
+		fail(c, err)
 		return
 	}
+	c.JSON(http.StatusOK, conv)
+}
+
+// DeleteConversation removes one of the caller's conversations for good.
+func (h *Handler) DeleteConversation(c *gin.Context) {
+	ctx := c.Request.Context()
 
-	// 5. Extraire le message de la réponse et le renvoyer à notre frontend.
-	if len(geminiResp.Candidates) > 0 && len(geminiResp.Candidates[0].Content.Parts) > 0 {
-		c.JSON(http.StatusOK, gin.H{
-			"success": true,
-			"message": geminiResp.Candidates[0].Content.Parts[0].Text,
-		})
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		respondError(c, http.StatusUnauthorized, "Invalid user ID in token")
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid conversation ID")
 		return
 	}
 
-	// Message de secours si la réponse est vide ou mal formée.
-	c.JSON(http.StatusInternalServerError, gin.H{"error": "AI returned an empty or invalid response"})
+	if err := h.Conversations.Delete(ctx, id, userID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			respondError(c, http.StatusNotFound, "Conversation not found")
+			return
+		}
+		fail(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
 }
@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harentsoaR/dentist-api/internal/apierror"
+	"github.com/harentsoaR/dentist-api/internal/models"
+	"github.com/harentsoaR/dentist-api/internal/repository"
+	"github.com/harentsoaR/dentist-api/internal/tenant"
+	"github.com/harentsoaR/dentist-api/internal/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Each access token acts for one clinic (see package tenant). Users pick it
+// at login and swap tokens to switch; admins run every clinic and may act
+// for any of them.
+
+// checkClinicAccess reports whether user may act for the clinic.
+func (h *Handler) checkClinicAccess(ctx context.Context, user *models.User, clinicIDHex string) error {
+	clinicID, err := primitive.ObjectIDFromHex(clinicIDHex)
+	if err != nil {
+		return apierror.Invalid("clinicId", "invalid_format", "must be a clinic ID")
+	}
+	if user.InClinic(clinicID) {
+		return nil
+	}
+	if user.Role == "admin" {
+		if _, err := h.Clinics.FindByID(ctx, clinicID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return apierror.New(http.StatusNotFound, "", "Clinic not found")
+			}
+			return err
+		}
+		return nil
+	}
+	return apierror.New(http.StatusForbidden, "", "You do not belong to this clinic")
+}
+
+// --- LIST MY CLINICS ---
+func (h *Handler) GetClinics(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("userID"))
+	user, err := h.Users.FindByID(ctx, userID)
+	if err != nil {
+		respondError(c, http.StatusNotFound, "User not found")
+		return
+	}
+
+	var clinics []models.Clinic
+	switch {
+	case user.Role == "admin":
+		clinics, err = h.Clinics.List(ctx)
+	case len(user.ClinicIDs) == 0:
+		clinics = []models.Clinic{}
+	default:
+		clinics, err = h.Clinics.List(ctx, user.ClinicIDs...)
+	}
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, clinics)
+}
+
+// --- SWITCH CLINIC ---
+
+// SwitchClinic answers with a new token acting for another of the caller's
+// clinics. The old token stays valid until it expires.
+func (h *Handler) SwitchClinic(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("userID"))
+	user, err := h.Users.FindByID(ctx, userID)
+	if err != nil {
+		respondError(c, http.StatusNotFound, "User not found")
+		return
+	}
+	if err := h.checkClinicAccess(ctx, user, c.Param("id")); err != nil {
+		fail(c, err)
+		return
+	}
+
+	token, err := h.Keys.GenerateJWT(user.ID.Hex(), user.Role, c.Param("id"))
+	if err != nil {
+		fail(c, apierror.Internal("Could not generate token", err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"token": token, "clinicId": c.Param("id")})
+}
+
+// --- CREATE CLINIC (Admin Only) ---
+func (h *Handler) CreateClinic(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userRole, _ := c.Get("userRole")
+	if userRole != "admin" {
+		respondError(c, http.StatusForbidden, "Permission denied.")
+		return
+	}
+
+	var req struct {
+		Name string `json:"name" binding:"required,max=200"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		fail(c, apierror.Invalid("name", "required", "cannot be empty"))
+		return
+	}
+
+	clinic := models.Clinic{ID: primitive.NewObjectID(), Name: name, CreatedAt: time.Now().UTC()}
+	if err := h.Clinics.Create(ctx, &clinic); err != nil {
+		fail(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, clinic)
+}
+
+// --- ADD CLINIC MEMBER (Admin Only) ---
+
+// AddClinicMember lets a user act for one more clinic, typically a dentist
+// who also works at another branch.
+func (h *Handler) AddClinicMember(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userRole, _ := c.Get("userRole")
+	if userRole != "admin" {
+		respondError(c, http.StatusForbidden, "Permission denied.")
+		return
+	}
+
+	clinicID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid clinic ID")
+		return
+	}
+	userID, err := primitive.ObjectIDFromHex(c.Param("userId"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	if _, err := h.Clinics.FindByID(ctx, clinicID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			respondError(c, http.StatusNotFound, "Clinic not found")
+			return
+		}
+		fail(c, err)
+		return
+	}
+
+	var user *models.User
+	before, err := h.Users.FindByID(ctx, userID)
+	if err == nil {
+		user, err = h.Users.AddClinic(ctx, userID, clinicID)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			respondError(c, http.StatusNotFound, "User not found")
+			return
+		}
+		fail(c, err)
+		return
+	}
+	h.recordAudit(c, models.AuditUserUpdated, models.AuditTargetUser, userID.Hex(), before, user)
+
+	c.JSON(http.StatusOK, user)
+}
+
+// currentClinic loads the clinic the request acts for.
+func (h *Handler) currentClinic(ctx context.Context) (*models.Clinic, error) {
+	clinicID, ok := tenant.ClinicID(ctx)
+	if !ok {
+		return nil, tenant.ErrNoClinic
+	}
+	return h.Clinics.FindByID(ctx, clinicID)
+}
+
+// --- GET CURRENT CLINIC ---
+
+// GetCurrentClinic answers with the clinic of the caller's token and its
+// settings, for the opening hours, address and contact details.
+func (h *Handler) GetCurrentClinic(c *gin.Context) {
+	clinic, err := h.currentClinic(c.Request.Context())
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, clinic)
+}
+
+// UpdateClinicSettingsRequest replaces a clinic's name and settings as a whole.
+type UpdateClinicSettingsRequest struct {
+	Name         string                `json:"name" binding:"required,max=200"`
+	Address      *models.Address       `json:"address"`
+	TimeZone     string                `json:"timeZone"`
+	OpeningHours []models.OpeningHours `json:"openingHours"`
+	Contact      struct {
+		Email   string `json:"email" binding:"omitempty,email"`
+		Phone   string `json:"phone"`
+		Website string `json:"website"`
+	} `json:"contact"`
+	Currency           string                    `json:"currency"`
+	Services           []models.ClinicService    `json:"services"` // Priced in Currency
+	CancellationPolicy models.CancellationPolicy `json:"cancellationPolicy"`
+}
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// --- UPDATE CLINIC SETTINGS (Admin Only) ---
+func (h *Handler) UpdateClinicSettings(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userRole, _ := c.Get("userRole")
+	if userRole != "admin" {
+		respondError(c, http.StatusForbidden, "Permission denied.")
+		return
+	}
+
+	clinicID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid clinic ID")
+		return
+	}
+
+	var req UpdateClinicSettingsRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	var v apierror.Validation
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		v.Add("name", "required", "cannot be empty")
+	}
+	if req.TimeZone != "" {
+		if _, err := time.LoadLocation(req.TimeZone); err != nil {
+			v.Add("timeZone", "invalid_format", "must be an IANA time zone, e.g. Indian/Antananarivo")
+		}
+	}
+	for i, oh := range req.OpeningHours {
+		field := fmt.Sprintf("openingHours[%d]", i)
+		if !slices.Contains(models.Weekdays, oh.Day) {
+			v.Add(field+".day", "oneof", "must be one of: "+strings.Join(models.Weekdays, ", "))
+		}
+		opening, errOpen := models.ParseClock(oh.Open)
+		if errOpen != nil {
+			v.Add(field+".open", "invalid_format", "must be an HH:MM time")
+		}
+		closing, errClose := models.ParseClock(oh.Close)
+		if errClose != nil {
+			v.Add(field+".close", "invalid_format", "must be an HH:MM time")
+		}
+		if errOpen == nil && errClose == nil && closing <= opening {
+			v.Add(field+".close", "out_of_range", "must be after open")
+		}
+	}
+	if req.Contact.Phone != "" {
+		phone, err := utils.NormalizePhone(req.Contact.Phone, h.DefaultPhoneCountry)
+		if err != nil {
+			v.Add("contact.phone", "invalid_format", "must be a valid phone number")
+		}
+		req.Contact.Phone = phone
+	}
+	if req.Contact.Website != "" {
+		if u, err := url.Parse(req.Contact.Website); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			v.Add("contact.website", "invalid_format", "must be an http(s) URL")
+		}
+	}
+	if req.Currency != "" && !currencyCode.MatchString(req.Currency) {
+		v.Add("currency", "invalid_format", "must be an ISO 4217 code, e.g. MGA")
+	}
+	if len(req.Services) > 0 && req.Currency == "" {
+		v.Add("currency", "required", "is required to price services")
+	}
+	seen := map[string]bool{}
+	for i, svc := range req.Services {
+		field := fmt.Sprintf("services[%d]", i)
+		req.Services[i].Name = strings.TrimSpace(svc.Name)
+		key := strings.ToLower(req.Services[i].Name)
+		switch {
+		case key == "":
+			v.Add(field+".name", "required", "cannot be empty")
+		case seen[key]:
+			v.Add(field+".name", "duplicate", "is listed twice")
+		}
+		seen[key] = true
+		if svc.Price < 0 {
+			v.Add(field+".price", "min", "must be at least 0")
+		}
+		if svc.MaxPrice != 0 && svc.MaxPrice <= svc.Price {
+			v.Add(field+".maxPrice", "out_of_range", "must be above price, or 0 for a fixed price")
+		}
+	}
+	if req.CancellationPolicy.MinNoticeHours < 0 {
+		v.Add("cancellationPolicy.minNoticeHours", "min", "must be at least 0")
+	}
+	if err := v.Err(); err != nil {
+		fail(c, err)
+		return
+	}
+
+	clinic, err := h.Clinics.FindByID(ctx, clinicID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			respondError(c, http.StatusNotFound, "Clinic not found")
+			return
+		}
+		fail(c, err)
+		return
+	}
+	before := *clinic
+
+	now := time.Now().UTC()
+	clinic.Name = name
+	clinic.Settings = models.ClinicSettings{
+		Address:      req.Address,
+		TimeZone:     req.TimeZone,
+		OpeningHours: req.OpeningHours,
+		Contact: models.ContactInfo{
+			Email:   normalizeEmail(req.Contact.Email),
+			Phone:   req.Contact.Phone,
+			Website: req.Contact.Website,
+		},
+		Currency:           req.Currency,
+		Services:           req.Services,
+		CancellationPolicy: req.CancellationPolicy,
+		UpdatedAt:          &now,
+	}
+	if err := h.Clinics.Update(ctx, clinic); err != nil {
+		fail(c, err)
+		return
+	}
+	h.recordAudit(c, models.AuditClinicUpdated, models.AuditTargetClinic, clinicID.Hex(), &before, clinic)
+
+	c.JSON(http.StatusOK, clinic)
+}
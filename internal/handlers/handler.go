@@ -1,28 +1,112 @@
 package handlers
 
 import (
-	"github.com/harentsoaR/dentist-api/internal/services" // <-- Import the new service
-	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harentsoaR/dentist-api/internal/apierror"
+	"github.com/harentsoaR/dentist-api/internal/health"
+	"github.com/harentsoaR/dentist-api/internal/ratelimit"
+	"github.com/harentsoaR/dentist-api/internal/repository"
+	"github.com/harentsoaR/dentist-api/internal/services"
+	"github.com/harentsoaR/dentist-api/internal/utils"
+)
+
+// Default per-request deadlines, overridable on the Handler.
+const (
+	DefaultRequestTimeout = 15 * time.Second
+	DefaultChatTimeout    = 45 * time.Second
+	DefaultProbeTimeout   = 3 * time.Second
+	// DefaultIdempotencyTTL is how long a response is replayed for retries.
+	DefaultIdempotencyTTL = 24 * time.Hour
+	// DefaultChatHistory is how many earlier messages of a conversation are
+	// sent to the model with each question.
+	DefaultChatHistory = 20
 )
 
-// STEP 1: Add NotificationSvc to the Handler struct.
-// Now your "toolbox" has a slot for the notification service.
+// Handler is the "toolbox" every route method hangs off: storage, the
+// notification service and the token keys.
 type Handler struct {
-	DB              *mongo.Database
-	NotificationSvc *services.NotificationService // <-- THIS IS THE NEW FIELD
+	Users           repository.UserRepository
+	Clinics         repository.ClinicRepository
+	Appointments    repository.AppointmentRepository
+	Tokens          repository.VerificationTokenRepository
+	Idempotency     repository.IdempotencyRepository
+	Audit           repository.AuditRepository
+	Conversations   repository.ConversationRepository
+	Notifications   repository.NotificationRepository // What NotificationSvc sent
+	NotificationSvc services.Notifier
+	Keys            *utils.KeySet // Signs and verifies access tokens
+	// Health runs the /readyz checks; main registers the dependency probes.
+	Health *health.Checker
+	// MetricsToken, when set, is the bearer token required on /metrics.
+	MetricsToken string
+	// Limiter throttles login, registration, booking, chat and contact
+	// verification; nil disables it.
+	Limiter *ratelimit.Limiter
+
+	// RequireVerifiedContact blocks booking until the patient has verified
+	// their email or phone.
+	RequireVerifiedContact bool
+	// DefaultPhoneCountry is the calling code assumed for national-format numbers.
+	DefaultPhoneCountry string
+	// ChatModel answers /api/chat; nil disables the assistant.
+	ChatModel services.ChatModel
+	// ChatHistory caps the earlier messages of a conversation sent along
+	// with a question; zero sends the question alone.
+	ChatHistory int
+
+	// RequestTimeout bounds ordinary requests; ChatTimeout bounds /api/chat,
+	// which waits on the AI provider. Zero disables the deadline.
+	RequestTimeout time.Duration
+	ChatTimeout    time.Duration
+	// IdempotencyTTL is how long a booking's response is kept for retries
+	// sent with the same Idempotency-Key.
+	IdempotencyTTL time.Duration
+	// AuditRetention is how long audit entries are kept; zero keeps them forever.
+	AuditRetention time.Duration
 }
 
-// STEP 2: Update the NewHandler function to accept the new service.
-// This is the "factory" that builds your handler.
-func NewHandler(db *mongo.Database, notificationSvc *services.NotificationService) *Handler {
-	// It now returns a Handler with BOTH the database and the notification service.
+// NewHandler is the "factory" that builds your handler from its dependencies.
+func NewHandler(repos *repository.Repositories, notificationSvc services.Notifier, keys *utils.KeySet) *Handler {
 	return &Handler{
-		DB:              db,
-		NotificationSvc: notificationSvc, // <-- ASSIGN THE SERVICE HERE
+		Users:           repos.Users,
+		Clinics:         repos.Clinics,
+		Appointments:    repos.Appointments,
+		Tokens:          repos.Tokens,
+		Idempotency:     repos.Idempotency,
+		Audit:           repos.Audit,
+		Conversations:   repos.Conversations,
+		Notifications:   repos.Notifications,
+		NotificationSvc: notificationSvc,
+		Keys:            keys,
+		Health:          health.NewChecker(DefaultProbeTimeout),
+
+		DefaultPhoneCountry: utils.DefaultCountryCode,
+		RequestTimeout:      DefaultRequestTimeout,
+		ChatTimeout:         DefaultChatTimeout,
+		ChatHistory:         DefaultChatHistory,
+		IdempotencyTTL:      DefaultIdempotencyTTL,
 	}
 }
 
-// NOTE: You should move your other handler functions (like RegisterUser, Login, etc.)
-// into their own files in this package (e.g., `user_handler.go`) but make sure they are
-// methods of this same `*Handler` struct.
-// For example: func (h *Handler) RegisterUser(c *gin.Context) { ... }
+// respondError answers with a problem body for status; the code is derived
+// from the status.
+func respondError(c *gin.Context, status int, message string) {
+	apierror.Respond(c, apierror.New(status, "", message))
+}
+
+// fail answers with the problem body err maps to (see apierror.From).
+func fail(c *gin.Context, err error) {
+	apierror.Respond(c, err)
+}
+
+// bindJSON decodes and validates the body into v, answering 400 with the
+// offending fields when it can't.
+func bindJSON(c *gin.Context, v any) bool {
+	if err := c.ShouldBindJSON(v); err != nil {
+		apierror.Respond(c, apierror.FromBinding(err))
+		return false
+	}
+	return true
+}
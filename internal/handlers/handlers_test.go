@@ -0,0 +1,2132 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/harentsoaR/dentist-api/internal/apierror"
+	"github.com/harentsoaR/dentist-api/internal/config"
+	"github.com/harentsoaR/dentist-api/internal/health"
+	"github.com/harentsoaR/dentist-api/internal/jobs"
+	"github.com/harentsoaR/dentist-api/internal/metrics"
+	"github.com/harentsoaR/dentist-api/internal/middleware"
+	"github.com/harentsoaR/dentist-api/internal/models"
+	"github.com/harentsoaR/dentist-api/internal/ratelimit"
+	"github.com/harentsoaR/dentist-api/internal/repository"
+	"github.com/harentsoaR/dentist-api/internal/services"
+	"github.com/harentsoaR/dentist-api/internal/tenant"
+	"github.com/harentsoaR/dentist-api/internal/utils"
+	"github.com/harentsoaR/dentist-api/internal/version"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const testPassword = "correct horse battery"
+
+// bcrypt at cost 14 is slow, so seeded users share one hash.
+var (
+	testPasswordHash     string
+	testPasswordHashOnce sync.Once
+)
+
+// seededPhones numbers seeded users, whose phones must be unique.
+var seededPhones atomic.Int64
+
+// recordingNotifier captures what would have been sent to patients. Like any
+// Notifier it is handed every confirmation; deciding whether a patient gets
+// the SMS is the real service's job (see TestAppointmentConfirmationSMS).
+type recordingNotifier struct {
+	mu            sync.Mutex
+	confirmations []models.Appointment
+	messages      []string
+	emailTokens   map[primitive.ObjectID]string
+	phoneCodes    map[primitive.ObjectID]string
+}
+
+func newRecordingNotifier() *recordingNotifier {
+	return &recordingNotifier{
+		emailTokens: map[primitive.ObjectID]string{},
+		phoneCodes:  map[primitive.ObjectID]string{},
+	}
+}
+
+func (n *recordingNotifier) SendAppointmentConfirmationSMS(_ context.Context, patient *models.User, apt *models.Appointment, clinic *models.Clinic) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.confirmations = append(n.confirmations, *apt)
+	n.messages = append(n.messages, services.AppointmentSMS(patient, apt, clinic))
+}
+
+func (n *recordingNotifier) SendEmailVerification(_ context.Context, user *models.User, token string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.emailTokens[user.ID] = token
+}
+
+func (n *recordingNotifier) SendPhoneVerificationCode(_ context.Context, user *models.User, code string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.phoneCodes[user.ID] = code
+}
+
+type testEnv struct {
+	t        *testing.T
+	h        *Handler
+	repos    *repository.Repositories
+	notifier *recordingNotifier
+	chat     *services.FakeChatModel
+	router   *gin.Engine
+	// clinic is where seeded users and appointments live; ctx is scoped to it
+	clinic *models.Clinic
+	ctx    context.Context
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := utils.NewKeySet("dentist-api-test", "dentist-app", time.Hour)
+	if err := keys.AddKey("test", priv); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.SetActive("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	repos := repository.NewMemoryRepositories()
+	clinic := &models.Clinic{ID: primitive.NewObjectID(), Name: "Analakely", CreatedAt: time.Now()}
+	if err := repos.Clinics.Create(context.Background(), clinic); err != nil {
+		t.Fatal(err)
+	}
+	notifier := newRecordingNotifier()
+	h := NewHandler(repos, notifier, keys)
+	chat := services.NewFakeChatModel()
+	h.ChatModel = chat
+
+	router := gin.New()
+	router.SetTrustedProxies(nil) // As in production without a load balancer
+	router.Use(middleware.RequestID(), middleware.Metrics())
+	h.RegisterRoutes(router)
+
+	return &testEnv{
+		t: t, h: h, repos: repos, notifier: notifier, chat: chat, router: router,
+		clinic: clinic, ctx: tenant.WithClinic(context.Background(), clinic.ID),
+	}
+}
+
+// do sends a JSON request through the router. body may be nil.
+func (e *testEnv) do(method, path string, body any, token string) *httptest.ResponseRecorder {
+	e.t.Helper()
+	return e.doWith(method, path, body, token, nil)
+}
+
+// doWith is do with extra request headers.
+func (e *testEnv) doWith(method, path string, body any, token string, header http.Header) *httptest.ResponseRecorder {
+	e.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			e.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	e.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// seedUser stores a user with the given role and returns it with a valid token.
+func (e *testEnv) seedUser(role string, mutate ...func(*models.User)) (*models.User, string) {
+	e.t.Helper()
+	testPasswordHashOnce.Do(func() {
+		hash, err := utils.HashPassword(testPassword)
+		if err != nil {
+			e.t.Fatal(err)
+		}
+		testPasswordHash = hash
+	})
+
+	id := primitive.NewObjectID()
+	user := &models.User{
+		ID:        id,
+		FullName:  "User " + id.Hex()[18:],
+		Email:     id.Hex() + "@example.com",
+		Password:  testPasswordHash,
+		Role:      role,
+		Phone:     fmt.Sprintf("+26133%07d", seededPhones.Add(1)),
+		ClinicIDs: []primitive.ObjectID{e.clinic.ID},
+	}
+	for _, m := range mutate {
+		m(user)
+	}
+	if err := e.repos.Users.Create(context.Background(), user); err != nil {
+		e.t.Fatal(err)
+	}
+	clinicID := ""
+	if len(user.ClinicIDs) > 0 {
+		clinicID = user.ClinicIDs[0].Hex()
+	}
+	token, err := e.h.Keys.GenerateJWT(user.ID.Hex(), role, clinicID)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return user, token
+}
+
+func (e *testEnv) seedAppointment(patient *models.User, start time.Time, status string) *models.Appointment {
+	e.t.Helper()
+	apt := &models.Appointment{
+		ID:          primitive.NewObjectID(),
+		PatientID:   patient.ID,
+		PatientName: patient.FullName,
+		StartTime:   start,
+		EndTime:     start.Add(30 * time.Minute),
+		Service:     "Teeth Cleaning",
+		Status:      status,
+	}
+	if err := e.repos.Appointments.Create(e.ctx, apt); err != nil {
+		e.t.Fatal(err)
+	}
+	return apt
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+	}
+	return v
+}
+
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if rec.Code != want {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, want, rec.Body.String())
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	e := newTestEnv(t)
+	rec := e.do(http.MethodGet, "/.well-known/jwks.json", nil, "")
+	expectStatus(t, rec, http.StatusOK)
+
+	set := decode[utils.JWKS](t, rec)
+	if len(set.Keys) != 1 || set.Keys[0].Kid != "test" || set.Keys[0].Alg != "EdDSA" {
+		t.Fatalf("unexpected JWKS: %+v", set)
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	e := newTestEnv(t)
+
+	expectStatus(t, e.do(http.MethodGet, "/api/appointments", nil, ""), http.StatusUnauthorized)
+	expectStatus(t, e.do(http.MethodGet, "/api/appointments", nil, "not-a-token"), http.StatusUnauthorized)
+
+	// A token from another issuer's key is rejected
+	other := utils.NewKeySet("dentist-api-test", "dentist-app", time.Hour)
+	_, priv, _ := ed25519.GenerateKey(nil)
+	other.AddKey("test", priv)
+	other.SetActive("test")
+	forged, _ := other.GenerateJWT(primitive.NewObjectID().Hex(), "dentist", "")
+	expectStatus(t, e.do(http.MethodGet, "/api/appointments", nil, forged), http.StatusUnauthorized)
+
+	// Rotation: the old key is kept as a public key, the new one signs
+	dir := t.TempDir()
+	_, oldKey, _ := ed25519.GenerateKey(nil)
+	_, newKey, _ := ed25519.GenerateKey(nil)
+	writePEM(t, filepath.Join(dir, "2024-01.pem"), "PUBLIC KEY", oldKey.Public())
+	writePEM(t, filepath.Join(dir, "2024-07.pem"), "PRIVATE KEY", newKey)
+	if _, err := utils.LoadKeySet(dir, "2024-01", "dentist-api-test", "dentist-app", time.Hour); err == nil {
+		t.Fatal("a public key cannot be the active signing key")
+	}
+	if err := e.h.Keys.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.h.Keys.SetActive("2024-07"); err != nil {
+		t.Fatal(err)
+	}
+
+	user, oldToken := e.seedUser("client") // Signed before the switch, by "test"
+	expectStatus(t, e.do(http.MethodGet, "/api/appointments", nil, oldToken), http.StatusOK)
+	rec := e.do(http.MethodPost, "/auth/login", gin.H{"email": user.Email, "password": testPassword}, "")
+	expectStatus(t, rec, http.StatusOK)
+	newToken := decode[gin.H](t, rec)["token"].(string)
+	if kid, _ := parseUnverified(t, newToken).Header["kid"].(string); kid != "2024-07" {
+		t.Fatalf("new tokens signed with kid %q, want 2024-07", kid)
+	}
+	expectStatus(t, e.do(http.MethodGet, "/api/appointments", nil, newToken), http.StatusOK)
+
+	claims := func(mutate func(*utils.Claims)) *utils.Claims {
+		now := time.Now()
+		c := &utils.Claims{
+			UserID: user.ID.Hex(), Role: "client", ClinicID: e.clinic.ID.Hex(),
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    "dentist-api-test",
+				Audience:  jwt.ClaimStrings{"dentist-app"},
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			},
+		}
+		if mutate != nil {
+			mutate(c)
+		}
+		return c
+	}
+	sign := func(method jwt.SigningMethod, kid string, key any, c *utils.Claims) string {
+		token := jwt.NewWithClaims(method, c)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"retired key still verifies", sign(jwt.SigningMethodEdDSA, "2024-01", oldKey, claims(nil)), http.StatusOK},
+		{"wrong issuer", sign(jwt.SigningMethodEdDSA, "2024-07", newKey, claims(func(c *utils.Claims) { c.Issuer = "someone-else" })), http.StatusUnauthorized},
+		{"no issuer", sign(jwt.SigningMethodEdDSA, "2024-07", newKey, claims(func(c *utils.Claims) { c.Issuer = "" })), http.StatusUnauthorized},
+		{"wrong audience", sign(jwt.SigningMethodEdDSA, "2024-07", newKey, claims(func(c *utils.Claims) { c.Audience = jwt.ClaimStrings{"billing"} })), http.StatusUnauthorized},
+		{"no audience", sign(jwt.SigningMethodEdDSA, "2024-07", newKey, claims(func(c *utils.Claims) { c.Audience = nil })), http.StatusUnauthorized},
+		{"HMAC keyed with the public key", sign(jwt.SigningMethodHS256, "2024-01", []byte(oldKey.Public().(ed25519.PublicKey)), claims(nil)), http.StatusUnauthorized},
+		{"alg none", sign(jwt.SigningMethodNone, "2024-07", jwt.UnsafeAllowNoneSignatureType, claims(nil)), http.StatusUnauthorized},
+		{"unknown kid", sign(jwt.SigningMethodEdDSA, "2025-01", newKey, claims(nil)), http.StatusUnauthorized},
+		{"key from another kid", sign(jwt.SigningMethodEdDSA, "2024-07", oldKey, claims(nil)), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, e.do(http.MethodGet, "/api/appointments", nil, tt.token), tt.want)
+		})
+	}
+}
+
+// writePEM stores key in PKCS#8 (private) or PKIX (public) form.
+func writePEM(t *testing.T, path, blockType string, key any) {
+	t.Helper()
+	var der []byte
+	var err error
+	if blockType == "PRIVATE KEY" {
+		der, err = x509.MarshalPKCS8PrivateKey(key)
+	} else {
+		der, err = x509.MarshalPKIXPublicKey(key)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func parseUnverified(t *testing.T, token string) *jwt.Token {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &utils.Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestRegisterUser(t *testing.T) {
+	e := newTestEnv(t)
+
+	rec := e.do(http.MethodPost, "/auth/register", gin.H{
+		"fullName": "Rasoa Hanitra",
+		"email":    "Rasoa@Example.com",
+		"password": testPassword,
+		"phone":    "034 12 345 67",
+	}, "")
+	expectStatus(t, rec, http.StatusCreated)
+
+	user := decode[models.User](t, rec)
+	if user.Email != "rasoa@example.com" || user.Phone != "+261341234567" || user.Role != "client" {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+	if user.EmailVerified {
+		t.Fatal("new accounts must start unverified")
+	}
+	if e.notifier.emailTokens[user.ID] == "" {
+		t.Fatal("expected a verification email")
+	}
+	// The sign-up shows in the audit log of the clinic joined
+	_, staffToken := e.seedUser("staff")
+	rec = e.do(http.MethodGet, "/api/audit?action="+models.AuditUserCreated+"&targetId="+user.ID.Hex(), nil, staffToken)
+	expectStatus(t, rec, http.StatusOK)
+	if entries := decode[[]models.AuditEntry](t, rec); len(entries) != 1 || entries[0].ClinicID != e.clinic.ID.Hex() {
+		t.Fatalf("unexpected registration entries: %+v", entries)
+	}
+
+	// Same email, different case
+	rec = e.do(http.MethodPost, "/auth/register", gin.H{
+		"fullName": "Someone Else",
+		"email":    "RASOA@example.com",
+		"password": testPassword,
+		"phone":    "0341234568",
+	}, "")
+	expectStatus(t, rec, http.StatusConflict)
+	if p := decode[apierror.Problem](t, rec); !strings.Contains(p.Message, "email") {
+		t.Fatalf("conflict message = %q, want it to name the email", p.Message)
+	}
+
+	// Same phone, written differently
+	rec = e.do(http.MethodPost, "/auth/register", gin.H{
+		"fullName": "Someone Else",
+		"email":    "someone@example.com",
+		"password": testPassword,
+		"phone":    "+261 34 12 345 67",
+	}, "")
+	expectStatus(t, rec, http.StatusConflict)
+	if p := decode[apierror.Problem](t, rec); !strings.Contains(p.Message, "phone") {
+		t.Fatalf("conflict message = %q, want it to name the phone", p.Message)
+	}
+
+	rec = e.do(http.MethodPost, "/auth/register", gin.H{
+		"fullName": "Bad Phone",
+		"email":    "bad@example.com",
+		"password": testPassword,
+		"phone":    "12",
+	}, "")
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = e.do(http.MethodPost, "/auth/register", gin.H{"email": "missing@example.com"}, "")
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	// Staff roles open every patient record, so nobody grants them to themselves
+	for i, role := range []string{"admin", "staff", "dentist", "assistant"} {
+		rec = e.do(http.MethodPost, "/auth/register", gin.H{
+			"fullName": "Self Promoted",
+			"email":    role + "@example.com",
+			"password": testPassword,
+			"phone":    "034123457" + strconv.Itoa(i),
+			"role":     role,
+		}, "")
+		expectStatus(t, rec, http.StatusBadRequest)
+	}
+	if _, err := e.repos.Users.FindByEmail(context.Background(), "staff@example.com"); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("self-registered staff account was stored: %v", err)
+	}
+}
+
+func TestSetUserRole(t *testing.T) {
+	e := newTestEnv(t)
+	_, adminToken := e.seedUser("admin")
+	staff, staffToken := e.seedUser("staff")
+	user, token := e.seedUser("client")
+	path := "/api/admin/users/" + user.ID.Hex() + "/role"
+
+	expectStatus(t, e.do(http.MethodPut, path, gin.H{"role": "staff"}, staffToken), http.StatusForbidden)
+	expectStatus(t, e.do(http.MethodPut, path, gin.H{"role": "admin"}, adminToken), http.StatusBadRequest)
+	// No route grants anything to "assistant"
+	expectStatus(t, e.do(http.MethodPut, path, gin.H{"role": "assistant"}, adminToken), http.StatusBadRequest)
+	expectStatus(t, e.do(http.MethodGet, "/api/audit", nil, token), http.StatusForbidden)
+
+	rec := e.do(http.MethodPut, path, gin.H{"role": "staff"}, adminToken)
+	expectStatus(t, rec, http.StatusOK)
+	if got := decode[models.User](t, rec); got.Role != "staff" {
+		t.Fatalf("role = %q", got.Role)
+	}
+	entries, _ := e.repos.Audit.List(e.ctx, repository.AuditQuery{Action: models.AuditUserRoleChanged})
+	if len(entries) != 1 || entries[0].TargetID != user.ID.Hex() || entries[0].ActorID == staff.ID.Hex() {
+		t.Fatalf("unexpected audit entries: %+v", entries)
+	}
+
+	// The new role applies from the next login
+	rec = e.do(http.MethodPost, "/auth/login", gin.H{"email": user.Email, "password": testPassword}, "")
+	expectStatus(t, rec, http.StatusOK)
+	expectStatus(t, e.do(http.MethodGet, "/api/audit", nil, decode[gin.H](t, rec)["token"].(string)), http.StatusOK)
+}
+
+func TestLogin(t *testing.T) {
+	e := newTestEnv(t)
+	user, _ := e.seedUser("client")
+
+	rec := e.do(http.MethodPost, "/auth/login", gin.H{"email": user.Email, "password": testPassword}, "")
+	expectStatus(t, rec, http.StatusOK)
+
+	resp := decode[struct {
+		Token string      `json:"token"`
+		User  models.User `json:"user"`
+	}](t, rec)
+	claims, err := e.h.Keys.ValidateJWT(resp.Token)
+	if err != nil {
+		t.Fatalf("login returned an invalid token: %v", err)
+	}
+	if claims.UserID != user.ID.Hex() || claims.Role != "client" {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+
+	rec = e.do(http.MethodPost, "/auth/login", gin.H{"email": user.Email, "password": "wrong password"}, "")
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	rec = e.do(http.MethodPost, "/auth/login", gin.H{"email": "nobody@example.com", "password": testPassword}, "")
+	expectStatus(t, rec, http.StatusUnauthorized)
+}
+
+func TestVerifyEmail(t *testing.T) {
+	e := newTestEnv(t)
+	user, _ := e.seedUser("client")
+
+	expectStatus(t, e.do(http.MethodPost, "/auth/resend-verification", gin.H{"email": user.Email}, ""), http.StatusAccepted)
+	token := e.notifier.emailTokens[user.ID]
+	if token == "" {
+		t.Fatal("expected a verification email")
+	}
+
+	// A second resend inside the cooldown does not send another email
+	delete(e.notifier.emailTokens, user.ID)
+	expectStatus(t, e.do(http.MethodPost, "/auth/resend-verification", gin.H{"email": user.Email}, ""), http.StatusAccepted)
+	if e.notifier.emailTokens[user.ID] != "" {
+		t.Fatal("resend cooldown was not applied")
+	}
+
+	// Unknown addresses get the same answer
+	expectStatus(t, e.do(http.MethodPost, "/auth/resend-verification", gin.H{"email": "nobody@example.com"}, ""), http.StatusAccepted)
+
+	expectStatus(t, e.do(http.MethodPost, "/auth/verify-email", gin.H{"token": "bogus"}, ""), http.StatusBadRequest)
+	expectStatus(t, e.do(http.MethodPost, "/auth/verify-email", gin.H{"token": token}, ""), http.StatusOK)
+
+	stored, _ := e.repos.Users.FindByID(context.Background(), user.ID)
+	if !stored.EmailVerified {
+		t.Fatal("email was not marked verified")
+	}
+
+	// Tokens are single use
+	expectStatus(t, e.do(http.MethodPost, "/auth/verify-email", gin.H{"token": token}, ""), http.StatusBadRequest)
+}
+
+func TestPhoneVerification(t *testing.T) {
+	e := newTestEnv(t)
+	user, token := e.seedUser("client")
+
+	expectStatus(t, e.do(http.MethodPost, "/api/user/phone/send-code", nil, token), http.StatusAccepted)
+	code := e.notifier.phoneCodes[user.ID]
+	if len(code) != phoneCodeLength {
+		t.Fatalf("unexpected code %q", code)
+	}
+	expectStatus(t, e.do(http.MethodPost, "/api/user/phone/send-code", nil, token), http.StatusTooManyRequests)
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	expectStatus(t, e.do(http.MethodPost, "/api/user/phone/verify", gin.H{"code": wrong}, token), http.StatusBadRequest)
+	expectStatus(t, e.do(http.MethodPost, "/api/user/phone/verify", gin.H{"code": code}, token), http.StatusOK)
+
+	stored, _ := e.repos.Users.FindByID(context.Background(), user.ID)
+	if !stored.PhoneVerified {
+		t.Fatal("phone was not marked verified")
+	}
+}
+
+func TestPhoneVerificationAttemptLimit(t *testing.T) {
+	e := newTestEnv(t)
+	user, token := e.seedUser("client")
+
+	expectStatus(t, e.do(http.MethodPost, "/api/user/phone/send-code", nil, token), http.StatusAccepted)
+	code := e.notifier.phoneCodes[user.ID]
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	for i := 0; i < maxPhoneCodeAttempts; i++ {
+		e.do(http.MethodPost, "/api/user/phone/verify", gin.H{"code": wrong}, token)
+	}
+	// Even the right code is refused once the attempts are used up
+	expectStatus(t, e.do(http.MethodPost, "/api/user/phone/verify", gin.H{"code": code}, token), http.StatusBadRequest)
+}
+
+// lockstepTokens holds every FindForUser caller until all of them have read
+// the token, so they all see it before anyone counts an attempt.
+type lockstepTokens struct {
+	repository.VerificationTokenRepository
+	arrived sync.WaitGroup
+}
+
+func (r *lockstepTokens) FindForUser(ctx context.Context, userID primitive.ObjectID, purpose string) (*models.VerificationToken, error) {
+	vt, err := r.VerificationTokenRepository.FindForUser(ctx, userID, purpose)
+	r.arrived.Done()
+	r.arrived.Wait()
+	return vt, err
+}
+
+func TestPhoneVerificationConcurrentGuesses(t *testing.T) {
+	e := newTestEnv(t)
+	user, token := e.seedUser("client")
+
+	expectStatus(t, e.do(http.MethodPost, "/api/user/phone/send-code", nil, token), http.StatusAccepted)
+	wrong := "000000"
+	if e.notifier.phoneCodes[user.ID] == wrong {
+		wrong = "111111"
+	}
+
+	// Guesses sent at once are still only checked maxPhoneCodeAttempts times
+	const guesses = 4 * maxPhoneCodeAttempts
+	tokens := &lockstepTokens{VerificationTokenRepository: e.h.Tokens}
+	tokens.arrived.Add(guesses)
+	e.h.Tokens = tokens
+	var wg sync.WaitGroup
+	var checked atomic.Int64
+	for range guesses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := e.do(http.MethodPost, "/api/user/phone/verify", gin.H{"code": wrong}, token)
+			if strings.Contains(rec.Body.String(), "Incorrect verification code") {
+				checked.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := checked.Load(); got > maxPhoneCodeAttempts {
+		t.Fatalf("%d guesses were checked, want at most %d", got, maxPhoneCodeAttempts)
+	}
+}
+
+func TestGetCurrentUser(t *testing.T) {
+	e := newTestEnv(t)
+	user, token := e.seedUser("client")
+
+	rec := e.do(http.MethodGet, "/api/user/"+user.ID.Hex(), nil, token)
+	expectStatus(t, rec, http.StatusOK)
+	if got := decode[models.User](t, rec); got.ID != user.ID || got.Email != user.Email {
+		t.Fatalf("unexpected user: %+v", got)
+	}
+	if bytes.Contains(rec.Body.Bytes(), []byte("password")) {
+		t.Fatal("password hash leaked in response")
+	}
+}
+
+func TestUpdateCurrentUser(t *testing.T) {
+	e := newTestEnv(t)
+	user, token := e.seedUser("client", func(u *models.User) {
+		u.EmailVerified = true
+		u.PhoneVerified = true
+	})
+	other, _ := e.seedUser("client", func(u *models.User) { u.Phone = "+261349999999" })
+	path := "/api/user/" + user.ID.Hex()
+
+	rec := e.do(http.MethodPut, path, gin.H{
+		"fullName":          "Rakoto Be",
+		"dateOfBirth":       "1990-05-17",
+		"gender":            "male",
+		"preferredLanguage": "mg",
+		"preferredChannel":  "sms",
+		"address":           gin.H{"street": "Lot II", "city": "Antananarivo", "postalCode": "101", "country": "MG"},
+		"emergencyContact":  gin.H{"name": "Rabe", "phone": "033 11 222 33"},
+	}, token)
+	expectStatus(t, rec, http.StatusOK)
+
+	stored, _ := e.repos.Users.FindByID(context.Background(), user.ID)
+	if stored.FullName != "Rakoto Be" || stored.Gender != "male" || stored.Address.City != "Antananarivo" {
+		t.Fatalf("profile not updated: %+v", stored)
+	}
+	if stored.EmergencyContact.Phone != "+261331122233" {
+		t.Fatalf("emergency phone not normalized: %q", stored.EmergencyContact.Phone)
+	}
+	if !stored.EmailVerified || !stored.PhoneVerified {
+		t.Fatal("unrelated edits must not reset verification")
+	}
+
+	// Changing email or phone requires verifying them again
+	rec = e.do(http.MethodPut, path, gin.H{"email": "new@example.com", "phone": "0321234567"}, token)
+	expectStatus(t, rec, http.StatusOK)
+	stored, _ = e.repos.Users.FindByID(context.Background(), user.ID)
+	if stored.EmailVerified || stored.PhoneVerified {
+		t.Fatal("changed contact details must be re-verified")
+	}
+	if e.notifier.emailTokens[user.ID] == "" || e.notifier.phoneCodes[user.ID] == "" {
+		t.Fatal("expected new verification messages")
+	}
+
+	expectStatus(t, e.do(http.MethodPut, path, gin.H{"email": other.Email}, token), http.StatusConflict)
+	expectStatus(t, e.do(http.MethodPut, path, gin.H{"phone": other.Phone}, token), http.StatusConflict)
+	expectStatus(t, e.do(http.MethodPut, path, gin.H{"gender": "unknown"}, token), http.StatusBadRequest)
+	expectStatus(t, e.do(http.MethodPut, path, gin.H{"dateOfBirth": "17/05/1990"}, token), http.StatusBadRequest)
+	expectStatus(t, e.do(http.MethodPut, path, gin.H{}, token), http.StatusBadRequest)
+}
+
+func TestCreateAppointment(t *testing.T) {
+	e := newTestEnv(t)
+	patient, token := e.seedUser("client", func(u *models.User) { u.PhoneVerified = true })
+	_, dentistToken := e.seedUser("dentist")
+
+	start := time.Now().Add(48 * time.Hour).Truncate(time.Second).UTC()
+	body := gin.H{
+		"startTime": start.Format(time.RFC3339),
+		"endTime":   start.Add(30 * time.Minute).Format(time.RFC3339),
+		"service":   "X-Ray",
+	}
+
+	rec := e.do(http.MethodPost, "/api/appointments", body, token)
+	expectStatus(t, rec, http.StatusCreated)
+	apt := decode[models.Appointment](t, rec)
+	if apt.PatientID != patient.ID || apt.Status != "Scheduled" || apt.PatientName != patient.FullName {
+		t.Fatalf("unexpected appointment: %+v", apt)
+	}
+	if len(e.notifier.confirmations) != 1 {
+		t.Fatalf("expected one confirmation SMS, got %d", len(e.notifier.confirmations))
+	}
+
+	expectStatus(t, e.do(http.MethodPost, "/api/appointments", body, dentistToken), http.StatusForbidden)
+	expectStatus(t, e.do(http.MethodPost, "/api/appointments", gin.H{"startTime": "tomorrow"}, token), http.StatusBadRequest)
+}
+
+func TestCreateAppointmentIdempotency(t *testing.T) {
+	e := newTestEnv(t)
+	_, token := e.seedUser("client", func(u *models.User) { u.PhoneVerified = true })
+	_, otherToken := e.seedUser("client")
+
+	start := time.Now().Add(48 * time.Hour).Truncate(time.Second).UTC()
+	body := gin.H{
+		"startTime": start.Format(time.RFC3339),
+		"endTime":   start.Add(30 * time.Minute).Format(time.RFC3339),
+		"service":   "X-Ray",
+	}
+	post := func(token, key string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		return e.doWith(http.MethodPost, "/api/appointments", body, token, http.Header{middleware.IdempotencyKeyHeader: {key}})
+	}
+
+	first := post(token, "booking-1", body)
+	expectStatus(t, first, http.StatusCreated)
+
+	// A retry gets the same appointment back and books nothing new
+	retry := post(token, "booking-1", body)
+	expectStatus(t, retry, http.StatusCreated)
+	if retry.Header().Get(middleware.IdempotentReplayHeader) != "true" || retry.Body.String() != first.Body.String() {
+		t.Fatalf("expected a replay of %s, got %s", first.Body.String(), retry.Body.String())
+	}
+	// With the headers the client needs to edit what it booked
+	apt := decode[models.Appointment](t, first)
+	for name, want := range map[string]string{"ETag": `"1"`, "Location": "/api/appointments/" + apt.ID.Hex()} {
+		if first.Header().Get(name) != want || retry.Header().Get(name) != want {
+			t.Fatalf("%s = %q then %q, want %q both times", name, first.Header().Get(name), retry.Header().Get(name), want)
+		}
+	}
+	if len(e.notifier.confirmations) != 1 {
+		t.Fatalf("expected one confirmation SMS, got %d", len(e.notifier.confirmations))
+	}
+
+	changed := gin.H{"startTime": body["startTime"], "endTime": body["endTime"], "service": "Filling"}
+	rec := post(token, "booking-1", changed)
+	expectStatus(t, rec, http.StatusUnprocessableEntity)
+	if p := decode[apierror.Problem](t, rec); p.Code != "idempotency_key_reused" {
+		t.Fatalf("unexpected problem: %+v", p)
+	}
+
+	// Keys belong to one user
+	expectStatus(t, post(otherToken, "booking-1", body), http.StatusCreated)
+	expectStatus(t, post(token, strings.Repeat("k", 300), body), http.StatusBadRequest)
+
+	all, _ := e.repos.Appointments.List(e.ctx, repository.AppointmentQuery{})
+	if len(all) != 2 {
+		t.Fatalf("expected 2 appointments, got %d", len(all))
+	}
+}
+
+func TestCreateAppointmentRequiresVerifiedContact(t *testing.T) {
+	e := newTestEnv(t)
+	e.h.RequireVerifiedContact = true
+	_, token := e.seedUser("client")
+
+	start := time.Now().Add(48 * time.Hour).UTC()
+	body := gin.H{
+		"startTime": start.Format(time.RFC3339),
+		"endTime":   start.Add(30 * time.Minute).Format(time.RFC3339),
+		"service":   "X-Ray",
+	}
+	expectStatus(t, e.do(http.MethodPost, "/api/appointments", body, token), http.StatusForbidden)
+
+	_, verifiedToken := e.seedUser("client", func(u *models.User) { u.EmailVerified = true })
+	expectStatus(t, e.do(http.MethodPost, "/api/appointments", body, verifiedToken), http.StatusCreated)
+}
+
+// textbeltStub stands in for the Textbelt API and counts the SMS it is asked to send.
+type textbeltStub struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (s *textbeltStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body struct {
+		Phone string `json:"phone"`
+	}
+	json.NewDecoder(req.Body).Decode(&body)
+	s.mu.Lock()
+	s.sent = append(s.sent, body.Phone)
+	s.mu.Unlock()
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{"success":true,"textId":"1"}`)),
+		Request:    req,
+	}, nil
+}
+
+func TestAppointmentConfirmationSMS(t *testing.T) {
+	// The service wraps http.DefaultTransport when it is built
+	stub := &textbeltStub{}
+	defaultTransport := http.DefaultTransport
+	http.DefaultTransport = stub
+	t.Cleanup(func() { http.DefaultTransport = defaultTransport })
+	svc := services.NewNotificationService(config.Notifications{TextbeltKey: "test-key"})
+	log := repository.NewMemoryNotificationRepository()
+	svc.Log = log
+
+	clinic := &models.Clinic{ID: primitive.NewObjectID(), Name: "Analakely"}
+	apt := &models.Appointment{ID: primitive.NewObjectID(), ClinicID: clinic.ID, StartTime: time.Now().Add(48 * time.Hour), Service: "X-Ray", Status: models.StatusScheduled}
+	skipped := metrics.NotificationsSent.WithLabelValues("sms", "skipped")
+
+	tests := []struct {
+		name     string
+		patient  models.User
+		wantSent bool
+	}{
+		{"unverified phone", models.User{ID: primitive.NewObjectID(), Phone: "+261341234567"}, false},
+		{"no phone", models.User{ID: primitive.NewObjectID(), PhoneVerified: true}, false},
+		{"verified phone", models.User{ID: primitive.NewObjectID(), Phone: "+261341234568", PhoneVerified: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub.mu.Lock()
+			stub.sent = nil
+			stub.mu.Unlock()
+			before := testutil.ToFloat64(skipped)
+
+			svc.SendAppointmentConfirmationSMS(context.Background(), &tt.patient, apt, clinic)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := svc.Shutdown(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			stub.mu.Lock()
+			defer stub.mu.Unlock()
+			wantSent, wantSkipped := []string(nil), 1.0
+			if tt.wantSent {
+				wantSent, wantSkipped = []string{tt.patient.Phone}, 0
+			}
+			if !slices.Equal(stub.sent, wantSent) {
+				t.Fatalf("SMS sent to %v, want %v", stub.sent, wantSent)
+			}
+			if got := testutil.ToFloat64(skipped) - before; got != wantSkipped {
+				t.Fatalf("skipped counter moved by %v, want %v", got, wantSkipped)
+			}
+
+			// Only what was sent is recorded, under the appointment's clinic
+			recorded, err := log.ListForUser(tenant.WithClinic(context.Background(), clinic.ID), tt.patient.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.wantSent {
+				if len(recorded) != 0 {
+					t.Fatalf("recorded %+v for an SMS that was not sent", recorded)
+				}
+				return
+			}
+			if len(recorded) != 1 {
+				t.Fatalf("expected 1 recorded notification, got %+v", recorded)
+			}
+			n := recorded[0]
+			if n.Channel != models.NotificationSMS || n.Recipient != tt.patient.Phone || n.Template != models.TemplateAppointmentConfirmed ||
+				n.AppointmentID == nil || *n.AppointmentID != apt.ID || n.SentAt.IsZero() {
+				t.Fatalf("unexpected record %+v", n)
+			}
+		})
+	}
+}
+
+func TestGetAppointments(t *testing.T) {
+	e := newTestEnv(t)
+	patient, _ := e.seedUser("client")
+	_, staffToken := e.seedUser("staff")
+
+	day := time.Date(2024, 7, 10, 9, 0, 0, 0, time.UTC)
+	e.seedAppointment(patient, day.Add(2*time.Hour), "Scheduled")
+	e.seedAppointment(patient, day, "Scheduled")
+	e.seedAppointment(patient, day.AddDate(0, 1, 0), "Cancelled")
+
+	rec := e.do(http.MethodGet, "/api/appointments?startDate=2024-07-01&endDate=2024-07-31", nil, staffToken)
+	expectStatus(t, rec, http.StatusOK)
+	got := decode[[]models.Appointment](t, rec)
+	if len(got) != 2 || !got[0].StartTime.Before(got[1].StartTime) {
+		t.Fatalf("expected two July appointments in ascending order, got %+v", got)
+	}
+
+	rec = e.do(http.MethodGet, "/api/appointments?status=Cancelled", nil, staffToken)
+	expectStatus(t, rec, http.StatusOK)
+	if got := decode[[]models.Appointment](t, rec); len(got) != 1 {
+		t.Fatalf("expected one cancelled appointment, got %d", len(got))
+	}
+}
+
+func TestGetAppointmentForUser(t *testing.T) {
+	e := newTestEnv(t)
+	alice, aliceToken := e.seedUser("client")
+	bob, _ := e.seedUser("client")
+	_, dentistToken := e.seedUser("dentist")
+
+	base := time.Date(2024, 7, 10, 9, 0, 0, 0, time.UTC)
+	e.seedAppointment(alice, base, "Scheduled")
+	e.seedAppointment(alice, base.Add(24*time.Hour), "Scheduled")
+	e.seedAppointment(bob, base, "Scheduled")
+
+	// Clients only ever see their own appointments, newest first
+	rec := e.do(http.MethodGet, "/api/appointment/user/"+alice.ID.Hex()+"?patientId="+bob.ID.Hex(), nil, aliceToken)
+	expectStatus(t, rec, http.StatusOK)
+	got := decode[[]models.Appointment](t, rec)
+	if len(got) != 2 || got[0].PatientID != alice.ID || !got[0].StartTime.After(got[1].StartTime) {
+		t.Fatalf("unexpected appointments for client: %+v", got)
+	}
+
+	rec = e.do(http.MethodGet, "/api/appointment/user/x?patientId="+bob.ID.Hex(), nil, dentistToken)
+	expectStatus(t, rec, http.StatusOK)
+	if got := decode[[]models.Appointment](t, rec); len(got) != 1 || got[0].PatientID != bob.ID {
+		t.Fatalf("unexpected appointments for dentist: %+v", got)
+	}
+
+	rec = e.do(http.MethodGet, "/api/appointment/user/x", nil, dentistToken)
+	if got := decode[[]models.Appointment](t, rec); len(got) != 3 {
+		t.Fatalf("dentist should see all appointments, got %d", len(got))
+	}
+}
+
+func TestAppointmentPagination(t *testing.T) {
+	e := newTestEnv(t)
+	patient, _ := e.seedUser("client")
+	_, staffToken := e.seedUser("staff")
+
+	base := time.Date(2024, 7, 10, 9, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		e.seedAppointment(patient, base.Add(time.Duration(i)*time.Hour), "Scheduled")
+	}
+	// Same start time: the ID breaks the tie so nothing is skipped or repeated
+	e.seedAppointment(patient, base.Add(2*time.Hour), "Scheduled")
+
+	var seen []time.Time
+	path := "/api/appointments?limit=2&total=true"
+	for page := 0; path != ""; page++ {
+		if page > 5 {
+			t.Fatal("pagination never ended")
+		}
+		rec := e.do(http.MethodGet, path, nil, staffToken)
+		expectStatus(t, rec, http.StatusOK)
+		if got := rec.Header().Get("X-Total-Count"); got != "6" {
+			t.Fatalf("X-Total-Count = %q, want 6", got)
+		}
+		for _, apt := range decode[[]models.Appointment](t, rec) {
+			seen = append(seen, apt.StartTime)
+		}
+		path = ""
+		if link := rec.Header().Get("Link"); link != "" {
+			path = strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+		}
+	}
+	if len(seen) != 6 || !slices.IsSortedFunc(seen, func(a, b time.Time) int { return a.Compare(b) }) {
+		t.Fatalf("expected 6 appointments in ascending order, got %v", seen)
+	}
+
+	rec := e.do(http.MethodGet, "/api/appointments?sort=-startTime&limit=1&fields=id,startTime", nil, staffToken)
+	expectStatus(t, rec, http.StatusOK)
+	got := decode[[]map[string]any](t, rec)
+	if len(got) != 1 || len(got[0]) != 2 || got[0]["startTime"] != base.Add(4*time.Hour).Format(time.RFC3339) {
+		t.Fatalf("unexpected projected page: %+v", got)
+	}
+	if rec.Header().Get("X-Total-Count") != "" {
+		t.Fatal("total should only be counted on request")
+	}
+
+	// A cursor is tied to the sort it was issued for
+	cursor := rec.Header().Get("X-Next-Cursor")
+	rec = e.do(http.MethodGet, "/api/appointments?sort=startTime&cursor="+cursor, nil, staffToken)
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	for _, query := range []string{"limit=0", "limit=501", "sort=password", "fields=password", "cursor=!!", "total=maybe"} {
+		rec := e.do(http.MethodGet, "/api/appointments?"+query, nil, staffToken)
+		expectStatus(t, rec, http.StatusBadRequest)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	e := newTestEnv(t)
+	hery, _ := e.seedUser("client", func(u *models.User) { u.FullName = "Hery Rabé" })
+	e.seedUser("client", func(u *models.User) { u.FullName = "Rabe Andry"; u.Phone = "+261331112233" })
+	e.seedUser("dentist", func(u *models.User) { u.FullName = "Dr Rabe" })
+	_, clientToken := e.seedUser("client")
+	_, staffToken := e.seedUser("staff")
+
+	apt := e.seedAppointment(hery, time.Date(2024, 7, 10, 9, 0, 0, 0, time.UTC), "Scheduled")
+	apt.Notes = "Sensibilité dentaire"
+	if err := e.repos.Appointments.Update(e.ctx, apt); err != nil {
+		t.Fatal(err)
+	}
+
+	type results struct {
+		Patients []struct {
+			FullName string  `json:"fullName"`
+			Score    float64 `json:"score"`
+		} `json:"patients"`
+		Appointments []struct {
+			ID    string  `json:"id"`
+			Score float64 `json:"score"`
+		} `json:"appointments"`
+	}
+
+	// Accents and case are ignored; staff accounts are not patients
+	rec := e.do(http.MethodGet, "/api/search?q=RABE", nil, staffToken)
+	expectStatus(t, rec, http.StatusOK)
+	got := decode[results](t, rec)
+	if len(got.Patients) != 2 || len(got.Appointments) != 1 {
+		t.Fatalf("unexpected results for RABE: %+v", got)
+	}
+
+	// More matching words rank higher
+	rec = e.do(http.MethodGet, "/api/search?q=rabe+andry", nil, staffToken)
+	got = decode[results](t, rec)
+	if len(got.Patients) != 2 || got.Patients[0].FullName != "Rabe Andry" || got.Patients[0].Score <= got.Patients[1].Score {
+		t.Fatalf("expected Rabe Andry first: %+v", got.Patients)
+	}
+
+	rec = e.do(http.MethodGet, "/api/search?q=sensibilite", nil, staffToken)
+	got = decode[results](t, rec)
+	if len(got.Patients) != 0 || len(got.Appointments) != 1 || got.Appointments[0].ID != apt.ID.Hex() {
+		t.Fatalf("expected the appointment by its notes: %+v", got)
+	}
+
+	// Local phone formats find the stored E.164 number
+	rec = e.do(http.MethodGet, "/api/search?q=033+11+122+33", nil, staffToken)
+	got = decode[results](t, rec)
+	if len(got.Patients) != 1 || got.Patients[0].FullName != "Rabe Andry" {
+		t.Fatalf("expected a match by phone: %+v", got)
+	}
+
+	expectStatus(t, e.do(http.MethodGet, "/api/search?q=rabe", nil, clientToken), http.StatusForbidden)
+	expectStatus(t, e.do(http.MethodGet, "/api/search?q=r", nil, staffToken), http.StatusBadRequest)
+	expectStatus(t, e.do(http.MethodGet, "/api/search?q=rabe&limit=1000", nil, staffToken), http.StatusBadRequest)
+}
+
+func TestUpdateAppointment(t *testing.T) {
+	e := newTestEnv(t)
+	patient, clientToken := e.seedUser("client")
+	_, staffToken := e.seedUser("staff")
+	apt := e.seedAppointment(patient, time.Date(2024, 7, 10, 9, 0, 0, 0, time.UTC), "Scheduled")
+	path := "/api/appointments/" + apt.ID.Hex()
+	ifMatch := http.Header{"If-Match": {`"1"`}}
+
+	// The end time is kept, so moving only the start past it is a bad range
+	newStart := time.Date(2024, 7, 11, 14, 0, 0, 0, time.UTC)
+	expectStatus(t, e.doWith(http.MethodPut, path, gin.H{"startTime": newStart.Format(time.RFC3339)}, staffToken, ifMatch), http.StatusBadRequest)
+
+	rec := e.doWith(http.MethodPut, path, gin.H{
+		"startTime": newStart.Format(time.RFC3339),
+		"endTime":   newStart.Add(time.Hour).Format(time.RFC3339),
+		"service":   "Filling",
+	}, staffToken, ifMatch)
+	expectStatus(t, rec, http.StatusOK)
+
+	stored, _ := e.repos.Appointments.FindByID(e.ctx, apt.ID)
+	if !stored.StartTime.Equal(newStart) || !stored.EndTime.Equal(newStart.Add(time.Hour)) || stored.Service != "Filling" || stored.Status != "Scheduled" {
+		t.Fatalf("appointment not updated: %+v", stored)
+	}
+
+	expectStatus(t, e.do(http.MethodPut, path, gin.H{"service": "Whitening"}, clientToken), http.StatusForbidden)
+	expectStatus(t, e.doWith(http.MethodPut, path, gin.H{}, staffToken, ifMatch), http.StatusBadRequest)
+	expectStatus(t, e.doWith(http.MethodPut, "/api/appointments/nope", gin.H{"service": "X"}, staffToken, ifMatch), http.StatusBadRequest)
+	expectStatus(t, e.doWith(http.MethodPut, "/api/appointments/"+primitive.NewObjectID().Hex(), gin.H{"service": "X"}, staffToken, ifMatch), http.StatusNotFound)
+}
+
+func TestCancelAppointment(t *testing.T) {
+	e := newTestEnv(t)
+	patient, clientToken := e.seedUser("client", func(u *models.User) { u.PhoneVerified = true })
+	_, dentistToken := e.seedUser("dentist")
+	apt := e.seedAppointment(patient, time.Date(2024, 7, 10, 9, 0, 0, 0, time.UTC), "Scheduled")
+	path := "/api/appointments/" + apt.ID.Hex() + "/cancel"
+
+	ifMatch := http.Header{"If-Match": {`"1"`}}
+
+	expectStatus(t, e.doWith(http.MethodPatch, path, nil, clientToken, ifMatch), http.StatusForbidden)
+	expectStatus(t, e.doWith(http.MethodPatch, path, nil, dentistToken, ifMatch), http.StatusOK)
+
+	stored, _ := e.repos.Appointments.FindByID(e.ctx, apt.ID)
+	if stored.Status != "Cancelled" {
+		t.Fatalf("status = %q, want Cancelled", stored.Status)
+	}
+	if len(e.notifier.confirmations) != 1 || e.notifier.confirmations[0].Status != "Cancelled" {
+		t.Fatal("expected a cancellation SMS")
+	}
+
+	expectStatus(t, e.doWith(http.MethodPatch, "/api/appointments/"+primitive.NewObjectID().Hex()+"/cancel", nil, dentistToken, ifMatch), http.StatusNotFound)
+}
+
+func TestAppointmentOptimisticConcurrency(t *testing.T) {
+	e := newTestEnv(t)
+	patient, clientToken := e.seedUser("client")
+	_, otherToken := e.seedUser("client")
+	_, staffToken := e.seedUser("staff")
+	apt := e.seedAppointment(patient, time.Date(2024, 7, 10, 9, 0, 0, 0, time.UTC), "Scheduled")
+	path := "/api/appointments/" + apt.ID.Hex()
+
+	rec := e.do(http.MethodGet, path, nil, clientToken)
+	expectStatus(t, rec, http.StatusOK)
+	etag := rec.Header().Get("ETag")
+	if etag != `"1"` || decode[models.Appointment](t, rec).Version != 1 {
+		t.Fatalf("ETag = %q, want \"1\"", etag)
+	}
+	expectStatus(t, e.do(http.MethodGet, path, nil, otherToken), http.StatusNotFound)
+
+	// Two receptionists read version 1; the first save wins
+	rec = e.doWith(http.MethodPut, path, gin.H{"service": "Filling"}, staffToken, http.Header{"If-Match": {etag}})
+	expectStatus(t, rec, http.StatusOK)
+	if got := rec.Header().Get("ETag"); got != `"2"` {
+		t.Fatalf("ETag after update = %q, want \"2\"", got)
+	}
+
+	rec = e.doWith(http.MethodPut, path, gin.H{"service": "Whitening"}, staffToken, http.Header{"If-Match": {etag}})
+	expectStatus(t, rec, http.StatusPreconditionFailed)
+	if rec.Header().Get("ETag") != `"2"` {
+		t.Fatalf("a 412 should carry the current ETag, got %q", rec.Header().Get("ETag"))
+	}
+	expectStatus(t, e.doWith(http.MethodPatch, path+"/cancel", nil, staffToken, http.Header{"If-Match": {etag}}), http.StatusPreconditionFailed)
+	expectStatus(t, e.do(http.MethodPut, path, gin.H{"service": "Whitening"}, staffToken), http.StatusPreconditionRequired)
+
+	stored, _ := e.repos.Appointments.FindByID(e.ctx, apt.ID)
+	if stored.Service != "Filling" || stored.Status != "Scheduled" {
+		t.Fatalf("stale writes went through: %+v", stored)
+	}
+
+	// The repository refuses a stale copy too, in case two requests pass the check together
+	stale := *apt
+	if err := e.repos.Appointments.Update(e.ctx, &stale); !errors.Is(err, repository.ErrVersionConflict) {
+		t.Fatalf("expected ErrVersionConflict, got %v", err)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	e := newTestEnv(t)
+	patient, clientToken := e.seedUser("client", func(u *models.User) { u.PhoneVerified = true })
+	staff, staffToken := e.seedUser("staff")
+	_, dentistToken := e.seedUser("dentist")
+	_, adminToken := e.seedUser("admin")
+
+	start := time.Now().Add(48 * time.Hour).Truncate(time.Second).UTC()
+	rec := e.do(http.MethodPost, "/api/appointments", gin.H{
+		"startTime": start.Format(time.RFC3339),
+		"endTime":   start.Add(30 * time.Minute).Format(time.RFC3339),
+		"service":   "X-Ray",
+	}, clientToken)
+	expectStatus(t, rec, http.StatusCreated)
+	apt := decode[models.Appointment](t, rec)
+	path := "/api/appointments/" + apt.ID.Hex()
+
+	expectStatus(t, e.doWith(http.MethodPut, path, gin.H{"service": "Filling"}, staffToken, http.Header{"If-Match": {`"1"`}}), http.StatusOK)
+	expectStatus(t, e.doWith(http.MethodPatch, path+"/cancel", nil, staffToken, http.Header{"If-Match": {`"2"`}}), http.StatusOK)
+	expectStatus(t, e.do(http.MethodPut, "/api/user/me", gin.H{"fullName": "Hery Rabe"}, clientToken), http.StatusOK)
+
+	rec = e.do(http.MethodGet, "/api/audit?targetType=appointment&targetId="+apt.ID.Hex(), nil, staffToken)
+	expectStatus(t, rec, http.StatusOK)
+	entries := decode[[]models.AuditEntry](t, rec)
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 appointment entries, got %+v", entries)
+	}
+	cancelled, updated, created := entries[0], entries[1], entries[2]
+	if created.Action != models.AuditAppointmentCreated || created.ActorID != patient.ID.Hex() || created.ActorRole != "client" {
+		t.Fatalf("unexpected creation entry: %+v", created)
+	}
+	if updated.Action != models.AuditAppointmentUpdated || updated.ActorID != staff.ID.Hex() || updated.RequestID == "" {
+		t.Fatalf("unexpected update entry: %+v", updated)
+	}
+	if len(updated.Changes) != 1 || updated.Changes[0] != (models.FieldChange{Field: "service", From: "X-Ray", To: "Filling"}) {
+		t.Fatalf("unexpected update diff: %+v", updated.Changes)
+	}
+	if cancelled.Action != models.AuditAppointmentCancelled || len(cancelled.Changes) != 1 || cancelled.Changes[0].To != "Cancelled" {
+		t.Fatalf("unexpected cancellation entry: %+v", cancelled)
+	}
+
+	rec = e.do(http.MethodGet, "/api/audit?actorId="+patient.ID.Hex()+"&action=user.updated", nil, staffToken)
+	entries = decode[[]models.AuditEntry](t, rec)
+	if len(entries) != 1 || entries[0].TargetID != patient.ID.Hex() || entries[0].Changes[0].Field != "fullName" {
+		t.Fatalf("unexpected profile entries: %+v", entries)
+	}
+
+	// Paging follows the Link header
+	rec = e.do(http.MethodGet, "/api/audit?limit=2", nil, staffToken)
+	if got := decode[[]models.AuditEntry](t, rec); len(got) != 2 || rec.Header().Get("Link") == "" {
+		t.Fatalf("expected a first page of 2 with a next link, got %d entries", len(got))
+	}
+
+	// Admins read the same log as staff
+	for _, token := range []string{staffToken, adminToken} {
+		rec = e.do(http.MethodGet, "/api/audit?targetType=appointment&targetId="+apt.ID.Hex(), nil, token)
+		expectStatus(t, rec, http.StatusOK)
+		if got := decode[[]models.AuditEntry](t, rec); len(got) != 3 {
+			t.Fatalf("expected 3 appointment entries, got %+v", got)
+		}
+	}
+	expectStatus(t, e.do(http.MethodGet, "/api/audit", nil, dentistToken), http.StatusForbidden)
+	expectStatus(t, e.do(http.MethodGet, "/api/audit", nil, clientToken), http.StatusForbidden)
+	expectStatus(t, e.do(http.MethodGet, "/api/audit?from=yesterday", nil, staffToken), http.StatusBadRequest)
+}
+
+func TestSoftDelete(t *testing.T) {
+	e := newTestEnv(t)
+	ctx := e.ctx
+	patient, patientToken := e.seedUser("client")
+	_, staffToken := e.seedUser("staff")
+	_, adminToken := e.seedUser("admin")
+
+	apt := e.seedAppointment(patient, time.Now().Add(24*time.Hour), "Scheduled")
+	path := "/api/appointments/" + apt.ID.Hex()
+
+	expectStatus(t, e.do(http.MethodDelete, path, nil, patientToken), http.StatusForbidden)
+	expectStatus(t, e.do(http.MethodDelete, path, nil, staffToken), http.StatusNoContent)
+	expectStatus(t, e.do(http.MethodGet, path, nil, staffToken), http.StatusNotFound)
+	expectStatus(t, e.do(http.MethodDelete, path, nil, staffToken), http.StatusNotFound)
+	if got := decode[[]models.Appointment](t, e.do(http.MethodGet, "/api/appointments", nil, staffToken)); len(got) != 0 {
+		t.Fatalf("deleted appointment still listed: %+v", got)
+	}
+
+	expectStatus(t, e.do(http.MethodPost, "/api/admin"+path[4:]+"/restore", nil, staffToken), http.StatusForbidden)
+	rec := e.do(http.MethodPost, "/api/admin"+path[4:]+"/restore", nil, adminToken)
+	expectStatus(t, rec, http.StatusOK)
+	if restored := decode[models.Appointment](t, rec); restored.DeletedAt != nil || restored.Version != 3 {
+		t.Fatalf("unexpected restored appointment: %+v", restored)
+	}
+	expectStatus(t, e.do(http.MethodGet, path, nil, staffToken), http.StatusOK)
+
+	// A deleted patient can no longer sign in, but keeps their email until purged
+	expectStatus(t, e.do(http.MethodDelete, "/api/users/"+patient.ID.Hex(), nil, staffToken), http.StatusForbidden)
+	expectStatus(t, e.do(http.MethodDelete, "/api/users/"+patient.ID.Hex(), nil, adminToken), http.StatusNoContent)
+	expectStatus(t, e.do(http.MethodPost, "/auth/login", gin.H{"email": patient.Email, "password": testPassword}, ""), http.StatusUnauthorized)
+	if taken, _ := e.repos.Users.EmailTaken(ctx, patient.Email, primitive.NilObjectID); !taken {
+		t.Fatal("a deleted account must still hold its email")
+	}
+	expectStatus(t, e.do(http.MethodPost, "/api/admin/users/"+patient.ID.Hex()+"/restore", nil, adminToken), http.StatusOK)
+	expectStatus(t, e.do(http.MethodPost, "/auth/login", gin.H{"email": patient.Email, "password": testPassword}, ""), http.StatusOK)
+
+	// The purge only removes what was deleted before the retention period
+	expectStatus(t, e.do(http.MethodDelete, path, nil, staffToken), http.StatusNoContent)
+	purge := &jobs.Purge{Users: e.repos.Users, Appointments: e.repos.Appointments, Retention: time.Hour}
+	if err := purge.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, e.do(http.MethodPost, "/api/admin"+path[4:]+"/restore", nil, adminToken), http.StatusOK)
+	expectStatus(t, e.do(http.MethodDelete, path, nil, staffToken), http.StatusNoContent)
+	purge.Retention = -time.Hour
+	if err := purge.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, e.do(http.MethodPost, "/api/admin"+path[4:]+"/restore", nil, adminToken), http.StatusNotFound)
+
+	rec = e.do(http.MethodGet, "/api/audit?targetType=appointment&action=appointment.deleted", nil, staffToken)
+	if got := decode[[]models.AuditEntry](t, rec); len(got) != 3 {
+		t.Fatalf("expected 3 deletion entries, got %+v", got)
+	}
+}
+
+func TestPersonalDataExport(t *testing.T) {
+	e := newTestEnv(t)
+	patient, token := e.seedUser("client", func(u *models.User) { u.PhoneVerified = true })
+	_, staffToken := e.seedUser("staff")
+	other, _ := e.seedUser("client")
+	e.seedAppointment(other, time.Now().Add(24*time.Hour), "Scheduled")
+
+	start := time.Now().Add(48 * time.Hour).Truncate(time.Second).UTC()
+	rec := e.do(http.MethodPost, "/api/appointments", gin.H{
+		"startTime": start.Format(time.RFC3339),
+		"endTime":   start.Add(30 * time.Minute).Format(time.RFC3339),
+		"service":   "Cleaning",
+	}, token)
+	expectStatus(t, rec, http.StatusCreated)
+	apt := decode[models.Appointment](t, rec)
+	expectStatus(t, e.doWith(http.MethodPut, "/api/appointments/"+apt.ID.Hex(), gin.H{"service": "Filling"}, staffToken, http.Header{"If-Match": {`"1"`}}), http.StatusOK)
+	expectStatus(t, e.do(http.MethodPut, "/api/user/me", gin.H{"gender": "female"}, token), http.StatusOK)
+	expectStatus(t, e.do(http.MethodPost, "/api/chat", gin.H{"message": "Do you do whitening?"}, token), http.StatusOK)
+	// Kept until the purge, so still part of the export
+	deleted := e.seedAppointment(patient, time.Now().Add(-24*time.Hour), "Completed")
+	if err := e.repos.Appointments.SoftDelete(e.ctx, deleted.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	// What was sent, in any of the patient's clinics
+	otherClinic := primitive.NewObjectID()
+	for _, n := range []models.Notification{
+		{UserID: patient.ID, Channel: models.NotificationSMS, Recipient: patient.Phone, Template: models.TemplateAppointmentConfirmed, AppointmentID: &apt.ID, SentAt: time.Now().Add(-time.Minute).UTC()},
+		{UserID: patient.ID, ClinicID: otherClinic, Channel: models.NotificationEmail, Recipient: patient.Email, Template: models.TemplateEmailVerification, SentAt: time.Now().UTC()},
+		{UserID: primitive.NewObjectID(), Channel: models.NotificationSMS, Recipient: "+261340000000", Template: models.TemplatePhoneVerification, SentAt: time.Now().UTC()},
+	} {
+		if err := e.repos.Notifications.Record(e.ctx, &n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec = e.do(http.MethodGet, "/api/user/me/export", nil, token)
+	expectStatus(t, rec, http.StatusOK)
+	export := decode[DataExport](t, rec)
+	if export.Profile == nil || export.Profile.ID != patient.ID || export.Profile.Gender != "female" {
+		t.Fatalf("unexpected profile: %+v", export.Profile)
+	}
+	exported := map[primitive.ObjectID]bool{}
+	for _, a := range export.Appointments {
+		exported[a.ID] = a.DeletedAt != nil
+	}
+	if isDeleted, ok := exported[apt.ID]; len(exported) != 2 || !ok || isDeleted || !exported[deleted.ID] {
+		t.Fatalf("expected the patient's live and deleted appointments, got %+v", export.Appointments)
+	}
+	if len(export.Conversations) != 1 || len(export.Conversations[0].Messages) != 2 || export.Conversations[0].Messages[0].Text != "Do you do whitening?" {
+		t.Fatalf("unexpected conversations: %+v", export.Conversations)
+	}
+	if len(export.Notifications) != 2 || export.Notifications[0].Template != models.TemplateEmailVerification || export.Notifications[0].ClinicID != otherClinic ||
+		export.Notifications[1].AppointmentID == nil || *export.Notifications[1].AppointmentID != apt.ID || export.Notifications[1].Recipient != patient.Phone {
+		t.Fatalf("unexpected notifications: %+v", export.Notifications)
+	}
+	// Their booking and profile change; the staff edit targets the appointment
+	if len(export.Activity) != 2 || export.Activity[0].Action != models.AuditUserUpdated || export.Activity[1].Action != models.AuditAppointmentCreated {
+		t.Fatalf("unexpected activity: %+v", export.Activity)
+	}
+
+	rec = e.do(http.MethodGet, "/api/user/me/export?format=zip", nil, token)
+	expectStatus(t, rec, http.StatusOK)
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range archive.File {
+		names = append(names, f.Name)
+	}
+	if !slices.Equal(names, []string{"profile.json", "appointments.json", "conversations.json", "notifications.json", "activity.json"}) {
+		t.Fatalf("unexpected archive content: %v", names)
+	}
+
+	expectStatus(t, e.do(http.MethodGet, "/api/user/me/export?format=xml", nil, token), http.StatusBadRequest)
+}
+
+func TestPersonalDataErasure(t *testing.T) {
+	e := newTestEnv(t)
+	ctx := e.ctx
+	patient, token := e.seedUser("client", func(u *models.User) { u.FullName = "Hery Rabe" })
+	second, _ := e.seedUser("client", func(u *models.User) { u.FullName = "Lova Rakoto" })
+	_, staffToken := e.seedUser("staff")
+	_, adminToken := e.seedUser("admin")
+
+	apt := e.seedAppointment(patient, time.Now().Add(24*time.Hour), "Scheduled")
+	expectStatus(t, e.do(http.MethodPut, "/api/user/me", gin.H{"fullName": "Hery Rabemanana"}, token), http.StatusOK)
+	expectStatus(t, e.do(http.MethodPost, "/api/chat", gin.H{"message": "I am Hery, is my tooth infected?"}, token), http.StatusOK)
+	sms := models.Notification{UserID: patient.ID, Channel: models.NotificationSMS, Recipient: patient.Phone, Template: models.TemplateAppointmentConfirmed, AppointmentID: &apt.ID, SentAt: time.Now().UTC()}
+	if err := e.repos.Notifications.Record(ctx, &sms); err != nil {
+		t.Fatal(err)
+	}
+
+	expectStatus(t, e.do(http.MethodPost, "/api/user/me/erase", gin.H{"password": "wrong password"}, token), http.StatusUnauthorized)
+	expectStatus(t, e.do(http.MethodPost, "/api/user/me/erase", gin.H{"password": testPassword}, token), http.StatusNoContent)
+
+	expectStatus(t, e.do(http.MethodPost, "/auth/login", gin.H{"email": patient.Email, "password": testPassword}, ""), http.StatusUnauthorized)
+	if taken, _ := e.repos.Users.EmailTaken(ctx, patient.Email, primitive.NilObjectID); taken {
+		t.Fatal("the erased email must be free again")
+	}
+
+	// The appointment is kept for the clinic's records, without the name
+	stored, err := e.repos.Appointments.FindByID(ctx, apt.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.PatientName != models.ErasedName || stored.PatientID != patient.ID || stored.Service != apt.Service {
+		t.Fatalf("unexpected appointment after erasure: %+v", stored)
+	}
+	if got := decode[map[string][]any](t, e.do(http.MethodGet, "/api/search?q=Rabemanana", nil, staffToken)); len(got["patients"])+len(got["appointments"]) != 0 {
+		t.Fatalf("erased patient still searchable: %+v", got)
+	}
+	if chats, _ := e.repos.Conversations.List(ctx, patient.ID, 0); len(chats) != 0 {
+		t.Fatalf("conversations kept after erasure: %+v", chats)
+	}
+	// The clinic may keep that it notified the patient, not where
+	if sent, _ := e.repos.Notifications.ListForUser(ctx, patient.ID); len(sent) != 1 || sent[0].Recipient != "" || sent[0].Template != sms.Template {
+		t.Fatalf("unexpected notifications after erasure: %+v", sent)
+	}
+
+	// The audit log keeps what happened, not the values
+	entries, _ := e.repos.Audit.List(ctx, repository.AuditQuery{TargetID: patient.ID.Hex()})
+	if len(entries) != 2 || entries[0].Action != models.AuditUserErased {
+		t.Fatalf("unexpected audit entries: %+v", entries)
+	}
+	if change := entries[1].Changes[0]; change.Field != "fullName" || change.From != nil || change.To != nil {
+		t.Fatalf("audit entry still holds the name: %+v", change)
+	}
+
+	// Admins erase on request, even deleted accounts
+	expectStatus(t, e.do(http.MethodPost, "/api/admin/users/"+second.ID.Hex()+"/erase", nil, staffToken), http.StatusForbidden)
+	expectStatus(t, e.do(http.MethodDelete, "/api/users/"+second.ID.Hex(), nil, adminToken), http.StatusNoContent)
+	expectStatus(t, e.do(http.MethodPost, "/api/admin/users/"+second.ID.Hex()+"/erase", nil, adminToken), http.StatusNoContent)
+	expectStatus(t, e.do(http.MethodPost, "/api/admin/users/"+primitive.NewObjectID().Hex()+"/erase", nil, adminToken), http.StatusNotFound)
+	rec := e.do(http.MethodPost, "/api/admin/users/"+second.ID.Hex()+"/restore", nil, adminToken)
+	expectStatus(t, rec, http.StatusOK)
+	if restored := decode[models.User](t, rec); restored.FullName != models.ErasedName || restored.Phone != "" || restored.ErasedAt == nil {
+		t.Fatalf("restoring must not bring personal data back: %+v", restored)
+	}
+}
+
+func TestClinicIsolation(t *testing.T) {
+	e := newTestEnv(t)
+	_, adminToken := e.seedUser("admin", func(u *models.User) { u.ClinicIDs = nil })
+	patient, patientToken := e.seedUser("client", func(u *models.User) { u.FullName = "Hery Rabe" })
+	dentist, dentistToken := e.seedUser("dentist")
+
+	// An admin without a clinic manages clinics but sees no clinic data
+	rec := e.do(http.MethodPost, "/api/admin/clinics", gin.H{"name": "Tamatave"}, adminToken)
+	expectStatus(t, rec, http.StatusCreated)
+	branch := decode[models.Clinic](t, rec)
+	rec = e.do(http.MethodGet, "/api/appointments", nil, adminToken)
+	expectStatus(t, rec, http.StatusForbidden)
+	if got := decode[apierror.Problem](t, rec); got.Code != apierror.CodeNoClinic {
+		t.Fatalf("expected %s, got %+v", apierror.CodeNoClinic, got)
+	}
+
+	_, branchStaffToken := e.seedUser("staff", func(u *models.User) { u.ClinicIDs = []primitive.ObjectID{branch.ID} })
+	apt := e.seedAppointment(patient, time.Now().Add(24*time.Hour), "Scheduled")
+	if apt.ClinicID != e.clinic.ID {
+		t.Fatalf("appointment filed under %s, want %s", apt.ClinicID.Hex(), e.clinic.ID.Hex())
+	}
+
+	// The other branch sees none of it
+	if got := decode[[]models.Appointment](t, e.do(http.MethodGet, "/api/appointments", nil, branchStaffToken)); len(got) != 0 {
+		t.Fatalf("other clinic's appointments leaked: %+v", got)
+	}
+	expectStatus(t, e.do(http.MethodGet, "/api/appointments/"+apt.ID.Hex(), nil, branchStaffToken), http.StatusNotFound)
+	expectStatus(t, e.doWith(http.MethodPut, "/api/appointments/"+apt.ID.Hex(), gin.H{"service": "X-Ray"}, branchStaffToken, http.Header{"If-Match": {`"1"`}}), http.StatusNotFound)
+	if got := decode[map[string][]any](t, e.do(http.MethodGet, "/api/search?q=Rabe", nil, branchStaffToken)); len(got["patients"])+len(got["appointments"]) != 0 {
+		t.Fatalf("other clinic's patients leaked: %+v", got)
+	}
+	expectStatus(t, e.do(http.MethodPut, "/api/user/me", gin.H{"gender": "female"}, patientToken), http.StatusOK)
+	if got := decode[[]models.AuditEntry](t, e.do(http.MethodGet, "/api/audit", nil, branchStaffToken)); len(got) != 0 {
+		t.Fatalf("other clinic's audit entries leaked: %+v", got)
+	}
+
+	// A dentist who also works at the branch switches to it
+	expectStatus(t, e.do(http.MethodPost, "/api/clinics/"+branch.ID.Hex()+"/switch", nil, dentistToken), http.StatusForbidden)
+	expectStatus(t, e.do(http.MethodPut, "/api/admin/clinics/"+branch.ID.Hex()+"/members/"+dentist.ID.Hex(), nil, branchStaffToken), http.StatusForbidden)
+	expectStatus(t, e.do(http.MethodPut, "/api/admin/clinics/"+branch.ID.Hex()+"/members/"+dentist.ID.Hex(), nil, adminToken), http.StatusOK)
+	if got := decode[[]models.Clinic](t, e.do(http.MethodGet, "/api/clinics", nil, dentistToken)); len(got) != 2 {
+		t.Fatalf("expected both clinics, got %+v", got)
+	}
+	rec = e.do(http.MethodPost, "/auth/login", gin.H{"email": dentist.Email, "password": testPassword, "clinicId": branch.ID.Hex()}, "")
+	expectStatus(t, rec, http.StatusOK)
+	branchToken := decode[struct{ Token string }](t, rec).Token
+	if got := decode[[]models.Appointment](t, e.do(http.MethodGet, "/api/appointments", nil, branchToken)); len(got) != 0 {
+		t.Fatalf("branch token sees the first clinic: %+v", got)
+	}
+	rec = e.do(http.MethodPost, "/api/clinics/"+e.clinic.ID.Hex()+"/switch", nil, branchToken)
+	expectStatus(t, rec, http.StatusOK)
+	if got := decode[[]models.Appointment](t, e.do(http.MethodGet, "/api/appointments", nil, decode[struct{ Token string }](t, rec).Token)); len(got) != 1 {
+		t.Fatalf("expected the first clinic's appointment after switching back, got %+v", got)
+	}
+	expectStatus(t, e.do(http.MethodPost, "/auth/login", gin.H{"email": patient.Email, "password": testPassword, "clinicId": branch.ID.Hex()}, ""), http.StatusForbidden)
+
+	// With several clinics, registration must name one
+	register := gin.H{"fullName": "Soa Rakoto", "email": "soa@example.com", "password": testPassword, "phone": "0341234570"}
+	expectStatus(t, e.do(http.MethodPost, "/auth/register", register, ""), http.StatusBadRequest)
+	register["clinicId"] = branch.ID.Hex()
+	rec = e.do(http.MethodPost, "/auth/register", register, "")
+	expectStatus(t, rec, http.StatusCreated)
+	if got := decode[models.User](t, rec); !got.InClinic(branch.ID) || len(got.ClinicIDs) != 1 {
+		t.Fatalf("unexpected clinics: %+v", got.ClinicIDs)
+	}
+}
+
+func TestClinicSettings(t *testing.T) {
+	e := newTestEnv(t)
+	_, adminToken := e.seedUser("admin")
+	_, staffToken := e.seedUser("staff")
+	_, patientToken := e.seedUser("client", func(u *models.User) { u.PhoneVerified = true })
+	path := "/api/admin/clinics/" + e.clinic.ID.Hex() + "/settings"
+
+	settings := gin.H{
+		"name":     "Analakely",
+		"address":  gin.H{"street": "12 Rue Andrianampoinimerina", "city": "Antananarivo", "postalCode": "101", "country": "MG"},
+		"timeZone": "Indian/Antananarivo",
+		"openingHours": []gin.H{
+			{"day": "monday", "open": "08:00", "close": "12:00"},
+			{"day": "monday", "open": "14:00", "close": "17:00"},
+		},
+		"contact":  gin.H{"email": "Contact@Analakely.example", "phone": "034 12 345 67"},
+		"currency": "MGA",
+		"services": []gin.H{
+			{"name": "Check-up", "price": 75000},
+			{"name": "Filling", "price": 150000, "maxPrice": 300000},
+		},
+		"cancellationPolicy": gin.H{"minNoticeHours": 24},
+	}
+	expectStatus(t, e.do(http.MethodPut, path, settings, staffToken), http.StatusForbidden)
+
+	rec := e.do(http.MethodPut, path, gin.H{
+		"name":         "Analakely",
+		"timeZone":     "Mars/Olympus",
+		"openingHours": []gin.H{{"day": "funday", "open": "17:00", "close": "08:00"}},
+		"currency":     "ariary",
+		"services":     []gin.H{{"name": "X-Ray", "price": 50}, {"name": "x-ray ", "price": 60, "maxPrice": 40}},
+	}, adminToken)
+	expectStatus(t, rec, http.StatusBadRequest)
+	if got := len(decode[apierror.Problem](t, rec).Errors); got != 6 {
+		t.Fatalf("expected 6 field errors, got %d: %s", got, rec.Body.String())
+	}
+	rec = e.do(http.MethodPut, path, gin.H{"name": "Analakely", "services": []gin.H{{"name": "X-Ray", "price": 50}}}, adminToken)
+	if p := decode[apierror.Problem](t, rec); len(p.Errors) != 1 || p.Errors[0].Field != "currency" {
+		t.Fatalf("prices without a currency: %s", rec.Body.String())
+	}
+
+	rec = e.do(http.MethodPut, path, settings, adminToken)
+	expectStatus(t, rec, http.StatusOK)
+	if got := decode[models.Clinic](t, rec); got.Settings.Contact.Phone != "+261341234567" || got.Settings.Contact.Email != "contact@analakely.example" {
+		t.Fatalf("contact not normalized: %+v", got.Settings.Contact)
+	}
+
+	rec = e.do(http.MethodGet, "/api/clinic", nil, patientToken)
+	expectStatus(t, rec, http.StatusOK)
+	if got := decode[models.Clinic](t, rec); got.Settings.TimeZone != "Indian/Antananarivo" || len(got.Settings.OpeningHours) != 2 {
+		t.Fatalf("unexpected clinic: %+v", got)
+	}
+
+	// Bookings are checked against the opening hours in the clinic's zone
+	loc, _ := time.LoadLocation("Indian/Antananarivo")
+	monday := time.Now().In(loc).AddDate(0, 0, 7)
+	for monday.Weekday() != time.Monday {
+		monday = monday.AddDate(0, 0, 1)
+	}
+	book := func(hour int) *httptest.ResponseRecorder {
+		start := time.Date(monday.Year(), monday.Month(), monday.Day(), hour, 0, 0, 0, loc)
+		return e.do(http.MethodPost, "/api/appointments", gin.H{
+			"startTime": start.UTC().Format(time.RFC3339),
+			"endTime":   start.Add(30 * time.Minute).UTC().Format(time.RFC3339),
+			"service":   "X-Ray",
+		}, patientToken)
+	}
+	rec = book(12)
+	expectStatus(t, rec, http.StatusBadRequest)
+	if p := decode[apierror.Problem](t, rec); len(p.Errors) != 1 || p.Errors[0].Code != "outside_opening_hours" {
+		t.Fatalf("unexpected problem: %+v", p)
+	}
+	rec = book(9)
+	expectStatus(t, rec, http.StatusCreated)
+	if len(e.notifier.messages) != 1 || !strings.Contains(e.notifier.messages[0], "at Analakely") || !strings.Contains(e.notifier.messages[0], "at 9:00 AM") {
+		t.Fatalf("unexpected SMS: %q", e.notifier.messages)
+	}
+
+	// Rescheduling is held to the same hours
+	booked := decode[models.Appointment](t, rec)
+	reschedule := func(day time.Time, hour int) *httptest.ResponseRecorder {
+		start := time.Date(day.Year(), day.Month(), day.Day(), hour, 0, 0, 0, loc)
+		return e.doWith(http.MethodPut, "/api/appointments/"+booked.ID.Hex(), gin.H{
+			"startTime": start.UTC().Format(time.RFC3339),
+			"endTime":   start.Add(30 * time.Minute).UTC().Format(time.RFC3339),
+		}, staffToken, http.Header{"If-Match": {`"1"`}})
+	}
+	for _, rec := range []*httptest.ResponseRecorder{reschedule(monday, 3), reschedule(monday.AddDate(0, 0, -1), 9)} {
+		expectStatus(t, rec, http.StatusBadRequest)
+		if p := decode[apierror.Problem](t, rec); len(p.Errors) != 1 || p.Errors[0].Code != "outside_opening_hours" {
+			t.Fatalf("unexpected problem: %+v", p)
+		}
+	}
+	expectStatus(t, reschedule(monday, 14), http.StatusOK)
+
+	// The assistant answers from the settings instead of hard-coded facts
+	expectStatus(t, e.do(http.MethodPost, "/api/chat", gin.H{"message": "Where are you?"}, patientToken), http.StatusOK)
+	prompt := e.chat.Requests()[0].System
+	for _, want := range []string{"12 Rue Andrianampoinimerina, 101 Antananarivo, MG", "monday 08:00-12:00 and 14:00-17:00", "+261341234567", "Check-up: 75000 MGA; Filling: 150000-300000 MGA", "24 hours"} {
+		if !strings.Contains(prompt, want) {
+			t.Fatalf("prompt is missing %q:\n%s", want, prompt)
+		}
+	}
+	// No prices the clinic did not set, and nothing to convert
+	for _, unwanted := range []string{"$", "USD", "convert"} {
+		if strings.Contains(prompt, unwanted) {
+			t.Fatalf("prompt mentions %q:\n%s", unwanted, prompt)
+		}
+	}
+}
+
+func TestChatQuotesClinicServices(t *testing.T) {
+	e := newTestEnv(t)
+	_, adminToken := e.seedUser("admin")
+	branch := &models.Clinic{ID: primitive.NewObjectID(), Name: "Tamatave", CreatedAt: time.Now()}
+	if err := e.repos.Clinics.Create(context.Background(), branch); err != nil {
+		t.Fatal(err)
+	}
+	for clinic, services := range map[*models.Clinic][]gin.H{
+		e.clinic: {{"name": "Whitening", "price": 400000}},
+		branch:   {{"name": "Implant", "price": 2500000, "maxPrice": 4000000}},
+	} {
+		expectStatus(t, e.do(http.MethodPut, "/api/admin/clinics/"+clinic.ID.Hex()+"/settings",
+			gin.H{"name": clinic.Name, "currency": "MGA", "services": services}, adminToken), http.StatusOK)
+	}
+	_, here := e.seedUser("client")
+	_, there := e.seedUser("client", func(u *models.User) { u.ClinicIDs = []primitive.ObjectID{branch.ID} })
+
+	// Each branch's assistant knows its own price list only
+	for _, token := range []string{here, there} {
+		expectStatus(t, e.do(http.MethodPost, "/api/chat", gin.H{"message": "How much?"}, token), http.StatusOK)
+	}
+	requests := e.chat.Requests()
+	if prompt := requests[0].System; !strings.Contains(prompt, "Whitening: 400000 MGA") || strings.Contains(prompt, "Implant") {
+		t.Fatalf("unexpected prompt for %s:\n%s", e.clinic.Name, prompt)
+	}
+	if prompt := requests[1].System; !strings.Contains(prompt, "Implant: 2500000-4000000 MGA") || strings.Contains(prompt, "Whitening") {
+		t.Fatalf("unexpected prompt for %s:\n%s", branch.Name, prompt)
+	}
+}
+
+func TestHandleChat(t *testing.T) {
+	e := newTestEnv(t)
+	_, token := e.seedUser("client")
+
+	expectStatus(t, e.do(http.MethodPost, "/api/chat", gin.H{"message": ""}, token), http.StatusBadRequest)
+
+	rec := e.do(http.MethodPost, "/api/chat", gin.H{"message": "How much is a cleaning?"}, token)
+	expectStatus(t, rec, http.StatusOK)
+	if got := decode[gin.H](t, rec); got["message"] != "echo: How much is a cleaning?" {
+		t.Fatalf("unexpected reply: %v", got)
+	}
+	if got := e.chat.Requests(); len(got) != 1 || !strings.Contains(got[0].System, "'Analakely' dental clinic") {
+		t.Fatalf("unexpected model requests: %+v", got)
+	}
+
+	e.chat.Err = errors.New("quota exceeded")
+	rec = e.do(http.MethodPost, "/api/chat", gin.H{"message": "hello"}, token)
+	expectStatus(t, rec, http.StatusInternalServerError)
+	if p := decode[apierror.Problem](t, rec); p.Code != apierror.CodeUpstream || strings.Contains(rec.Body.String(), "quota") {
+		t.Fatalf("unexpected problem: %s", rec.Body.String())
+	}
+}
+
+func TestChatConversations(t *testing.T) {
+	e := newTestEnv(t)
+	e.h.ChatHistory = 2
+	patient, token := e.seedUser("client")
+	_, otherToken := e.seedUser("client")
+
+	ask := func(message, conversationID string) string {
+		t.Helper()
+		rec := e.do(http.MethodPost, "/api/chat", gin.H{"message": message, "conversationId": conversationID}, token)
+		expectStatus(t, rec, http.StatusOK)
+		id, _ := decode[gin.H](t, rec)["conversationId"].(string)
+		return id
+	}
+	first := ask("How much is a filling?", "")
+	if first == "" {
+		t.Fatal("no conversation ID returned")
+	}
+	if got := ask("And the second one?", first); got != first {
+		t.Fatalf("follow-up moved to conversation %s", got)
+	}
+	ask("What about whitening?", first)
+
+	// Follow-ups carry the latest messages, up to ChatHistory
+	requests := e.chat.Requests()
+	if got := requests[1].Messages; len(got) != 3 || got[0].Text != "How much is a filling?" || got[1].Role != services.ChatRoleAssistant {
+		t.Fatalf("unexpected follow-up request: %+v", got)
+	}
+	if got := requests[2].Messages; len(got) != 3 || got[0].Text != "And the second one?" || got[2].Text != "What about whitening?" {
+		t.Fatalf("history not bounded: %+v", got)
+	}
+
+	second := ask("Are you open on Saturday?", "")
+	rec := e.do(http.MethodGet, "/api/chat/conversations", nil, token)
+	expectStatus(t, rec, http.StatusOK)
+	list := decode[[]ConversationSummary](t, rec)
+	if len(list) != 2 || list[0].ID.Hex() != second || list[1].MessageCount != 6 || list[1].Title != "How much is a filling?" {
+		t.Fatalf("unexpected conversations: %+v", list)
+	}
+
+	rec = e.do(http.MethodGet, "/api/chat/conversations/"+first, nil, token)
+	expectStatus(t, rec, http.StatusOK)
+	if conv := decode[models.Conversation](t, rec); conv.UserID != patient.ID || len(conv.Messages) != 6 || conv.Messages[5].Text != "echo: What about whitening?" {
+		t.Fatalf("unexpected conversation: %+v", conv)
+	}
+
+	// Conversations are private to their user
+	expectStatus(t, e.do(http.MethodGet, "/api/chat/conversations/"+first, nil, otherToken), http.StatusNotFound)
+	expectStatus(t, e.do(http.MethodPost, "/api/chat", gin.H{"message": "hi", "conversationId": first}, otherToken), http.StatusNotFound)
+	expectStatus(t, e.do(http.MethodDelete, "/api/chat/conversations/"+first, nil, otherToken), http.StatusNotFound)
+	if list := decode[[]ConversationSummary](t, e.do(http.MethodGet, "/api/chat/conversations", nil, otherToken)); len(list) != 0 {
+		t.Fatalf("saw someone else's conversations: %+v", list)
+	}
+
+	// A failed answer leaves the conversation as it was
+	e.chat.Err = errors.New("unavailable")
+	expectStatus(t, e.do(http.MethodPost, "/api/chat", gin.H{"message": "Still there?", "conversationId": second}, token), http.StatusInternalServerError)
+	e.chat.Err = nil
+	secondID, _ := primitive.ObjectIDFromHex(second)
+	if conv, _ := e.repos.Conversations.FindByID(e.ctx, secondID, patient.ID); len(conv.Messages) != 2 {
+		t.Fatalf("failed exchange was stored: %+v", conv.Messages)
+	}
+
+	expectStatus(t, e.do(http.MethodDelete, "/api/chat/conversations/"+first, nil, token), http.StatusNoContent)
+	expectStatus(t, e.do(http.MethodGet, "/api/chat/conversations/"+first, nil, token), http.StatusNotFound)
+	expectStatus(t, e.do(http.MethodPost, "/api/chat", gin.H{"message": "hi", "conversationId": "nope"}, token), http.StatusBadRequest)
+
+	// An odd window would open on an answer; it is cut to whole exchanges
+	e.h.ChatHistory = 3
+	third := ask("Do you take children?", "")
+	ask("From what age?", third)
+	ask("Is there a discount?", third)
+	requests = e.chat.Requests()
+	if got := requests[len(requests)-1].Messages; len(got) != 3 || got[0].Role != services.ChatRoleUser || got[0].Text != "From what age?" {
+		t.Fatalf("history does not start on a question: %+v", got)
+	}
+}
+
+// TestChatProviders runs the real providers against stand-in servers.
+func TestChatProviders(t *testing.T) {
+	e := newTestEnv(t)
+	_, token := e.seedUser("client")
+
+	var gemini struct {
+		SystemInstruction struct {
+			Parts []struct{ Text string }
+		}
+		Contents []struct {
+			Role  string
+			Parts []struct{ Text string }
+		}
+		GenerationConfig struct{ Temperature float64 }
+	}
+	geminiReply := "Gemini says hi"
+	geminiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("key") || r.Header.Get("x-goog-api-key") != "gemini-key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1beta/models/gemini-2.0-flash:generateContent" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&gemini)
+		if question := gemini.Contents[len(gemini.Contents)-1].Parts[0].Text; strings.HasPrefix(question, "reject") {
+			// Gemini quotes the offending input back
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(gin.H{"error": gin.H{"code": 400, "message": "Invalid value: " + question, "status": "INVALID_ARGUMENT"}})
+			return
+		}
+		json.NewEncoder(w).Encode(gin.H{"candidates": []gin.H{{
+			"content": gin.H{"role": "model", "parts": []gin.H{{"text": geminiReply}}},
+		}}})
+	}))
+	defer geminiServer.Close()
+	e.h.ChatModel = services.NewGeminiChatModel(config.Chat{
+		BaseURL: geminiServer.URL, GeminiAPIKey: "gemini-key", Model: "gemini-2.0-flash", Temperature: 0.2, Timeout: time.Second,
+	})
+
+	rec := e.do(http.MethodPost, "/api/chat", gin.H{"message": "hi"}, token)
+	expectStatus(t, rec, http.StatusOK)
+	if got := decode[gin.H](t, rec); got["message"] != "Gemini says hi" {
+		t.Fatalf("unexpected reply: %v", got)
+	}
+	if len(gemini.SystemInstruction.Parts) != 1 || len(gemini.Contents) != 1 || gemini.Contents[0].Role != "user" || gemini.GenerationConfig.Temperature != 0.2 {
+		t.Fatalf("unexpected Gemini request: %+v", gemini)
+	}
+
+	geminiReply = " \n "
+	rec = e.do(http.MethodPost, "/api/chat", gin.H{"message": "hi"}, token)
+	expectStatus(t, rec, http.StatusInternalServerError)
+	if p := decode[apierror.Problem](t, rec); p.Message != "AI returned an empty or invalid response" {
+		t.Fatalf("blank reply answered with %q", p.Message)
+	}
+
+	// Error bodies echo the prompt, so only their codes reach the logs
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+	rec = e.do(http.MethodPost, "/api/chat", gin.H{"message": "reject: my tooth 36 hurts since Monday"}, token)
+	expectStatus(t, rec, http.StatusInternalServerError)
+	slog.SetDefault(defaultLogger)
+	if !strings.Contains(logs.String(), "INVALID_ARGUMENT") || strings.Contains(logs.String(), "tooth 36") {
+		t.Fatalf("unexpected provider error log: %s", logs.String())
+	}
+
+	// OpenAI-compatible servers (e.g. Ollama) take the system prompt as a message
+	var openai struct {
+		Model       string
+		Temperature float64
+		Messages    []struct{ Role, Content string }
+	}
+	var authorization string
+	openaiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		if r.URL.Path == "/v1/models" {
+			w.Write([]byte(`{"data": []}`))
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&openai)
+		json.NewEncoder(w).Encode(gin.H{
+			"choices": []gin.H{{"message": gin.H{"role": "assistant", "content": "Ollama says hi"}}},
+			"usage":   gin.H{"prompt_tokens": 50, "completion_tokens": 3},
+		})
+	}))
+	defer openaiServer.Close()
+	e.h.ChatModel = services.NewOpenAIChatModel(config.Chat{BaseURL: openaiServer.URL + "/v1/", Model: "llama3.1", Timeout: time.Second})
+
+	rec = e.do(http.MethodPost, "/api/chat", gin.H{"message": "hi"}, token)
+	expectStatus(t, rec, http.StatusOK)
+	if got := decode[gin.H](t, rec); got["message"] != "Ollama says hi" {
+		t.Fatalf("unexpected reply: %v", got)
+	}
+	if openai.Model != "llama3.1" || len(openai.Messages) != 2 || openai.Messages[0].Role != "system" || openai.Messages[1].Content != "hi" {
+		t.Fatalf("unexpected OpenAI request: %+v", openai)
+	}
+	if authorization != "" {
+		t.Fatalf("no key is configured, yet sent %q", authorization)
+	}
+	if err := e.h.PingChat(context.Background()); err != nil {
+		t.Fatalf("PingChat: %v", err)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	e := newTestEnv(t)
+	e.h.Limiter = ratelimit.New(ratelimit.NewMemoryStore(), map[string]ratelimit.Policy{
+		ratelimit.RouteLogin:   {PerIP: ratelimit.Rate{Burst: 2, Period: time.Minute}},
+		ratelimit.RouteBooking: {PerUser: ratelimit.Rate{Burst: 1, Period: time.Hour}},
+		ratelimit.RouteVerify:  {PerUser: ratelimit.Rate{Burst: 2, Period: time.Hour}},
+	})
+	// Routes pick up the limiter when they are registered
+	e.router = gin.New()
+	e.router.SetTrustedProxies(nil)
+	e.router.Use(middleware.RequestID())
+	e.h.RegisterRoutes(e.router)
+
+	login := gin.H{"email": "nobody@example.com", "password": "wrong"}
+	for range 2 {
+		expectStatus(t, e.do(http.MethodPost, "/auth/login", login, ""), http.StatusUnauthorized)
+	}
+	rec := e.do(http.MethodPost, "/auth/login", login, "")
+	expectStatus(t, rec, http.StatusTooManyRequests)
+	if retry, err := strconv.Atoi(rec.Header().Get("Retry-After")); err != nil || retry < 1 || retry > 30 {
+		t.Fatalf("Retry-After = %q, want about 30 seconds", rec.Header().Get("Retry-After"))
+	}
+	if p := decode[apierror.Problem](t, rec); p.Code != apierror.CodeTooManyRequests {
+		t.Fatalf("unexpected problem: %+v", p)
+	}
+
+	// A forged X-Forwarded-For doesn't buy a fresh bucket...
+	spoofed := http.Header{"X-Forwarded-For": {"203.0.113.7"}}
+	expectStatus(t, e.doWith(http.MethodPost, "/auth/login", login, "", spoofed), http.StatusTooManyRequests)
+	// ...unless it comes from a trusted proxy (httptest connects from 192.0.2.1)
+	e.router.SetTrustedProxies([]string{"192.0.2.0/24"})
+	expectStatus(t, e.doWith(http.MethodPost, "/auth/login", login, "", spoofed), http.StatusUnauthorized)
+	e.router.SetTrustedProxies(nil)
+
+	// Booking is limited per user: one patient's quota doesn't block another
+	start := time.Now().Add(48 * time.Hour).UTC()
+	body := gin.H{
+		"startTime": start.Format(time.RFC3339),
+		"endTime":   start.Add(30 * time.Minute).Format(time.RFC3339),
+		"service":   "X-Ray",
+	}
+	_, alice := e.seedUser("client")
+	_, bob := e.seedUser("client")
+	expectStatus(t, e.do(http.MethodPost, "/api/appointments", body, alice), http.StatusCreated)
+	expectStatus(t, e.do(http.MethodPost, "/api/appointments", body, alice), http.StatusTooManyRequests)
+	expectStatus(t, e.do(http.MethodPost, "/api/appointments", body, bob), http.StatusCreated)
+
+	// So is checking phone codes, on top of the attempts a code allows
+	for range 2 {
+		expectStatus(t, e.do(http.MethodPost, "/api/user/phone/verify", gin.H{"code": "000000"}, alice), http.StatusBadRequest)
+	}
+	expectStatus(t, e.do(http.MethodPost, "/api/user/phone/verify", gin.H{"code": "000000"}, alice), http.StatusTooManyRequests)
+	expectStatus(t, e.do(http.MethodPost, "/api/user/phone/verify", gin.H{"code": "000000"}, bob), http.StatusBadRequest)
+
+	// Routes without a policy are never limited
+	for range 3 {
+		expectStatus(t, e.do(http.MethodPost, "/auth/resend-verification", gin.H{"email": "nobody@example.com"}, ""), http.StatusAccepted)
+	}
+}
+
+func TestHealthProbes(t *testing.T) {
+	e := newTestEnv(t)
+
+	expectStatus(t, e.do(http.MethodGet, "/healthz", nil, ""), http.StatusOK)
+
+	rec := e.do(http.MethodGet, "/version", nil, "")
+	expectStatus(t, rec, http.StatusOK)
+	if got := decode[version.Info](t, rec); got.Version == "" || got.GoVersion == "" {
+		t.Fatalf("unexpected version info: %+v", got)
+	}
+
+	var dbErr error
+	e.h.Health.Add(&health.Check{Name: "mongo", Critical: true, Run: func(context.Context) error { return dbErr }})
+	e.h.ChatModel = services.NewGeminiChatModel(config.Chat{})
+	e.h.Health.Add(&health.Check{Name: "chat", Run: e.h.PingChat}) // No API key: degraded
+
+	rec = e.do(http.MethodGet, "/readyz", nil, "")
+	expectStatus(t, rec, http.StatusOK)
+	report := decode[health.Report](t, rec)
+	if report.Status != health.StatusDegraded || report.Checks["chat"].Status != health.StatusFailing {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	dbErr = errors.New("connection refused")
+	rec = e.do(http.MethodGet, "/readyz", nil, "")
+	expectStatus(t, rec, http.StatusServiceUnavailable)
+	if report := decode[health.Report](t, rec); report.Checks["mongo"].Error != "connection refused" {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	// Draining fails readiness even when every dependency is fine
+	dbErr = nil
+	e.h.Health.SetDraining()
+	expectStatus(t, e.do(http.MethodGet, "/readyz", nil, ""), http.StatusServiceUnavailable)
+	expectStatus(t, e.do(http.MethodGet, "/healthz", nil, ""), http.StatusOK)
+}
+
+func TestPingChat(t *testing.T) {
+	e := newTestEnv(t)
+	if err := e.h.PingChat(context.Background()); err != nil {
+		t.Fatalf("PingChat with the fake model: %v", err)
+	}
+
+	var gotKey string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.Header.Get("x-goog-api-key")
+		if r.URL.Query().Has("key") || gotKey != "good-key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"name": "models/gemini-1.5-flash"}`))
+	}))
+	defer upstream.Close()
+
+	e.h.ChatModel = services.NewGeminiChatModel(config.Chat{BaseURL: upstream.URL, GeminiAPIKey: "good-key"})
+	if err := e.h.PingChat(context.Background()); err != nil {
+		t.Fatalf("PingChat: %v", err)
+	}
+	e.h.ChatModel = services.NewGeminiChatModel(config.Chat{BaseURL: upstream.URL, GeminiAPIKey: "revoked-key"})
+	if err := e.h.PingChat(context.Background()); err == nil {
+		t.Fatal("expected an error for a rejected key")
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	e := newTestEnv(t)
+	_, token := e.seedUser("client", func(u *models.User) { u.PhoneVerified = true })
+
+	start := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Second)
+	expectStatus(t, e.do(http.MethodPost, "/api/appointments", gin.H{
+		"startTime": start.Format(time.RFC3339),
+		"endTime":   start.Add(30 * time.Minute).Format(time.RFC3339),
+		"service":   "X-Ray",
+	}, token), http.StatusCreated)
+
+	rec := e.do(http.MethodGet, "/metrics", nil, "")
+	expectStatus(t, rec, http.StatusOK)
+	for _, want := range []string{
+		`dentist_http_requests_total{method="POST",route="/api/appointments",status="201"}`,
+		`dentist_appointments_booked_total`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("/metrics is missing %s", want)
+		}
+	}
+
+	// The scheduled gauge is read at scrape time, outside any clinic
+	other := &models.Clinic{ID: primitive.NewObjectID(), Name: "Ivandry", CreatedAt: time.Now()}
+	if err := e.repos.Clinics.Create(context.Background(), other); err != nil {
+		t.Fatal(err)
+	}
+	patient, _ := e.seedUser("client")
+	tomorrow := time.Now().Add(24 * time.Hour)
+	e.seedAppointment(patient, tomorrow, models.StatusScheduled)
+	elsewhere := &models.Appointment{ID: primitive.NewObjectID(), PatientID: patient.ID, StartTime: tomorrow, EndTime: tomorrow.Add(time.Hour), Status: models.StatusScheduled}
+	if err := e.repos.Appointments.Create(tenant.WithClinic(context.Background(), other.ID), elsewhere); err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics.NewScheduledAppointments(e.h.CountScheduledAppointments))
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduled := map[string]float64{}
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			scheduled[m.GetLabel()[0].GetValue()] = m.GetGauge().GetValue()
+		}
+	}
+	if scheduled["tomorrow"] != 2 {
+		t.Fatalf("unexpected scheduled gauge: %v", scheduled)
+	}
+
+	e.h.MetricsToken = "scrape-me"
+	expectStatus(t, e.do(http.MethodGet, "/metrics", nil, ""), http.StatusUnauthorized)
+	expectStatus(t, e.do(http.MethodGet, "/metrics", nil, "scrape-me"), http.StatusOK)
+}
+
+func TestRequestID(t *testing.T) {
+	e := newTestEnv(t)
+
+	// A caller-supplied ID is echoed in the header and in error bodies
+	req := httptest.NewRequest(http.MethodGet, "/api/appointments", nil)
+	req.Header.Set("X-Request-ID", "frontend-42")
+	rec := httptest.NewRecorder()
+	e.router.ServeHTTP(rec, req)
+	expectStatus(t, rec, http.StatusUnauthorized)
+	if got := rec.Header().Get("X-Request-ID"); got != "frontend-42" {
+		t.Fatalf("X-Request-ID = %q", got)
+	}
+	if body := decode[gin.H](t, rec); body["requestId"] != "frontend-42" {
+		t.Fatalf("error body lacks the request ID: %v", body)
+	}
+
+	// Otherwise, or when the supplied one is unusable, one is generated
+	req = httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	req.Header.Set("X-Request-ID", "has spaces")
+	rec = httptest.NewRecorder()
+	e.router.ServeHTTP(rec, req)
+	if got := rec.Header().Get("X-Request-ID"); len(got) != 32 {
+		t.Fatalf("generated X-Request-ID = %q", got)
+	}
+}
+
+func TestChatTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	e := newTestEnv(t)
+	_, token := e.seedUser("client")
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(gin.H{
+			"candidates":    []gin.H{{"content": gin.H{"parts": []gin.H{{"text": "Hello"}}}}},
+			"usageMetadata": gin.H{"promptTokenCount": 120, "candidatesTokenCount": 8},
+		})
+	}))
+	defer upstream.Close()
+	e.h.ChatModel = services.NewGeminiChatModel(config.Chat{BaseURL: upstream.URL, GeminiAPIKey: "key"})
+
+	expectStatus(t, e.do(http.MethodPost, "/api/chat", gin.H{"message": "hi"}, token), http.StatusOK)
+
+	var found bool
+	for _, span := range recorder.Ended() {
+		if span.Name() != "gemini.generateContent" {
+			continue
+		}
+		found = true
+		for _, attr := range span.Attributes() {
+			if attr.Key == "gen_ai.usage.input_tokens" && attr.Value.AsInt64() != 120 {
+				t.Errorf("input tokens = %d", attr.Value.AsInt64())
+			}
+		}
+	}
+	if !found {
+		t.Fatal("no span recorded for the Gemini call")
+	}
+}
+
+func TestErrorFormat(t *testing.T) {
+	e := newTestEnv(t)
+	patient, _ := e.seedUser("client")
+	_, staffToken := e.seedUser("staff")
+	apt := e.seedAppointment(patient, time.Date(2024, 7, 10, 9, 0, 0, 0, time.UTC), "Scheduled")
+
+	fields := func(p apierror.Problem) map[string]string {
+		m := map[string]string{}
+		for _, f := range p.Errors {
+			m[f.Field] = f.Code
+		}
+		return m
+	}
+
+	// Validator failures name the JSON fields instead of leaking Go struct names
+	rec := e.do(http.MethodPost, "/auth/register", gin.H{"fullName": "Rasoa", "email": "not-an-email", "password": "short"}, "")
+	expectStatus(t, rec, http.StatusBadRequest)
+	p := decode[apierror.Problem](t, rec)
+	if p.Code != apierror.CodeValidation || p.RequestID == "" || p.Error != p.Message {
+		t.Fatalf("unexpected problem: %+v", p)
+	}
+	if got := fields(p); got["email"] != "email" || got["password"] != "min" || got["phone"] != "required" {
+		t.Fatalf("unexpected field errors: %+v", p.Errors)
+	}
+	if strings.Contains(rec.Body.String(), "RegisterUserRequest") {
+		t.Fatalf("validator internals leaked: %s", rec.Body.String())
+	}
+
+	// Malformed JSON
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(`{"email": `))
+	rec = httptest.NewRecorder()
+	e.router.ServeHTTP(rec, req)
+	expectStatus(t, rec, http.StatusBadRequest)
+	if p := decode[apierror.Problem](t, rec); p.Code != apierror.CodeInvalidBody {
+		t.Fatalf("unexpected problem: %+v", p)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	// Unparsable times are rejected, not silently dropped, and nothing is saved
+	path := "/api/appointments/" + apt.ID.Hex()
+	ifMatch := http.Header{"If-Match": {`"1"`}}
+	rec = e.doWith(http.MethodPut, path, gin.H{"startTime": "tomorrow at 10", "status": "Done", "service": "Filling"}, staffToken, ifMatch)
+	expectStatus(t, rec, http.StatusBadRequest)
+	if got := fields(decode[apierror.Problem](t, rec)); got["startTime"] != "invalid_format" || got["status"] != "oneof" {
+		t.Fatalf("unexpected field errors: %v", got)
+	}
+	stored, _ := e.repos.Appointments.FindByID(e.ctx, apt.ID)
+	if stored.Service != "Teeth Cleaning" || !stored.StartTime.Equal(apt.StartTime) {
+		t.Fatalf("invalid update was partially applied: %+v", stored)
+	}
+
+	rec = e.doWith(http.MethodPut, path, gin.H{"endTime": "2024-07-10T08:00:00Z"}, staffToken, ifMatch)
+	expectStatus(t, rec, http.StatusBadRequest)
+	if got := fields(decode[apierror.Problem](t, rec)); got["endTime"] != "out_of_range" {
+		t.Fatalf("unexpected field errors: %v", got)
+	}
+
+	rec = e.do(http.MethodGet, "/api/appointments?startDate=07/01/2024", nil, staffToken)
+	expectStatus(t, rec, http.StatusBadRequest)
+	if got := fields(decode[apierror.Problem](t, rec)); got["startDate"] != "invalid_format" {
+		t.Fatalf("unexpected field errors: %v", got)
+	}
+}
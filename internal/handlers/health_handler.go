@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harentsoaR/dentist-api/internal/health"
+	"github.com/harentsoaR/dentist-api/internal/metrics"
+	"github.com/harentsoaR/dentist-api/internal/models"
+	"github.com/harentsoaR/dentist-api/internal/repository"
+	"github.com/harentsoaR/dentist-api/internal/tenant"
+	"github.com/harentsoaR/dentist-api/internal/version"
+)
+
+// Healthz is the liveness probe: the process is up and serving HTTP.
+// It checks no dependencies, so a database outage doesn't get us restarted.
+func (h *Handler) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": health.StatusOK})
+}
+
+// Readyz is the readiness probe. It returns 503 while draining for shutdown
+// or when a critical dependency (MongoDB) is down; a degraded optional
+// dependency (notifications, chat) is reported but still answers 200.
+func (h *Handler) Readyz(c *gin.Context) {
+	report := h.Health.Run(c.Request.Context())
+
+	status := http.StatusOK
+	if report.Status == health.StatusFailing {
+		status = http.StatusServiceUnavailable
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, report)
+}
+
+// Version reports the running build.
+func (h *Handler) Version(c *gin.Context) {
+	c.JSON(http.StatusOK, version.Get())
+}
+
+// Metrics serves Prometheus metrics. When MetricsToken is set the scraper
+// must send it as a bearer token, since the business gauges aren't public.
+func (h *Handler) Metrics(c *gin.Context) {
+	if h.MetricsToken != "" {
+		got := c.GetHeader("Authorization")
+		if subtle.ConstantTimeCompare([]byte(got), []byte("Bearer "+h.MetricsToken)) != 1 {
+			respondError(c, http.StatusUnauthorized, "Invalid metrics token")
+			return
+		}
+	}
+	metrics.Handler().ServeHTTP(c.Writer, c.Request)
+}
+
+// CountScheduledAppointments backs the dentist_appointments_scheduled gauge
+// (a metrics.AppointmentCounter). Scrapes carry no token, so it counts
+// every clinic.
+func (h *Handler) CountScheduledAppointments(ctx context.Context, from, to time.Time) (int64, error) {
+	return h.Appointments.Count(tenant.AllClinics(ctx), repository.AppointmentQuery{Status: models.StatusScheduled, From: &from, To: &to})
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harentsoaR/dentist-api/internal/apierror"
+	"github.com/harentsoaR/dentist-api/internal/models"
+	"github.com/harentsoaR/dentist-api/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Page sizes for list endpoints (?limit=).
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 500
+)
+
+// appointmentFields are the JSON fields ?fields= may select, with the stored
+// field each one is loaded from.
+var appointmentFields = map[string]string{
+	"id":          "_id",
+	"clinicId":    "clinicId",
+	"patientId":   "patientId",
+	"patientName": "patientName",
+	"startTime":   "startTime",
+	"endTime":     "endTime",
+	"service":     "service",
+	"status":      "status",
+	"notes":       "notes",
+}
+
+// pageRequest is what a client asked for with ?limit=&sort=&cursor=&fields=&total=.
+type pageRequest struct {
+	limit  int64
+	sort   string // "startTime" or "-startTime"
+	after  *repository.Cursor
+	fields []string // JSON names; empty = every field
+	total  bool
+}
+
+// pageCursor is the opaque ?cursor= value: the sort it belongs to and the
+// position of the last item of the previous page.
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// parsePage reads the pagination parameters. defaultSort applies when
+// ?sort= is absent; a leading "-" means descending.
+func parsePage(c *gin.Context, defaultSort string, v *apierror.Validation) pageRequest {
+	p := pageRequest{limit: DefaultPageSize, sort: defaultSort}
+
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 1 || n > MaxPageSize {
+			v.Add("limit", "out_of_range", fmt.Sprintf("must be between 1 and %d", MaxPageSize))
+		} else {
+			p.limit = n
+		}
+	}
+
+	if raw := c.Query("sort"); raw != "" {
+		if !slices.Contains(repository.AppointmentSortFields, strings.TrimPrefix(raw, "-")) {
+			v.Add("sort", "oneof", "must be one of: "+strings.Join(repository.AppointmentSortFields, ", ")+" (prefix with - for descending)")
+		} else {
+			p.sort = raw
+		}
+	}
+
+	if raw := c.Query("cursor"); raw != "" {
+		after, err := decodeCursor(raw, p.sort)
+		if err != nil {
+			v.Add("cursor", "invalid", err.Error())
+		}
+		p.after = after
+	}
+
+	if raw := c.Query("fields"); raw != "" {
+		for _, f := range strings.Split(raw, ",") {
+			f = strings.TrimSpace(f)
+			if _, ok := appointmentFields[f]; !ok {
+				v.Add("fields", "oneof", fmt.Sprintf("unknown field %q", f))
+				continue
+			}
+			p.fields = append(p.fields, f)
+		}
+	}
+
+	if raw := c.Query("total"); raw != "" {
+		total, err := strconv.ParseBool(raw)
+		if err != nil {
+			v.Add("total", "invalid_format", "must be true or false")
+		}
+		p.total = total
+	}
+	return p
+}
+
+// apply copies the page parameters onto q. One extra row is requested to
+// know whether there is a next page.
+func (p pageRequest) apply(q *repository.AppointmentQuery) {
+	q.SortBy = strings.TrimPrefix(p.sort, "-")
+	q.Descending = strings.HasPrefix(p.sort, "-")
+	q.After = p.after
+	q.Limit = p.limit + 1
+	for _, f := range p.fields {
+		q.Fields = append(q.Fields, appointmentFields[f])
+	}
+}
+
+// respondAppointmentPage writes one page of appointments. The body stays a
+// plain JSON array; paging details travel in headers:
+//
+//	Link: </api/appointments?cursor=...&limit=50>; rel="next"
+//	X-Next-Cursor: ...
+//	X-Total-Count: 1234   (only with ?total=true)
+func (h *Handler) respondAppointmentPage(c *gin.Context, q repository.AppointmentQuery, p pageRequest, appointments []models.Appointment) {
+	if p.total {
+		countQuery := q
+		countQuery.After = nil
+		total, err := h.Appointments.Count(c.Request.Context(), countQuery)
+		if err != nil {
+			fail(c, err)
+			return
+		}
+		c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	}
+
+	if int64(len(appointments)) > p.limit {
+		appointments = appointments[:p.limit]
+		cursor := encodeCursor(p.sort, &appointments[len(appointments)-1])
+		next := *c.Request.URL
+		params := next.Query()
+		params.Set("cursor", cursor)
+		next.RawQuery = params.Encode()
+		c.Header("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+		c.Header("X-Next-Cursor", cursor)
+	}
+
+	if len(p.fields) == 0 {
+		c.JSON(http.StatusOK, appointments)
+		return
+	}
+	projected, err := projectFields(appointments, p.fields)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, projected)
+}
+
+// projectFields keeps only the requested JSON fields of each item.
+func projectFields[T any](items []T, fields []string) ([]map[string]json.RawMessage, error) {
+	out := make([]map[string]json.RawMessage, 0, len(items))
+	for _, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(data, &all); err != nil {
+			return nil, err
+		}
+		picked := make(map[string]json.RawMessage, len(fields))
+		for _, f := range fields {
+			if v, ok := all[f]; ok {
+				picked[f] = v
+			}
+		}
+		out = append(out, picked)
+	}
+	return out, nil
+}
+
+func encodeCursor(sort string, apt *models.Appointment) string {
+	cursor := pageCursor{Sort: sort, ID: apt.ID.Hex()}
+	switch strings.TrimPrefix(sort, "-") {
+	case "startTime":
+		cursor.Value = apt.StartTime.Format(time.RFC3339Nano)
+	case "endTime":
+		cursor.Value = apt.EndTime.Format(time.RFC3339Nano)
+	case "patientName":
+		cursor.Value = apt.PatientName
+	case "service":
+		cursor.Value = apt.Service
+	case "status":
+		cursor.Value = apt.Status
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(raw, sort string) (*repository.Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("is not a valid cursor")
+	}
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, fmt.Errorf("is not a valid cursor")
+	}
+	if cursor.Sort != sort {
+		return nil, fmt.Errorf("belongs to sort %q, not %q; start again without a cursor", cursor.Sort, sort)
+	}
+	id, err := primitive.ObjectIDFromHex(cursor.ID)
+	if err != nil {
+		return nil, fmt.Errorf("is not a valid cursor")
+	}
+
+	after := &repository.Cursor{ID: id, Value: cursor.Value}
+	if field := strings.TrimPrefix(sort, "-"); field == "startTime" || field == "endTime" {
+		t, err := time.Parse(time.RFC3339Nano, cursor.Value)
+		if err != nil {
+			return nil, fmt.Errorf("is not a valid cursor")
+		}
+		after.Value = t
+	}
+	return after, nil
+}
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harentsoaR/dentist-api/internal/models"
+	"github.com/harentsoaR/dentist-api/internal/repository"
+	"github.com/harentsoaR/dentist-api/internal/tenant"
+	"github.com/harentsoaR/dentist-api/internal/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DataExport is everything the API stores about a user, in every clinic they
+// belong to.
+type DataExport struct {
+	GeneratedAt   time.Time             `json:"generatedAt"`
+	Profile       *models.User          `json:"profile"`
+	Appointments  []models.Appointment  `json:"appointments"`
+	Conversations []models.Conversation `json:"conversations"` // With the chat assistant
+	Notifications []models.Notification `json:"notifications"` // SMS and emails sent, without their text
+	// Activity lists the audited changes made by the user or to their
+	// account, newest first.
+	Activity []models.AuditEntry `json:"activity"`
+}
+
+// --- EXPORT MY DATA ---
+
+// ExportMyData answers with the caller's DataExport, as JSON or, with
+// ?format=zip, as an archive holding one JSON file per section.
+func (h *Handler) ExportMyData(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		respondError(c, http.StatusBadRequest, "format must be json or zip")
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		respondError(c, http.StatusUnauthorized, "Invalid user ID in token")
+		return
+	}
+	export, err := h.buildExport(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			respondError(c, http.StatusNotFound, "User not found")
+			return
+		}
+		fail(c, err)
+		return
+	}
+
+	filename := fmt.Sprintf("personal-data-%s-%s", userID.Hex(), export.GeneratedAt.Format("20060102"))
+	c.Header("Cache-Control", "no-store")
+	if format == "json" {
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+		c.JSON(http.StatusOK, export)
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`.zip"`)
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", "application/zip")
+	archive := zip.NewWriter(c.Writer)
+	for _, file := range []struct {
+		name string
+		data any
+	}{
+		{"profile.json", export.Profile},
+		{"appointments.json", export.Appointments},
+		{"conversations.json", export.Conversations},
+		{"notifications.json", export.Notifications},
+		{"activity.json", export.Activity},
+	} {
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: export.GeneratedAt})
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		c.Error(err)
+	}
+}
+
+func (h *Handler) buildExport(ctx context.Context, userID primitive.ObjectID) (*DataExport, error) {
+	// The patient's data is theirs whichever clinic holds it
+	ctx = tenant.AllClinics(ctx)
+	user, err := h.Users.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	// Deleted appointments are still stored until the purge
+	appointments, err := h.Appointments.List(ctx, repository.AppointmentQuery{PatientID: &userID, IncludeDeleted: true})
+	if err != nil {
+		return nil, err
+	}
+	conversations, err := h.Conversations.List(ctx, userID, 0)
+	if err != nil {
+		return nil, err
+	}
+	notifications, err := h.Notifications.ListForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	export := &DataExport{
+		GeneratedAt:   time.Now().UTC(),
+		Profile:       user,
+		Appointments:  appointments,
+		Conversations: conversations,
+		Notifications: notifications,
+		Activity:      make([]models.AuditEntry, 0),
+	}
+	if h.Audit == nil {
+		return export, nil
+	}
+
+	byUser, err := h.Audit.List(ctx, repository.AuditQuery{ActorID: userID.Hex()})
+	if err != nil {
+		return nil, err
+	}
+	aboutUser, err := h.Audit.List(ctx, repository.AuditQuery{TargetType: models.AuditTargetUser, TargetID: userID.Hex()})
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range slices.Concat(byUser, aboutUser) {
+		if slices.ContainsFunc(export.Activity, func(e models.AuditEntry) bool { return e.ID == entry.ID }) {
+			continue
+		}
+		// The address staff worked from is theirs, not the patient's
+		if entry.ActorID != userID.Hex() {
+			entry.IP = ""
+		}
+		export.Activity = append(export.Activity, entry)
+	}
+	// ObjectIDs grow with time: newest first, as the audit log lists them
+	slices.SortFunc(export.Activity, func(a, b models.AuditEntry) int { return bytes.Compare(b.ID[:], a.ID[:]) })
+	return export, nil
+}
+
+// --- ERASE MY DATA ---
+
+// EraseMyData anonymizes the caller's account once they confirm with their
+// password. Appointments stay, under an anonymous name, because the clinic
+// must keep its clinical and billing records.
+func (h *Handler) EraseMyData(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req struct {
+		Password string `json:"password" binding:"required"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		respondError(c, http.StatusUnauthorized, "Invalid user ID in token")
+		return
+	}
+	user, err := h.Users.FindByID(ctx, userID)
+	if err != nil {
+		respondError(c, http.StatusNotFound, "User not found")
+		return
+	}
+	if !utils.CheckPasswordHash(req.Password, user.Password) {
+		respondError(c, http.StatusUnauthorized, "Invalid credentials")
+		return
+	}
+
+	if err := h.eraseUser(c, userID); err != nil {
+		fail(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// --- ERASE USER (Admin Only) ---
+
+// EraseUser is EraseMyData on behalf of a patient who asked the clinic. It
+// works on deleted accounts too.
+func (h *Handler) EraseUser(c *gin.Context) {
+	userRole, _ := c.Get("userRole")
+	if userRole != "admin" {
+		respondError(c, http.StatusForbidden, "Permission denied.")
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := h.eraseUser(c, userID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			respondError(c, http.StatusNotFound, "User not found")
+			return
+		}
+		fail(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// eraseUser anonymizes the account, the patient name on its appointments,
+// the recipient of the notifications sent and the values the audit log kept
+// of the account and appointments, and deletes the user's chats.
+// Every step can be repeated, so a failed erasure is completed by asking
+// again.
+func (h *Handler) eraseUser(c *gin.Context, userID primitive.ObjectID) error {
+	ctx := tenant.AllClinics(c.Request.Context())
+
+	if _, err := h.Users.Erase(ctx, userID, c.GetString("userID")); err != nil {
+		return err
+	}
+	appointmentIDs, err := h.Appointments.ErasePatient(ctx, userID, models.ErasedName)
+	if err != nil {
+		return err
+	}
+	if _, err := h.Conversations.DeleteForUser(ctx, userID); err != nil {
+		return err
+	}
+	if _, err := h.Notifications.AnonymizeForUser(ctx, userID); err != nil {
+		return err
+	}
+	for _, purpose := range []string{models.VerifyEmail, models.VerifyPhone} {
+		if err := h.Tokens.DeleteForUser(ctx, userID, purpose); err != nil {
+			return err
+		}
+	}
+
+	if h.Audit != nil {
+		if _, err := h.Audit.Redact(ctx, models.AuditTargetUser, []string{userID.Hex()}); err != nil {
+			return err
+		}
+		targets := make([]string, len(appointmentIDs))
+		for i, id := range appointmentIDs {
+			targets[i] = id.Hex()
+		}
+		if _, err := h.Audit.Redact(ctx, models.AuditTargetAppointment, targets, "patientName"); err != nil {
+			return err
+		}
+	}
+	h.recordAudit(c, models.AuditUserErased, models.AuditTargetUser, userID.Hex(), nil, nil)
+	return nil
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/harentsoaR/dentist-api/internal/middleware"
+	"github.com/harentsoaR/dentist-api/internal/ratelimit"
+)
+
+// RegisterRoutes mounts every API route on r. Global middleware (logging,
+// CORS, ...) is left to the caller.
+func (h *Handler) RegisterRoutes(r gin.IRouter) {
+	// Probes and build info, unauthenticated
+	r.GET("/healthz", h.Healthz)
+	r.GET("/readyz", h.Readyz)
+	r.GET("/version", h.Version)
+	r.GET("/metrics", h.Metrics)
+
+	r.GET("/.well-known/jwks.json", h.GetJWKS)
+
+	authRoutes := r.Group("/auth", middleware.Timeout(h.RequestTimeout))
+	{
+		authRoutes.POST("/register", middleware.RateLimit(h.Limiter, ratelimit.RouteRegister), h.RegisterUser)
+		authRoutes.POST("/login", middleware.RateLimit(h.Limiter, ratelimit.RouteLogin), h.Login)
+		authRoutes.POST("/verify-email", middleware.RateLimit(h.Limiter, ratelimit.RouteVerify), h.VerifyEmail)
+		authRoutes.POST("/resend-verification", middleware.RateLimit(h.Limiter, ratelimit.RouteResend), h.ResendVerificationEmail)
+	}
+
+	apiRoutes := r.Group("/api")
+	apiRoutes.Use(middleware.AuthMiddleware(h.Keys)) // Protect all /api routes
+
+	// The chat waits on the AI provider, so it gets its own, longer deadline
+	apiRoutes.POST("/chat", middleware.RateLimit(h.Limiter, ratelimit.RouteChat), middleware.Timeout(h.ChatTimeout), h.HandleChat)
+
+	apiRoutes = apiRoutes.Group("", middleware.Timeout(h.RequestTimeout))
+	{
+		// Appointment Routes
+		apiRoutes.GET("/appointments", h.GetAppointments)                                                                                                                      // Get appointments with filters
+		apiRoutes.POST("/appointments", middleware.Idempotency(h.Idempotency, h.IdempotencyTTL), middleware.RateLimit(h.Limiter, ratelimit.RouteBooking), h.CreateAppointment) // Create a new appointment
+		apiRoutes.GET("/appointments/:id", h.GetAppointmentByID)
+		apiRoutes.GET("/appointment/user/:id", h.GetAppointment)
+		apiRoutes.PUT("/appointments/:id", h.UpdateAppointment)          // Update an appointment (dentist/staff)
+		apiRoutes.PATCH("/appointments/:id/cancel", h.CancelAppointment) // Cancel an appointment (dentist/staff)
+		apiRoutes.DELETE("/appointments/:id", h.DeleteAppointment)       // Soft delete (dentist/staff/admin)
+
+		// Clinics: each token acts for one
+		apiRoutes.GET("/clinic", h.GetCurrentClinic) // The token's clinic and its settings
+		apiRoutes.GET("/clinics", h.GetClinics)
+		apiRoutes.POST("/clinics/:id/switch", h.SwitchClinic)
+		apiRoutes.POST("/admin/clinics", h.CreateClinic)
+		apiRoutes.PUT("/admin/clinics/:id/members/:userId", h.AddClinicMember)
+		apiRoutes.PUT("/admin/clinics/:id/settings", h.UpdateClinicSettings)
+
+		apiRoutes.GET("/search", h.Search)     // Patients and appointments (dentist/staff)
+		apiRoutes.GET("/audit", h.GetAuditLog) // Who changed what (admin, staff)
+
+		// other existing routes
+		apiRoutes.GET("/user/:id", h.GetCurrentUser)
+		apiRoutes.PUT("/user/:id", h.UpdateCurrentUser)
+		apiRoutes.POST("/user/phone/send-code", middleware.RateLimit(h.Limiter, ratelimit.RouteResend), h.SendPhoneVerificationCode)
+		apiRoutes.POST("/user/phone/verify", middleware.RateLimit(h.Limiter, ratelimit.RouteVerify), h.VerifyPhone)
+
+		// Personal data: export and erasure (self, or admin on request)
+		apiRoutes.GET("/user/me/export", h.ExportMyData)
+		apiRoutes.POST("/user/me/erase", h.EraseMyData)
+		apiRoutes.POST("/admin/users/:id/erase", h.EraseUser)
+
+		// Soft delete and restore (admin)
+		apiRoutes.DELETE("/users/:id", h.DeleteUser)
+		apiRoutes.PUT("/admin/users/:id/role", h.SetUserRole)
+		apiRoutes.POST("/admin/users/:id/restore", h.RestoreUser)
+		apiRoutes.POST("/admin/appointments/:id/restore", h.RestoreAppointment)
+
+		// Chat history of the current clinic
+		apiRoutes.GET("/chat/conversations", h.GetConversations)
+		apiRoutes.GET("/chat/conversations/:id", h.GetConversation)
+		apiRoutes.DELETE("/chat/conversations/:id", h.DeleteConversation)
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harentsoaR/dentist-api/internal/apierror"
+	"github.com/harentsoaR/dentist-api/internal/utils"
+)
+
+// Results per kind for GET /api/search (?limit=).
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+// --- SEARCH (Dentist/Staff Only) ---
+
+// Search looks up patients (name, email, phone) and appointments (patient
+// name, service, notes). Matching ignores case and accents, so "Rabe" finds
+// "Rabé"; whole words must match. Results are ranked, best first.
+func (h *Handler) Search(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userRole, _ := c.Get("userRole")
+	if userRole != "dentist" && userRole != "staff" {
+		respondError(c, http.StatusForbidden, "Permission denied.")
+		return
+	}
+
+	var v apierror.Validation
+	text := strings.TrimSpace(c.Query("q"))
+	if utf8.RuneCountInString(text) < 2 {
+		v.Add("q", "min", "must be at least 2 characters")
+	}
+	limit := int64(DefaultSearchLimit)
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 1 || n > MaxSearchLimit {
+			v.Add("limit", "out_of_range", fmt.Sprintf("must be between 1 and %d", MaxSearchLimit))
+		}
+		limit = n
+	}
+	if err := v.Err(); err != nil {
+		fail(c, err)
+		return
+	}
+
+	// Phones are stored in E.164: "034 12 345 67" must also find +261341234567
+	if phone, err := utils.NormalizePhone(text, h.DefaultPhoneCountry); err == nil {
+		text += " " + strings.TrimPrefix(phone, "+")
+	}
+
+	patients, err := h.Users.SearchPatients(ctx, text, limit)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	appointments, err := h.Appointments.Search(ctx, text, limit)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"patients": patients, "appointments": appointments})
+}
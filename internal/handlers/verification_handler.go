@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harentsoaR/dentist-api/internal/apierror"
+	"github.com/harentsoaR/dentist-api/internal/models"
+	"github.com/harentsoaR/dentist-api/internal/repository"
+	"github.com/harentsoaR/dentist-api/internal/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	emailTokenTTL       = 24 * time.Hour
+	resendEmailCooldown = time.Minute
+
+	phoneCodeLength      = 6
+	phoneCodeTTL         = 10 * time.Minute
+	resendPhoneCooldown  = time.Minute
+	maxPhoneCodeAttempts = 5
+)
+
+// storeVerificationToken replaces any pending token of the same purpose for
+// the user with a new one.
+func (h *Handler) storeVerificationToken(ctx context.Context, userID primitive.ObjectID, purpose, hash string, ttl time.Duration) error {
+	now := time.Now()
+	return h.Tokens.Replace(ctx, &models.VerificationToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hash,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	})
+}
+
+// recentlyIssued reports whether a token of this purpose was sent within the cooldown.
+func (h *Handler) recentlyIssued(ctx context.Context, userID primitive.ObjectID, purpose string, cooldown time.Duration) bool {
+	recent, err := h.Tokens.IssuedSince(ctx, userID, purpose, time.Now().Add(-cooldown))
+	return err == nil && recent
+}
+
+// issueEmailVerification replaces any pending email token for the user and
+// sends a fresh one.
+func (h *Handler) issueEmailVerification(ctx context.Context, user *models.User) error {
+	token, hash, err := utils.GenerateToken()
+	if err != nil {
+		return err
+	}
+	if err := h.storeVerificationToken(ctx, user.ID, models.VerifyEmail, hash, emailTokenTTL); err != nil {
+		return err
+	}
+
+	h.NotificationSvc.SendEmailVerification(ctx, user, token)
+	return nil
+}
+
+// VerifyEmail marks the user's email as verified when the token is valid.
+func (h *Handler) VerifyEmail(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	vt, err := h.Tokens.FindByHash(ctx, models.VerifyEmail, utils.HashToken(req.Token))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid or expired verification token")
+		return
+	}
+
+	user, err := h.Users.FindByID(ctx, vt.UserID)
+	if err != nil {
+		respondError(c, http.StatusNotFound, "User not found")
+		return
+	}
+	before := *user
+	user.EmailVerified = true
+	if err := h.Users.Update(ctx, user); err != nil {
+		fail(c, apierror.Internal("Failed to verify email", err))
+		return
+	}
+	h.recordAudit(c, models.AuditUserEmailVerified, models.AuditTargetUser, user.ID.Hex(), &before, user)
+
+	// Tokens are single use
+	h.Tokens.DeleteForUser(ctx, vt.UserID, models.VerifyEmail)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerificationEmail sends a new verification link. It always answers
+// the same way so it cannot be used to discover registered addresses.
+func (h *Handler) ResendVerificationEmail(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	accepted := gin.H{"message": "If this account exists and is not yet verified, a new verification email has been sent"}
+
+	user, err := h.Users.FindByEmail(ctx, normalizeEmail(req.Email))
+	if err != nil || user.EmailVerified {
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	}
+
+	// Don't let the endpoint be used to flood someone's inbox
+	if h.recentlyIssued(ctx, user.ID, models.VerifyEmail, resendEmailCooldown) {
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	}
+
+	if err := h.issueEmailVerification(ctx, user); err != nil {
+		slog.ErrorContext(ctx, "failed to issue verification email", "user_id", user.ID.Hex(), "error", err)
+		fail(c, apierror.Internal("Failed to send verification email", err))
+		return
+	}
+
+	c.JSON(http.StatusAccepted, accepted)
+}
+
+// phoneCodeHash binds the code to the user so equal codes never collide.
+func phoneCodeHash(userID primitive.ObjectID, code string) string {
+	return utils.HashToken(userID.Hex() + ":" + code)
+}
+
+// issuePhoneVerification replaces any pending SMS code for the user and texts a fresh one.
+func (h *Handler) issuePhoneVerification(ctx context.Context, user *models.User) error {
+	code, err := utils.GenerateOTP(phoneCodeLength)
+	if err != nil {
+		return err
+	}
+	if err := h.storeVerificationToken(ctx, user.ID, models.VerifyPhone, phoneCodeHash(user.ID, code), phoneCodeTTL); err != nil {
+		return err
+	}
+
+	h.NotificationSvc.SendPhoneVerificationCode(ctx, user, code)
+	return nil
+}
+
+// SendPhoneVerificationCode texts a one-time code to the current user's phone.
+func (h *Handler) SendPhoneVerificationCode(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userIDHex, _ := c.Get("userID")
+	userID, err := primitive.ObjectIDFromHex(userIDHex.(string))
+	if err != nil {
+		respondError(c, http.StatusUnauthorized, "Invalid user ID in token")
+		return
+	}
+
+	user, err := h.Users.FindByID(ctx, userID)
+	if err != nil {
+		respondError(c, http.StatusNotFound, "User not found")
+		return
+	}
+	if user.Phone == "" {
+		respondError(c, http.StatusBadRequest, "No phone number on this account")
+		return
+	}
+	if user.PhoneVerified {
+		c.JSON(http.StatusOK, gin.H{"message": "Phone number already verified"})
+		return
+	}
+	if h.recentlyIssued(ctx, user.ID, models.VerifyPhone, resendPhoneCooldown) {
+		respondError(c, http.StatusTooManyRequests, "Please wait a minute before requesting a new code")
+		return
+	}
+
+	if err := h.issuePhoneVerification(ctx, user); err != nil {
+		slog.ErrorContext(ctx, "failed to issue phone verification", "user_id", user.ID.Hex(), "error", err)
+		fail(c, apierror.Internal("Failed to send verification code", err))
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Verification code sent"})
+}
+
+// VerifyPhone checks the SMS code and marks the current user's phone as verified.
+func (h *Handler) VerifyPhone(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userIDHex, _ := c.Get("userID")
+	userID, err := primitive.ObjectIDFromHex(userIDHex.(string))
+	if err != nil {
+		respondError(c, http.StatusUnauthorized, "Invalid user ID in token")
+		return
+	}
+
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	vt, err := h.Tokens.FindForUser(ctx, userID, models.VerifyPhone)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "No pending verification code, please request a new one")
+		return
+	}
+
+	// Every try is counted before the code is compared, in one conditional
+	// update, so concurrent guesses cannot get past the limit
+	if err := h.Tokens.IncrementAttempts(ctx, vt.ID, maxPhoneCodeAttempts); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			h.Tokens.DeleteForUser(ctx, userID, models.VerifyPhone)
+			respondError(c, http.StatusBadRequest, "Too many attempts, please request a new code")
+			return
+		}
+		fail(c, err)
+		return
+	}
+
+	if vt.TokenHash != phoneCodeHash(userID, strings.TrimSpace(req.Code)) {
+		respondError(c, http.StatusBadRequest, "Incorrect verification code")
+		return
+	}
+
+	user, err := h.Users.FindByID(ctx, userID)
+	if err != nil {
+		respondError(c, http.StatusNotFound, "User not found")
+		return
+	}
+	before := *user
+	user.PhoneVerified = true
+	if err := h.Users.Update(ctx, user); err != nil {
+		fail(c, apierror.Internal("Failed to verify phone number", err))
+		return
+	}
+	h.recordAudit(c, models.AuditUserPhoneVerified, models.AuditTargetUser, user.ID.Hex(), &before, user)
+	h.Tokens.DeleteForUser(ctx, userID, models.VerifyPhone)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Phone number verified successfully"})
+}
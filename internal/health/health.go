@@ -0,0 +1,123 @@
+// Package health runs the readiness checks behind /readyz.
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusOK       Status = "ok"
+	StatusDegraded Status = "degraded" // A non-critical dependency is down; keep serving
+	StatusFailing  Status = "failing"  // Take the instance out of rotation
+)
+
+// Check is one dependency probe. A failing critical check fails readiness; a
+// failing non-critical one only marks the instance degraded.
+type Check struct {
+	Name     string
+	Critical bool
+	// CacheFor reuses the last result for this long, for probes that cost
+	// money or quota (e.g. the AI provider).
+	CacheFor time.Duration
+	Run      func(ctx context.Context) error
+
+	mu       sync.Mutex
+	last     CheckResult
+	lastTime time.Time
+}
+
+type CheckResult struct {
+	Status Status `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status   Status                 `json:"status"`
+	Draining bool                   `json:"draining,omitempty"`
+	Checks   map[string]CheckResult `json:"checks"`
+}
+
+// Checker holds the readiness checks and the draining flag.
+type Checker struct {
+	timeout  time.Duration
+	checks   []*Check
+	draining atomic.Bool
+}
+
+// NewChecker returns a checker whose probes each get at most timeout.
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+func (c *Checker) Add(check *Check) {
+	c.checks = append(c.checks, check)
+}
+
+// SetDraining makes readiness fail from now on, so load balancers stop
+// sending traffic while in-flight requests finish.
+func (c *Checker) SetDraining() {
+	c.draining.Store(true)
+}
+
+func (c *Checker) Draining() bool {
+	return c.draining.Load()
+}
+
+// Run executes every check concurrently and combines the results.
+func (c *Checker) Run(ctx context.Context) Report {
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(c.checks))}
+	if c.Draining() {
+		report.Status = StatusFailing
+		report.Draining = true
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := c.run(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[check.Name] = result
+			if result.Status == StatusFailing {
+				if check.Critical {
+					report.Status = StatusFailing
+				} else if report.Status == StatusOK {
+					report.Status = StatusDegraded
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check *Check) CheckResult {
+	check.mu.Lock()
+	defer check.mu.Unlock()
+	if check.CacheFor > 0 && !check.lastTime.IsZero() && time.Since(check.lastTime) < check.CacheFor {
+		return check.last
+	}
+
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	result := CheckResult{Status: StatusOK}
+	if err := check.Run(ctx); err != nil {
+		result = CheckResult{Status: StatusFailing, Error: err.Error()}
+	}
+	check.last, check.lastTime = result, time.Now()
+	return result
+}
@@ -0,0 +1,49 @@
+// Package jobs holds the API's periodic background work.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/harentsoaR/dentist-api/internal/repository"
+	"github.com/harentsoaR/dentist-api/internal/tenant"
+)
+
+// Purge removes for good the users and appointments that were soft-deleted
+// more than Retention ago. Until then an admin can still restore them.
+type Purge struct {
+	Users        repository.UserRepository
+	Appointments repository.AppointmentRepository
+	Retention    time.Duration
+}
+
+// RunOnce purges everything past retention. Running it on several instances
+// at once is harmless.
+func (p *Purge) RunOnce(ctx context.Context) error {
+	ctx = tenant.AllClinics(ctx)
+	cutoff := time.Now().Add(-p.Retention)
+	users, errUsers := p.Users.PurgeDeleted(ctx, cutoff)
+	appointments, errAppointments := p.Appointments.PurgeDeleted(ctx, cutoff)
+	if users > 0 || appointments > 0 {
+		slog.InfoContext(ctx, "purged deleted records", "users", users, "appointments", appointments, "deleted_before", cutoff)
+	}
+	return errors.Join(errUsers, errAppointments)
+}
+
+// Run calls RunOnce every interval until ctx is done.
+func (p *Purge) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := p.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "purge of deleted records failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
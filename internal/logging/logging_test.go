@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestRedactedRecord(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "json", "info")
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	logger.InfoContext(ctx, "SMS sent to +261341234567 for rasoa@example.com",
+		"phone", "+261341234567",
+		"email", "rasoa@example.com",
+		"token", "short",
+		"user_id", "66a1b2c3d4e5f60718293a4b",
+		"error", errors.New("link https://app/verify?token=Zm9vYmFyYmF6cXV4cXV1eGNvcmdlZ3JhdWx0Z2FycGx5"),
+	)
+
+	var record map[string]string
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"msg":        "SMS sent to +*********567 for r***@example.com",
+		"phone":      "+*********567",
+		"email":      "r***@example.com",
+		"token":      "[REDACTED]",
+		"user_id":    "66a1b2c3d4e5f60718293a4b",
+		"request_id": "req-1",
+		"error":      "link https://app/verify?token=[REDACTED]",
+	}
+	for k, v := range want {
+		if record[k] != v {
+			t.Errorf("%s = %q, want %q", k, record[k], v)
+		}
+	}
+}
+
+func TestRedactLeavesOrdinaryText(t *testing.T) {
+	for _, s := range []string{
+		"appointments for 2024-07-01 at 09:30",
+		"user 66a1b2c3d4e5f60718293a4b updated",
+		"took 1500ms",
+	} {
+		if got := Redact(s); got != s {
+			t.Errorf("Redact(%q) = %q", s, got)
+		}
+	}
+	if got := Redact("call 034 12 345 67"); !strings.HasSuffix(got, "567") || strings.Contains(got, "12 345") {
+		t.Errorf("national number not masked: %q", got)
+	}
+}
+
+func TestTraceIDsInRecord(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "json", "info")
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled,
+	}))
+	logger.InfoContext(ctx, "booking created")
+
+	var record map[string]string
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["trace_id"] != traceID.String() || record["span_id"] != spanID.String() {
+		t.Fatalf("trace IDs missing from %v", record)
+	}
+}
@@ -0,0 +1,96 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Attribute keys whose values are masked whatever they contain.
+var (
+	phoneKeys  = []string{"phone", "to_phone"}
+	emailKeys  = []string{"email", "to_email"}
+	secretKeys = []string{"token", "code", "password", "secret", "authorization", "api_key", "key"}
+	// Identifiers we generate ourselves; they look like tokens but aren't secret.
+	safeKeys = []string{"request_id", "trace_id", "span_id", "user_id", "appointment_id"}
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// International or national numbers of 8+ digits, optionally spaced. The
+	// word boundaries keep digit runs inside hex IDs from matching.
+	phonePattern = regexp.MustCompile(`(?:\+|\b)\d(?: ?\d){7,14}\b`)
+	// Long opaque strings: verification tokens, JWTs, API keys
+	tokenPattern = regexp.MustCompile(`[A-Za-z0-9_\-]{32,}(?:\.[A-Za-z0-9_\-]+){0,2}`)
+)
+
+// redactAttr is the slog ReplaceAttr hook. Sensitive keys are masked
+// outright; every other string (the message included) is scanned for
+// emails, phone numbers and tokens.
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindAny {
+		if err, ok := a.Value.Any().(error); ok {
+			a.Value = slog.StringValue(err.Error())
+		}
+	}
+	if a.Value.Kind() != slog.KindString {
+		return a
+	}
+
+	key := strings.ToLower(a.Key)
+	s := a.Value.String()
+	switch {
+	case s == "" || matchesKey(key, safeKeys):
+		return a
+	case matchesKey(key, phoneKeys):
+		return slog.String(a.Key, MaskPhone(s))
+	case matchesKey(key, emailKeys):
+		return slog.String(a.Key, MaskEmail(s))
+	case matchesKey(key, secretKeys):
+		return slog.String(a.Key, "[REDACTED]")
+	}
+	return slog.String(a.Key, Redact(s))
+}
+
+func matchesKey(key string, keys []string) bool {
+	for _, k := range keys {
+		if key == k || strings.HasSuffix(key, "_"+k) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact masks every email, phone number and token-like string in s.
+func Redact(s string) string {
+	s = tokenPattern.ReplaceAllString(s, "[REDACTED]")
+	s = emailPattern.ReplaceAllStringFunc(s, MaskEmail)
+	return phonePattern.ReplaceAllStringFunc(s, MaskPhone)
+}
+
+// MaskPhone keeps the last three digits: +261341234567 -> +*********567.
+func MaskPhone(phone string) string {
+	var digits []byte
+	for i := 0; i < len(phone); i++ {
+		if phone[i] >= '0' && phone[i] <= '9' {
+			digits = append(digits, phone[i])
+		}
+	}
+	if len(digits) <= 3 {
+		return "***"
+	}
+	masked := strings.Repeat("*", len(digits)-3) + string(digits[len(digits)-3:])
+	if strings.HasPrefix(phone, "+") {
+		masked = "+" + masked
+	}
+	return masked
+}
+
+// MaskEmail keeps the first letter and the domain: rasoa@example.com -> r***@example.com.
+func MaskEmail(email string) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" {
+		return "***"
+	}
+	return local[:1] + "***@" + domain
+}
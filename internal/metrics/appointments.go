@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// AppointmentCounter counts scheduled appointments starting between from and
+// to, both inclusive like repository.AppointmentQuery.
+type AppointmentCounter func(ctx context.Context, from, to time.Time) (int64, error)
+
+// scheduledCollector reads the number of appointments scheduled for today
+// and tomorrow from the database at scrape time, so the gauge is right no
+// matter which instance took the booking.
+type scheduledCollector struct {
+	count   AppointmentCounter
+	timeout time.Duration
+	desc    *prometheus.Desc
+}
+
+// RegisterScheduledAppointments exposes dentist_appointments_scheduled{day}
+// for "today" and "tomorrow" (server time zone).
+func RegisterScheduledAppointments(count AppointmentCounter) error {
+	return Registry.Register(NewScheduledAppointments(count))
+}
+
+// NewScheduledAppointments is the collector RegisterScheduledAppointments
+// registers. count runs outside any request, so it must not depend on a
+// clinic in its context.
+func NewScheduledAppointments(count AppointmentCounter) prometheus.Collector {
+	return &scheduledCollector{
+		count:   count,
+		timeout: 5 * time.Second,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "appointments_scheduled"),
+			"Scheduled (not cancelled) appointments starting on the given day.",
+			[]string{"day"}, nil,
+		),
+	}
+}
+
+func (c *scheduledCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *scheduledCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for i, day := range []string{"today", "tomorrow"} {
+		from := today.AddDate(0, 0, i)
+		n, err := c.count(ctx, from, from.AddDate(0, 0, 1).Add(-time.Millisecond))
+		if err != nil {
+			slog.Error("metrics: counting appointments failed", "day", day, "error", err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n), day)
+	}
+}
@@ -0,0 +1,116 @@
+// Package metrics defines the Prometheus metrics served at /metrics. They are
+// registered on Registry rather than the global default so tests can read them
+// without interference from other packages.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "dentist"
+
+// Registry holds every metric exposed by the API, plus the Go runtime and
+// process collectors.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// --- HTTP ---
+
+var (
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route template, method and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route template and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+// --- MongoDB ---
+
+var MongoDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "mongo_command_duration_seconds",
+	Help:      "MongoDB command latency by command name and outcome.",
+	Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+}, []string{"command", "outcome"})
+
+// --- Notifications ---
+
+var NotificationsSent = factory.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "notifications_sent_total",
+	Help:      "Notification delivery attempts by channel (sms, email) and outcome (success, failure, skipped).",
+}, []string{"channel", "outcome"})
+
+// --- Rate limiting ---
+
+var RateLimited = factory.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "rate_limited_total",
+	Help:      "Requests refused with 429 by route policy (login, register, booking, chat).",
+}, []string{"route"})
+
+// --- AI chat ---
+
+var (
+	ChatUpstreamDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "chat_upstream_duration_seconds",
+		Help:      "Latency of calls to the AI provider by outcome.",
+		Buckets:   []float64{.25, .5, 1, 2, 4, 8, 15, 30, 45},
+	}, []string{"outcome"})
+
+	ChatTokens = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "chat_tokens_total",
+		Help:      "Tokens reported by the AI provider, by kind (prompt, completion).",
+	}, []string{"kind"})
+)
+
+// --- Business ---
+
+var (
+	AppointmentsBooked = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "appointments_booked_total",
+		Help:      "Appointments booked through the API; use increase(...[1d]) for bookings per day.",
+	})
+
+	AppointmentsCancelled = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "appointments_cancelled_total",
+		Help:      "Appointments cancelled through the API.",
+	})
+)
+
+// Outcome turns an error into the "outcome" label value.
+func Outcome(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
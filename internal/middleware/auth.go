@@ -5,27 +5,43 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/harentsoaR/dentist-api/internal/apierror"
+	"github.com/harentsoaR/dentist-api/internal/tenant"
 	"github.com/harentsoaR/dentist-api/internal/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware verifies the bearer token against the key set, including
+// its issuer and audience, before letting the request through.
+func AuthMiddleware(keys *utils.KeySet) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+			apierror.Respond(c, apierror.New(http.StatusUnauthorized, "", "Authorization header required"))
 			return
 		}
 
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		claims, err := utils.ValidateJWT(tokenString)
+		tokenString, ok := strings.CutPrefix(authHeader, "Bearer ")
+		if !ok {
+			apierror.Respond(c, apierror.New(http.StatusUnauthorized, "", "Authorization header must use the Bearer scheme"))
+			return
+		}
+
+		claims, err := keys.ValidateJWT(tokenString)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			apierror.Respond(c, apierror.New(http.StatusUnauthorized, "", "Invalid token"))
 			return
 		}
 
 		// Set user info in the context for handlers to use
 		c.Set("userID", claims.UserID)
 		c.Set("userRole", claims.Role)
+		c.Set("clinicID", claims.ClinicID)
+
+		// Scope storage to the token's clinic; without one, clinic data is refused
+		if clinicID, err := primitive.ObjectIDFromHex(claims.ClinicID); err == nil {
+			c.Request = c.Request.WithContext(tenant.WithClinic(c.Request.Context(), clinicID))
+		}
 
 		c.Next()
 	}
@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harentsoaR/dentist-api/internal/apierror"
+	"github.com/harentsoaR/dentist-api/internal/models"
+	"github.com/harentsoaR/dentist-api/internal/repository"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayHeader is set on responses replayed from a stored record.
+	IdempotentReplayHeader = "Idempotent-Replayed"
+
+	// idempotencyLock is how long a key stays reserved while its first
+	// request runs. If the instance dies mid-request the key frees itself.
+	idempotencyLock   = time.Minute
+	maxIdempotencyKey = 255
+)
+
+// Idempotency makes a POST safe to retry. The first request carrying an
+// Idempotency-Key runs normally and its response is kept for ttl; a retry
+// with the same key and body gets that response back without running the
+// handler again. Reusing a key with another body is a 422, and a retry
+// that arrives while the first request is still running is a 409.
+//
+// Keys are scoped to the user and route, so it must run after
+// AuthMiddleware. Server errors and 429s are not kept: the client should
+// be able to retry those for real. Requests without the header, or a nil
+// store, pass straight through.
+func Idempotency(store repository.IdempotencyRepository, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" || store == nil {
+			c.Next()
+			return
+		}
+		if !validIdempotencyKey(key) {
+			apierror.Respond(c, apierror.Invalid(IdempotencyKeyHeader, "invalid_format", "must be at most 255 printable ASCII characters"))
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			apierror.Respond(c, apierror.New(http.StatusBadRequest, apierror.CodeInvalidBody, "Could not read request body"))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		hash := hex.EncodeToString(sum[:])
+
+		ctx := c.Request.Context()
+		id := c.GetString("userID") + ":" + c.GetString("clinicID") + ":" + c.FullPath() + ":" + key
+		now := time.Now()
+		err = store.Reserve(ctx, &models.IdempotencyRecord{ID: id, RequestHash: hash, CreatedAt: now, ExpiresAt: now.Add(idempotencyLock)})
+		if errors.Is(err, repository.ErrDuplicate) {
+			replayIdempotent(c, store, id, hash)
+			return
+		}
+		if err != nil {
+			apierror.Respond(c, apierror.Internal("Could not check the Idempotency-Key", err))
+			return
+		}
+
+		recorder := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// The request's deadline may be spent by now
+		ctx = context.WithoutCancel(ctx)
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests {
+			err = store.Release(ctx, id)
+		} else {
+			header := recorder.Header()
+			err = store.Complete(ctx, id, models.IdempotentResponse{
+				Status:      status,
+				ContentType: header.Get("Content-Type"),
+				ETag:        header.Get("ETag"),
+				Location:    header.Get("Location"),
+				Body:        recorder.body.Bytes(),
+			}, time.Now().Add(ttl))
+		}
+		if err != nil {
+			slog.WarnContext(ctx, "failed to save idempotent response", "error", err)
+		}
+	}
+}
+
+// replayIdempotent answers a retry from the record of the first request.
+func replayIdempotent(c *gin.Context, store repository.IdempotencyRepository, id, hash string) {
+	rec, err := store.Find(c.Request.Context(), id)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		// Released or expired in between: let the client try again
+		c.Header("Retry-After", "1")
+		apierror.Respond(c, apierror.New(http.StatusConflict, "", "A request with this Idempotency-Key just finished, please retry"))
+	case err != nil:
+		apierror.Respond(c, apierror.Internal("Could not check the Idempotency-Key", err))
+	case rec.RequestHash != hash:
+		apierror.Respond(c, apierror.New(http.StatusUnprocessableEntity, "idempotency_key_reused", "This Idempotency-Key was already used with a different request body"))
+	case rec.Status == 0:
+		c.Header("Retry-After", "1")
+		apierror.Respond(c, apierror.New(http.StatusConflict, "", "A request with this Idempotency-Key is still being processed"))
+	default:
+		c.Header(IdempotentReplayHeader, "true")
+		if rec.ETag != "" {
+			c.Header("ETag", rec.ETag)
+		}
+		if rec.Location != "" {
+			c.Header("Location", rec.Location)
+		}
+		c.Data(rec.Status, rec.ContentType, rec.Body)
+		c.Abort()
+	}
+}
+
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKey {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// bodyRecorder keeps a copy of everything written to the response.
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harentsoaR/dentist-api/internal/models"
+	"github.com/harentsoaR/dentist-api/internal/repository"
+)
+
+// idempotencyRouter serves POST /bookings behind Idempotency, as the user
+// named in the X-User header. The handler counts its runs and answers 500
+// when the body asks it to fail.
+func idempotencyRouter(store repository.IdempotencyRepository, runs *int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	authenticate := func(c *gin.Context) {
+		c.Set("userID", c.GetHeader("X-User"))
+		c.Set("clinicID", "clinic-1")
+	}
+	r.POST("/bookings", authenticate, Idempotency(store, time.Hour), func(c *gin.Context) {
+		*runs++
+		body, _ := c.GetRawData()
+		if strings.Contains(string(body), "fail") {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "boom"})
+			return
+		}
+		c.Header("ETag", `"1"`)
+		c.Header("Location", "/bookings/"+strconv.Itoa(*runs))
+		c.JSON(http.StatusCreated, gin.H{"run": *runs})
+	})
+	return r
+}
+
+func postBooking(r *gin.Engine, user, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/bookings", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User", user)
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotency(t *testing.T) {
+	store := repository.NewMemoryIdempotencyRepository()
+	var runs int
+	r := idempotencyRouter(store, &runs)
+	body := `{"service":"X-Ray"}`
+
+	first := postBooking(r, "alice", "key-1", body)
+	if first.Code != http.StatusCreated || first.Header().Get(IdempotentReplayHeader) != "" {
+		t.Fatalf("first request: %d %v", first.Code, first.Header())
+	}
+
+	// The retry gets the same answer without running the handler again
+	retry := postBooking(r, "alice", "key-1", body)
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() || runs != 1 {
+		t.Fatalf("retry: %d %s after %d runs, want the first response", retry.Code, retry.Body.String(), runs)
+	}
+	if retry.Header().Get(IdempotentReplayHeader) != "true" {
+		t.Fatalf("unexpected replay headers: %v", retry.Header())
+	}
+	for _, name := range []string{"Content-Type", "ETag", "Location"} {
+		if got, want := retry.Header().Get(name), first.Header().Get(name); got == "" || got != want {
+			t.Errorf("replayed %s = %q, want %q", name, got, want)
+		}
+	}
+
+	// Another body under the same key is refused
+	if rec := postBooking(r, "alice", "key-1", `{"service":"Filling"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("reused key: %d, want 422", rec.Code)
+	}
+	// Keys belong to the user
+	if rec := postBooking(r, "bob", "key-1", body); rec.Code != http.StatusCreated || runs != 2 {
+		t.Fatalf("another user's key: %d after %d runs", rec.Code, runs)
+	}
+	// Without a key every request runs
+	postBooking(r, "alice", "", body)
+	postBooking(r, "alice", "", body)
+	if runs != 4 {
+		t.Fatalf("%d runs, want 4", runs)
+	}
+}
+
+func TestIdempotencyServerErrorsAreNotKept(t *testing.T) {
+	store := repository.NewMemoryIdempotencyRepository()
+	var runs int
+	r := idempotencyRouter(store, &runs)
+
+	for range 2 {
+		if rec := postBooking(r, "alice", "key-1", `{"fail":true}`); rec.Code != http.StatusInternalServerError {
+			t.Fatalf("status = %d, want 500", rec.Code)
+		}
+	}
+	if runs != 2 {
+		t.Fatalf("%d runs, want the retry to run again", runs)
+	}
+}
+
+func TestIdempotencyInFlight(t *testing.T) {
+	store := repository.NewMemoryIdempotencyRepository()
+	var runs int
+	r := idempotencyRouter(store, &runs)
+
+	// The first request holds the key until it completes
+	now := time.Now()
+	sum := sha256.Sum256([]byte(`{}`))
+	pending := &models.IdempotencyRecord{
+		ID:          "alice:clinic-1:/bookings:key-1",
+		RequestHash: hex.EncodeToString(sum[:]),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(time.Minute),
+	}
+	if err := store.Reserve(context.Background(), pending); err != nil {
+		t.Fatal(err)
+	}
+	rec := postBooking(r, "alice", "key-1", `{}`)
+	if rec.Code != http.StatusConflict || rec.Header().Get("Retry-After") != "1" || runs != 0 {
+		t.Fatalf("in-flight retry: %d %v after %d runs, want 409 with Retry-After", rec.Code, rec.Header(), runs)
+	}
+}
+
+func TestIdempotencyInvalidKey(t *testing.T) {
+	var runs int
+	r := idempotencyRouter(repository.NewMemoryIdempotencyRepository(), &runs)
+
+	for _, key := range []string{"key\x01", strings.Repeat("k", maxIdempotencyKey+1)} {
+		if rec := postBooking(r, "alice", key, `{}`); rec.Code != http.StatusBadRequest {
+			t.Errorf("key %q: status = %d, want 400", key, rec.Code)
+		}
+	}
+	if runs != 0 {
+		t.Fatalf("%d runs, want none", runs)
+	}
+}
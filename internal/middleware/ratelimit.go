@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harentsoaR/dentist-api/internal/apierror"
+	"github.com/harentsoaR/dentist-api/internal/metrics"
+	"github.com/harentsoaR/dentist-api/internal/ratelimit"
+)
+
+// RateLimit refuses the request with 429 and a Retry-After header once the
+// client's bucket for route is empty. Clients are the IP address and, after
+// AuthMiddleware, the user. A nil limiter disables the check.
+//
+// If the store fails the request goes through: better an unthrottled minute
+// than a clinic that cannot log in.
+func RateLimit(limiter *ratelimit.Limiter, route string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		allowed, retryAfter, err := limiter.Allow(ctx, route, c.ClientIP(), c.GetString("userID"))
+		if err != nil {
+			slog.WarnContext(ctx, "rate limit store unavailable, letting request through", "route", route, "error", err)
+		}
+		if !allowed {
+			metrics.RateLimited.WithLabelValues(route).Inc()
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			apierror.Respond(c, apierror.New(http.StatusTooManyRequests, "", "Too many requests, please try again later"))
+			return
+		}
+		c.Next()
+	}
+}
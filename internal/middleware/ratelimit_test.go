@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harentsoaR/dentist-api/internal/ratelimit"
+)
+
+func TestRateLimitRetryAfter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(), map[string]ratelimit.Policy{
+		ratelimit.RouteLogin: {PerIP: ratelimit.Rate{Burst: 1, Period: 90 * time.Second}},
+	})
+	r := gin.New()
+	r.POST("/login", RateLimit(limiter, ratelimit.RouteLogin), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	login := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/login", nil))
+		return rec
+	}
+
+	if rec := login(); rec.Code != http.StatusNoContent || rec.Header().Get("Retry-After") != "" {
+		t.Fatalf("first login: %d %v", rec.Code, rec.Header())
+	}
+	rec := login()
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", rec.Code)
+	}
+	// Whole seconds, rounded up so the client never retries too early
+	if retry, err := strconv.Atoi(rec.Header().Get("Retry-After")); err != nil || retry < 89 || retry > 90 {
+		t.Fatalf("Retry-After = %q, want 90 seconds", rec.Header().Get("Retry-After"))
+	}
+
+	// A nil limiter lets everything through
+	r = gin.New()
+	r.POST("/login", RateLimit(nil, ratelimit.RouteLogin), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	for range 3 {
+		if rec := login(); rec.Code != http.StatusNoContent {
+			t.Fatalf("status = %d without a limiter", rec.Code)
+		}
+	}
+}
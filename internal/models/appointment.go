@@ -8,10 +8,27 @@ import (
 
 type Appointment struct {
 	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ClinicID    primitive.ObjectID `bson:"clinicId" json:"clinicId"`
 	PatientID   primitive.ObjectID `bson:"patientId" json:"patientId"`
 	PatientName string             `bson:"patientName" json:"patientName"`
 	StartTime   time.Time          `bson:"startTime" json:"startTime"`
 	EndTime     time.Time          `bson:"endTime" json:"endTime"`
 	Service     string             `bson:"service" json:"service"`
 	Status      string             `bson:"status" json:"status"`
+	Notes       string             `bson:"notes,omitempty" json:"notes,omitempty"` // Free text from the patient or the clinic
+	Version     int64              `bson:"version" json:"version"`                 // Bumped on every update, served as the ETag
+
+	// Soft delete: set when the appointment is deleted, cleared on restore
+	DeletedAt *time.Time `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"`
+	DeletedBy string     `bson:"deletedBy,omitempty" json:"deletedBy,omitempty"` // ID of the user who deleted it
 }
+
+// Appointment statuses.
+const (
+	StatusScheduled = "Scheduled"
+	StatusCompleted = "Completed"
+	StatusCancelled = "Cancelled"
+)
+
+// AppointmentStatuses lists the values Status may take.
+var AppointmentStatuses = []string{StatusScheduled, StatusCompleted, StatusCancelled}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Audit actions.
+const (
+	AuditUserCreated          = "user.created"
+	AuditUserUpdated          = "user.updated"
+	AuditUserEmailVerified    = "user.email_verified"
+	AuditUserPhoneVerified    = "user.phone_verified"
+	AuditUserDeleted          = "user.deleted"
+	AuditUserRestored         = "user.restored"
+	AuditUserErased           = "user.erased"
+	AuditUserRoleChanged      = "user.role_changed"
+	AuditAppointmentCreated   = "appointment.created"
+	AuditAppointmentUpdated   = "appointment.updated"
+	AuditAppointmentCancelled = "appointment.cancelled"
+	AuditAppointmentDeleted   = "appointment.deleted"
+	AuditAppointmentRestored  = "appointment.restored"
+	AuditClinicUpdated        = "clinic.updated"
+)
+
+// Audit target types.
+const (
+	AuditTargetUser        = "user"
+	AuditTargetAppointment = "appointment"
+	AuditTargetClinic      = "clinic"
+)
+
+// AuditEntry records one change: who made it, to what, and which fields
+// moved from what to what. Entries are never modified, except that erasing
+// a user's personal data drops the values it appears in.
+type AuditEntry struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	At         time.Time          `bson:"at" json:"at"`
+	ClinicID   string             `bson:"clinicId,omitempty" json:"clinicId,omitempty"` // Clinic the actor was acting for
+	ActorID    string             `bson:"actorId,omitempty" json:"actorId,omitempty"`   // Empty for self-registration
+	ActorRole  string             `bson:"actorRole,omitempty" json:"actorRole,omitempty"`
+	Action     string             `bson:"action" json:"action"`
+	TargetType string             `bson:"targetType" json:"targetType"`
+	TargetID   string             `bson:"targetId" json:"targetId"`
+	Changes    []FieldChange      `bson:"changes,omitempty" json:"changes,omitempty"`
+	IP         string             `bson:"ip,omitempty" json:"ip,omitempty"`
+	RequestID  string             `bson:"requestId,omitempty" json:"requestId,omitempty"`
+	ExpiresAt  *time.Time         `bson:"expiresAt,omitempty" json:"-"` // Retention; nil = kept forever
+}
+
+// FieldChange is one field's value before and after, as it appears in the
+// API's JSON. From is absent on creation.
+type FieldChange struct {
+	Field string `bson:"field" json:"field"`
+	From  any    `bson:"from,omitempty" json:"from,omitempty"`
+	To    any    `bson:"to,omitempty" json:"to,omitempty"`
+}
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Clinic is one branch. Appointments belong to exactly one clinic; users
+// belong to the clinics listed in User.ClinicIDs.
+type Clinic struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name      string             `bson:"name" json:"name"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	Settings  ClinicSettings     `bson:"settings" json:"settings"`
+}
+
+// ClinicSettings are the facts patients ask about. Booking, notifications
+// and the chat assistant read them; empty fields mean "not configured".
+type ClinicSettings struct {
+	Address  *Address `bson:"address,omitempty" json:"address,omitempty"`
+	TimeZone string   `bson:"timeZone,omitempty" json:"timeZone,omitempty"` // IANA name, e.g. Indian/Antananarivo
+	// OpeningHours lists when appointments can be booked; none means any time
+	OpeningHours       []OpeningHours     `bson:"openingHours,omitempty" json:"openingHours,omitempty"`
+	Contact            ContactInfo        `bson:"contact" json:"contact"`
+	Currency           string             `bson:"currency,omitempty" json:"currency,omitempty"` // ISO 4217, e.g. MGA
+	Services           []ClinicService    `bson:"services,omitempty" json:"services,omitempty"` // Priced in Currency
+	CancellationPolicy CancellationPolicy `bson:"cancellationPolicy" json:"cancellationPolicy"`
+	UpdatedAt          *time.Time         `bson:"updatedAt,omitempty" json:"updatedAt,omitempty"`
+}
+
+// OpeningHours is one opening period, in the clinic's time zone. A day may
+// have several (e.g. a lunch break).
+type OpeningHours struct {
+	Day   string `bson:"day" json:"day"`     // "monday" ... "sunday"
+	Open  string `bson:"open" json:"open"`   // "09:00"
+	Close string `bson:"close" json:"close"` // "17:00", after Open
+}
+
+// ClinicService is a treatment the clinic offers and what it costs, in the
+// clinic's currency.
+type ClinicService struct {
+	Name  string  `bson:"name" json:"name"`
+	Price float64 `bson:"price" json:"price"`
+	// MaxPrice is the upper bound of a price that varies; 0 for a fixed price
+	MaxPrice float64 `bson:"maxPrice,omitempty" json:"maxPrice,omitempty"`
+}
+
+type ContactInfo struct {
+	Email   string `bson:"email,omitempty" json:"email,omitempty"`
+	Phone   string `bson:"phone,omitempty" json:"phone,omitempty"` // E.164
+	Website string `bson:"website,omitempty" json:"website,omitempty"`
+}
+
+type CancellationPolicy struct {
+	// MinNoticeHours is how long before the appointment patients must cancel
+	MinNoticeHours int    `bson:"minNoticeHours" json:"minNoticeHours"`
+	Description    string `bson:"description,omitempty" json:"description,omitempty"`
+}
+
+// Weekdays are the values OpeningHours.Day may take, Monday first.
+var Weekdays = []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+
+// ParseClock reads an "HH:MM" time of day as minutes since midnight.
+func ParseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an HH:MM time", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Location is the clinic's time zone; UTC when unset or unknown.
+func (s *ClinicSettings) Location() *time.Location {
+	if s.TimeZone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// IsOpen reports whether [start, end) falls within a single opening period.
+// Without opening hours the clinic is always open.
+func (s *ClinicSettings) IsOpen(start, end time.Time) bool {
+	if len(s.OpeningHours) == 0 {
+		return true
+	}
+	loc := s.Location()
+	start, end = start.In(loc), end.In(loc)
+	day := strings.ToLower(start.Weekday().String())
+	at := func(minutes int) time.Time {
+		return time.Date(start.Year(), start.Month(), start.Day(), minutes/60, minutes%60, 0, 0, loc)
+	}
+	for _, h := range s.OpeningHours {
+		if h.Day != day {
+			continue
+		}
+		opening, err1 := ParseClock(h.Open)
+		closing, err2 := ParseClock(h.Close)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		if !start.Before(at(opening)) && !end.After(at(closing)) {
+			return true
+		}
+	}
+	return false
+}
+
+// DescribeOpeningHours renders the opening hours for people, e.g.
+// "monday 09:00-12:00 and 14:00-17:00; tuesday 09:00-17:00".
+func (s *ClinicSettings) DescribeOpeningHours() string {
+	var days []string
+	for _, day := range Weekdays {
+		var periods []string
+		for _, h := range s.OpeningHours {
+			if h.Day == day {
+				periods = append(periods, h.Open+"-"+h.Close)
+			}
+		}
+		if len(periods) > 0 {
+			days = append(days, day+" "+strings.Join(periods, " and "))
+		}
+	}
+	return strings.Join(days, "; ")
+}
+
+// DescribeServices renders the price list for people, e.g.
+// "Check-up: 75000 MGA; Filling: 150000-300000 MGA".
+func (s *ClinicSettings) DescribeServices() string {
+	formatPrice := func(p float64) string { return strconv.FormatFloat(p, 'f', -1, 64) }
+	var services []string
+	for _, svc := range s.Services {
+		price := formatPrice(svc.Price)
+		if svc.MaxPrice > 0 {
+			price += "-" + formatPrice(svc.MaxPrice)
+		}
+		services = append(services, svc.Name+": "+price+" "+s.Currency)
+	}
+	return strings.Join(services, "; ")
+}
+
+// String formats the address on one line.
+func (a *Address) String() string {
+	var parts []string
+	for _, p := range []string{a.Street, a.PostalCode + " " + a.City, a.Region, a.Country} {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
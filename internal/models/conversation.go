@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Conversation is a patient's chat with the assistant of one clinic.
+type Conversation struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	ClinicID  primitive.ObjectID `bson:"clinicId" json:"clinicId"`
+	Title     string             `bson:"title" json:"title"` // The opening question, shortened
+	Messages  []ChatMessage      `bson:"messages" json:"messages"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// ChatMessage is one turn of a Conversation.
+type ChatMessage struct {
+	Role string    `bson:"role" json:"role"` // ChatRoleUser or ChatRoleAssistant
+	Text string    `bson:"text" json:"text"`
+	At   time.Time `bson:"at" json:"at"`
+}
+
+// Chat roles.
+const (
+	ChatRoleUser      = "user"
+	ChatRoleAssistant = "assistant"
+)
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// IdempotencyRecord remembers the response to a request sent with an
+// Idempotency-Key header so a retry gets the same answer instead of
+// repeating the side effects. Status is 0 while the first request is still
+// being handled.
+type IdempotencyRecord struct {
+	ID                 string `bson:"_id"`         // "<userID>:<clinicID>:<route>:<key>"
+	RequestHash        string `bson:"requestHash"` // SHA-256 of the request body
+	IdempotentResponse `bson:",inline"`
+	CreatedAt          time.Time `bson:"createdAt"`
+	ExpiresAt          time.Time `bson:"expiresAt"`
+}
+
+// IdempotentResponse is what a retry is answered with: the first response's
+// status, body and the headers that describe what it created.
+type IdempotentResponse struct {
+	Status      int    `bson:"status"`
+	ContentType string `bson:"contentType,omitempty"`
+	ETag        string `bson:"etag,omitempty"`     // Version of the created resource, for If-Match
+	Location    string `bson:"location,omitempty"` // Where the created resource lives
+	Body        []byte `bson:"body,omitempty"`
+}
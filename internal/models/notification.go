@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Notification records an SMS or email a provider accepted for delivery.
+// The message itself is not kept: Template says which one was sent.
+type Notification struct {
+	ID            primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID        primitive.ObjectID  `bson:"userId" json:"userId"`
+	ClinicID      primitive.ObjectID  `bson:"clinicId" json:"clinicId"`
+	Channel       string              `bson:"channel" json:"channel"`     // NotificationSMS or NotificationEmail
+	Recipient     string              `bson:"recipient" json:"recipient"` // Phone or email; empty once the user is erased
+	Template      string              `bson:"template" json:"template"`
+	AppointmentID *primitive.ObjectID `bson:"appointmentId,omitempty" json:"appointmentId,omitempty"`
+	SentAt        time.Time           `bson:"sentAt" json:"sentAt"`
+}
+
+// Notification channels.
+const (
+	NotificationSMS   = "sms"
+	NotificationEmail = "email"
+)
+
+// Notification templates.
+const (
+	TemplateAppointmentConfirmed = "appointment_confirmed"
+	TemplateAppointmentCancelled = "appointment_cancelled"
+	TemplateEmailVerification    = "email_verification"
+	TemplatePhoneVerification    = "phone_verification"
+)
@@ -1,12 +1,95 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AssignableRoles are the roles an admin may give a user. Self-registered
+// accounts are always "client".
+var AssignableRoles = []string{"client", "dentist", "staff"}
 
 type User struct {
-	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	FullName string             `bson:"fullName" json:"fullName"`
-	Email    string             `bson:"email" json:"email"`
-	Password string             `bson:"password" json:"-"`  // Hide from JSON responses
-	Role     string             `bson:"role" json:"role"`   // "client", "assistant", "dentist"
-	Phone    string             `bson:"phone" json:"phone"` // Optional, can be empty
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	FullName      string             `bson:"fullName" json:"fullName"`
+	Email         string             `bson:"email" json:"email"`
+	EmailVerified bool               `bson:"emailVerified" json:"emailVerified"`
+	Password      string             `bson:"password" json:"-"`  // Hide from JSON responses
+	Role          string             `bson:"role" json:"role"`   // One of AssignableRoles, or "admin" (granted in the database only)
+	Phone         string             `bson:"phone" json:"phone"` // E.164, e.g. +261341234567
+	PhoneVerified bool               `bson:"phoneVerified" json:"phoneVerified"`
+	// Clinics the user belongs to; patients usually have one, staff may work at several
+	ClinicIDs []primitive.ObjectID `bson:"clinicIds" json:"clinicIds"`
+
+	// Patient profile, all optional
+	DateOfBirth       *time.Time        `bson:"dateOfBirth,omitempty" json:"dateOfBirth,omitempty"`
+	Gender            string            `bson:"gender,omitempty" json:"gender,omitempty"` // "female", "male", "other"
+	Address           *Address          `bson:"address,omitempty" json:"address,omitempty"`
+	EmergencyContact  *EmergencyContact `bson:"emergencyContact,omitempty" json:"emergencyContact,omitempty"`
+	PreferredLanguage string            `bson:"preferredLanguage,omitempty" json:"preferredLanguage,omitempty"` // "fr", "mg", "en"
+	PreferredChannel  string            `bson:"preferredChannel,omitempty" json:"preferredChannel,omitempty"`   // "sms", "email"
+
+	// Soft delete: set when the account is deleted, cleared on restore
+	DeletedAt *time.Time `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"`
+	DeletedBy string     `bson:"deletedBy,omitempty" json:"deletedBy,omitempty"` // ID of the user who deleted it
+
+	// Set once the personal data has been erased; see Anonymize
+	ErasedAt *time.Time `bson:"erasedAt,omitempty" json:"erasedAt,omitempty"`
+}
+
+// ErasedName replaces the name of an erased user, on the account and on
+// their appointments.
+const ErasedName = "Erased user"
+
+type Address struct {
+	Street     string `bson:"street" json:"street"`
+	City       string `bson:"city" json:"city"`
+	PostalCode string `bson:"postalCode" json:"postalCode"`
+	Region     string `bson:"region,omitempty" json:"region,omitempty"`
+	Country    string `bson:"country" json:"country"`
+}
+
+type EmergencyContact struct {
+	Name         string `bson:"name" json:"name"`
+	Relationship string `bson:"relationship,omitempty" json:"relationship,omitempty"`
+	Phone        string `bson:"phone" json:"phone"` // E.164
+}
+
+// Allowed values for the profile enums.
+var (
+	Genders            = []string{"female", "male", "other"}
+	PreferredLanguages = []string{"fr", "mg", "en"}
+	PreferredChannels  = []string{"sms", "email"}
+)
+
+// Anonymize removes everything that identifies the user. The ID and role
+// stay so that the appointments pointing at the account, which the clinic
+// must keep, remain consistent. The account can no longer sign in.
+func (u *User) Anonymize(at time.Time) {
+	u.FullName = ErasedName
+	u.Email = "erased-" + u.ID.Hex() + "@erased.invalid" // Still unique, as the index requires
+	u.EmailVerified = false
+	u.Password = ""
+	u.Phone = ""
+	u.PhoneVerified = false
+	u.DateOfBirth = nil
+	u.Gender = ""
+	u.Address = nil
+	u.EmergencyContact = nil
+	u.PreferredLanguage = ""
+	u.PreferredChannel = ""
+	u.ErasedAt = &at
+}
+
+// InClinic reports whether the user belongs to the clinic.
+func (u *User) InClinic(clinicID primitive.ObjectID) bool {
+	return slices.Contains(u.ClinicIDs, clinicID)
+}
+
+// HasVerifiedContact reports whether the user has proven control of at least
+// one way to reach them.
+func (u *User) HasVerifiedContact() bool {
+	return u.EmailVerified || u.PhoneVerified
 }
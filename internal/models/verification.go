@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Verification purposes stored in VerificationToken.Purpose.
+const (
+	VerifyEmail = "email"
+	VerifyPhone = "phone"
+)
+
+// VerificationToken is a single-use secret proving control of a contact
+// channel. Only the SHA-256 hash of the secret is stored.
+type VerificationToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	Purpose   string             `bson:"purpose" json:"purpose"`
+	TokenHash string             `bson:"tokenHash" json:"-"`
+	Attempts  int                `bson:"attempts" json:"-"` // Failed guesses, for short numeric codes
+	ExpiresAt time.Time          `bson:"expiresAt" json:"expiresAt"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepEvery is how many Take calls pass between removals of full buckets.
+const sweepEvery = 1024
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	rate    Rate
+}
+
+// MemoryStore keeps buckets in the process. Limits are per instance.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+	now     func() time.Time // Overridable for tests
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, rate Rate) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.calls++
+	if s.calls%sweepEvery == 0 {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: rate.Burst, updated: now}
+		s.buckets[key] = b
+	}
+	b.rate = rate
+	b.tokens = min(rate.Burst, b.tokens+now.Sub(b.updated).Seconds()*rate.perSecond())
+	b.updated = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rate.perSecond() * float64(time.Second)), nil
+	}
+	b.tokens--
+	return true, 0, nil
+}
+
+// sweep forgets buckets that have refilled: a new one would start full anyway.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if now.Sub(b.updated) >= b.rate.Period {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps one document per bucket so every instance shares the
+// limits. Each Take is a single atomic upsert computed on the server, with
+// the server's clock. Idle buckets expire through the expiresAt TTL index.
+type MongoStore struct {
+	c *mongo.Collection
+}
+
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{c: db.Collection("rateLimits")}
+}
+
+func (s *MongoStore) Take(ctx context.Context, key string, rate Rate) (bool, time.Duration, error) {
+	perMs := rate.perSecond() / 1000
+	refilled := bson.M{"$min": bson.A{
+		rate.Burst,
+		bson.M{"$add": bson.A{
+			bson.M{"$ifNull": bson.A{"$tokens", rate.Burst}},
+			bson.M{"$multiply": bson.A{
+				bson.M{"$subtract": bson.A{"$$NOW", bson.M{"$ifNull": bson.A{"$updatedAt", "$$NOW"}}}},
+				perMs,
+			}},
+		}},
+	}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"tokens": refilled, "updatedAt": "$$NOW"}}},
+		{{Key: "$set", Value: bson.M{"allowed": bson.M{"$gte": bson.A{"$tokens", 1}}}}},
+		{{Key: "$set", Value: bson.M{
+			"tokens":    bson.M{"$cond": bson.A{"$allowed", bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens"}},
+			"expiresAt": bson.M{"$add": bson.A{"$$NOW", rate.Period.Milliseconds()}},
+		}}},
+	}
+
+	var doc struct {
+		Tokens  float64 `bson:"tokens"`
+		Allowed bool    `bson:"allowed"`
+	}
+	err := s.c.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&doc)
+	if err != nil {
+		return false, 0, err
+	}
+	if !doc.Allowed {
+		return false, time.Duration((1 - doc.Tokens) / rate.perSecond() * float64(time.Second)), nil
+	}
+	return true, 0, nil
+}
@@ -0,0 +1,127 @@
+// Package ratelimit throttles expensive or abusable routes with token
+// buckets. Each client (IP address or user) gets a bucket per route that
+// holds up to Rate.Burst requests and refills at Burst per Rate.Period, so
+// short bursts pass while sustained floods are cut off.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Routes with a configurable policy.
+const (
+	RouteLogin    = "login"
+	RouteRegister = "register"
+	RouteBooking  = "booking"
+	RouteChat     = "chat"
+	RouteVerify   = "verify" // Checking an email token or phone code
+	RouteResend   = "resend" // Sending a new email token or phone code
+)
+
+// Rate allows Burst requests at once, refilled evenly over Period. The zero
+// Rate means unlimited.
+type Rate struct {
+	Burst  float64
+	Period time.Duration
+}
+
+// Unlimited reports whether r lets everything through.
+func (r Rate) Unlimited() bool {
+	return r.Burst <= 0 || r.Period <= 0
+}
+
+// perSecond is the refill speed in tokens per second.
+func (r Rate) perSecond() float64 {
+	return r.Burst / r.Period.Seconds()
+}
+
+// ParseRate reads "count/period", e.g. "10/1m" or "100/h". An empty string
+// means unlimited.
+func ParseRate(s string) (Rate, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Rate{}, nil
+	}
+	count, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("rate %q must look like 10/1m", s)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || n < 1 {
+		return Rate{}, fmt.Errorf("rate %q: count must be a positive integer", s)
+	}
+	period = strings.TrimSpace(period)
+	d, err := time.ParseDuration(period)
+	if err != nil {
+		// "10/m" reads as "10/1m"
+		d, err = time.ParseDuration("1" + period)
+	}
+	if err != nil || d <= 0 {
+		return Rate{}, fmt.Errorf("rate %q: period must be a positive duration", s)
+	}
+	return Rate{Burst: float64(n), Period: d}, nil
+}
+
+// Policy is how a route is limited: per client IP, and per authenticated
+// user when there is one.
+type Policy struct {
+	PerIP   Rate
+	PerUser Rate
+}
+
+// Store keeps the buckets. MemoryStore suits a single instance; MongoStore
+// shares the buckets between instances.
+type Store interface {
+	// Take removes a token from the bucket named key, which starts full.
+	// When the bucket is empty it returns false and how long until the next
+	// token.
+	Take(ctx context.Context, key string, rate Rate) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// Limiter applies the per-route policies.
+type Limiter struct {
+	store    Store
+	policies map[string]Policy
+}
+
+// New returns a limiter; routes missing from policies are not limited.
+func New(store Store, policies map[string]Policy) *Limiter {
+	return &Limiter{store: store, policies: policies}
+}
+
+// Allow takes a token from every bucket the request counts against: the
+// IP's and, when userID is set, the user's. A request is refused if any
+// bucket is empty; retryAfter is the longest wait.
+func (l *Limiter) Allow(ctx context.Context, route, ip, userID string) (allowed bool, retryAfter time.Duration, err error) {
+	policy, ok := l.policies[route]
+	if !ok {
+		return true, 0, nil
+	}
+
+	allowed = true
+	var errs []error
+	take := func(key string, rate Rate) {
+		if rate.Unlimited() {
+			return
+		}
+		ok, wait, err := l.store.Take(ctx, route+":"+key, rate)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		if !ok {
+			allowed = false
+			retryAfter = max(retryAfter, wait)
+		}
+	}
+	take("ip:"+ip, policy.PerIP)
+	if userID != "" {
+		take("user:"+userID, policy.PerUser)
+	}
+	return allowed, retryAfter, errors.Join(errs...)
+}
@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Rate
+		wantErr bool
+	}{
+		{spec: "", want: Rate{}},
+		{spec: "10/1m", want: Rate{Burst: 10, Period: time.Minute}},
+		{spec: " 5 / 1h ", want: Rate{Burst: 5, Period: time.Hour}},
+		{spec: "100/h", want: Rate{Burst: 100, Period: time.Hour}},
+		{spec: "3/30s", want: Rate{Burst: 3, Period: 30 * time.Second}},
+		{spec: "10", wantErr: true},
+		{spec: "lots/1m", wantErr: true},
+		{spec: "0/1m", wantErr: true},
+		{spec: "-1/1m", wantErr: true},
+		{spec: "10/fortnight", wantErr: true},
+		{spec: "10/0s", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRate(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseRate(%q) = %+v, want an error", tt.spec, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseRate(%q) = %+v, %v; want %+v", tt.spec, got, err, tt.want)
+		}
+	}
+	if !(Rate{}).Unlimited() {
+		t.Error("the zero Rate must be unlimited")
+	}
+}
+
+func TestMemoryStoreRefill(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 7, 1, 9, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	rate := Rate{Burst: 2, Period: time.Minute} // A token every 30s
+
+	take := func() (bool, time.Duration) {
+		t.Helper()
+		ok, wait, err := s.Take(ctx, "login:ip:192.0.2.1", rate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok, wait
+	}
+
+	// The bucket starts full
+	for range 2 {
+		if ok, _ := take(); !ok {
+			t.Fatal("a new bucket must allow a burst")
+		}
+	}
+	ok, wait := take()
+	if ok || wait != 30*time.Second {
+		t.Fatalf("empty bucket: allowed = %v, retry after %v; want refused, 30s", ok, wait)
+	}
+
+	// Half a token later, the wait is half as long
+	now = now.Add(15 * time.Second)
+	if ok, wait := take(); ok || wait != 15*time.Second {
+		t.Fatalf("after 15s: allowed = %v, retry after %v; want refused, 15s", ok, wait)
+	}
+	now = now.Add(15 * time.Second)
+	if ok, _ := take(); !ok {
+		t.Fatal("a token must have refilled after 30s")
+	}
+
+	// Refilling stops at Burst
+	now = now.Add(time.Hour)
+	for range 2 {
+		if ok, _ := take(); !ok {
+			t.Fatal("a refilled bucket must allow a burst")
+		}
+	}
+	if ok, _ := take(); ok {
+		t.Fatal("a bucket must not hold more than Burst tokens")
+	}
+
+	// Other keys have buckets of their own
+	if ok, _, _ := s.Take(ctx, "login:ip:192.0.2.2", rate); !ok {
+		t.Fatal("another client must not share the bucket")
+	}
+}
+
+func TestLimiterAllow(t *testing.T) {
+	ctx := context.Background()
+	l := New(NewMemoryStore(), map[string]Policy{
+		RouteBooking: {
+			PerIP:   Rate{Burst: 3, Period: time.Hour},
+			PerUser: Rate{Burst: 1, Period: time.Hour},
+		},
+	})
+
+	if ok, _, err := l.Allow(ctx, RouteBooking, "192.0.2.1", "alice"); !ok || err != nil {
+		t.Fatalf("first booking refused: %v", err)
+	}
+	// The user's bucket is empty even though the IP's is not
+	ok, wait, err := l.Allow(ctx, RouteBooking, "192.0.2.1", "alice")
+	if ok || err != nil || wait < 59*time.Minute || wait > time.Hour {
+		t.Fatalf("second booking: allowed = %v, retry after %v, %v; want refused, about 1h", ok, wait, err)
+	}
+	if ok, _, _ := l.Allow(ctx, RouteBooking, "192.0.2.1", "bob"); !ok {
+		t.Fatal("another user behind the same IP must be allowed")
+	}
+	// Routes without a policy are not limited
+	for range 5 {
+		if ok, _, _ := l.Allow(ctx, RouteChat, "192.0.2.1", "alice"); !ok {
+			t.Fatal("a route without a policy was limited")
+		}
+	}
+}
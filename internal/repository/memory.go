@@ -0,0 +1,979 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/harentsoaR/dentist-api/internal/database"
+	"github.com/harentsoaR/dentist-api/internal/models"
+	"github.com/harentsoaR/dentist-api/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NewMemoryRepositories returns empty in-memory repositories. They mirror the
+// MongoDB behaviour the handlers rely on (unique emails, token expiry) and
+// are meant for tests and local experiments.
+func NewMemoryRepositories() *Repositories {
+	return &Repositories{
+		Users:         NewMemoryUserRepository(),
+		Clinics:       NewMemoryClinicRepository(),
+		Appointments:  NewMemoryAppointmentRepository(),
+		Tokens:        NewMemoryVerificationTokenRepository(),
+		Idempotency:   NewMemoryIdempotencyRepository(),
+		Audit:         NewMemoryAuditRepository(),
+		Conversations: NewMemoryConversationRepository(),
+		Notifications: NewMemoryNotificationRepository(),
+	}
+}
+
+// --- Users ---
+
+type MemoryUserRepository struct {
+	mu    sync.RWMutex
+	users map[primitive.ObjectID]models.User
+}
+
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{users: map[primitive.ObjectID]models.User{}}
+}
+
+func (r *MemoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.checkUnique(user); err != nil {
+		return err
+	}
+	if _, exists := r.users[user.ID]; exists {
+		return ErrDuplicate
+	}
+	r.users[user.ID] = cloneUser(*user)
+	return nil
+}
+
+func (r *MemoryUserRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+	user = cloneUser(user)
+	return &user, nil
+}
+
+func (r *MemoryUserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, user := range r.users {
+		if strings.EqualFold(user.Email, email) && user.DeletedAt == nil {
+			user = cloneUser(user)
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryUserRepository) EmailTaken(ctx context.Context, email string, except primitive.ObjectID) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.emailTaken(email, except), nil
+}
+
+func (r *MemoryUserRepository) PhoneTaken(ctx context.Context, phone string, except primitive.ObjectID) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.phoneTaken(phone, except), nil
+}
+
+func (r *MemoryUserRepository) Update(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stored, ok := r.users[user.ID]; !ok || stored.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if err := r.checkUnique(user); err != nil {
+		return err
+	}
+	r.users[user.ID] = cloneUser(*user)
+	return nil
+}
+
+// checkUnique mirrors the unique email and (non-empty) phone indexes. It
+// must be called with the lock held.
+func (r *MemoryUserRepository) checkUnique(user *models.User) error {
+	if r.emailTaken(user.Email, user.ID) {
+		return &DuplicateError{Field: "email"}
+	}
+	if user.Phone != "" && r.phoneTaken(user.Phone, user.ID) {
+		return &DuplicateError{Field: "phone"}
+	}
+	return nil
+}
+
+// emailTaken must be called with the lock held.
+func (r *MemoryUserRepository) emailTaken(email string, except primitive.ObjectID) bool {
+	for id, user := range r.users {
+		if id != except && strings.EqualFold(user.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// phoneTaken must be called with the lock held.
+func (r *MemoryUserRepository) phoneTaken(phone string, except primitive.ObjectID) bool {
+	for id, user := range r.users {
+		if id != except && user.Phone == phone {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *MemoryUserRepository) SearchPatients(ctx context.Context, text string, limit int64) ([]UserMatch, error) {
+	visible, err := clinicMatcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	terms := foldWords(text)
+	matches := make([]UserMatch, 0)
+	for _, user := range r.users {
+		if user.Role != "client" || user.DeletedAt != nil || !slices.ContainsFunc(user.ClinicIDs, visible) {
+			continue
+		}
+		fields := map[string]string{"fullName": user.FullName, "email": user.Email, "phone": user.Phone}
+		if score := textScore(database.UserTextWeights, fields, terms); score > 0 {
+			matches = append(matches, UserMatch{User: cloneUser(user), Score: score})
+		}
+	}
+	return rankMatches(matches, func(m UserMatch) float64 { return m.Score }, limit), nil
+}
+
+func (r *MemoryUserRepository) SoftDelete(ctx context.Context, id primitive.ObjectID, by string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt != nil {
+		return ErrNotFound
+	}
+	now := time.Now().UTC()
+	user.DeletedAt, user.DeletedBy = &now, by
+	r.users[id] = user
+	return nil
+}
+
+func (r *MemoryUserRepository) Restore(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt == nil {
+		return nil, ErrNotFound
+	}
+	user.DeletedAt, user.DeletedBy = nil, ""
+	r.users[id] = user
+	user = cloneUser(user)
+	return &user, nil
+}
+
+func (r *MemoryUserRepository) PurgeDeleted(ctx context.Context, cutoff time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for id, user := range r.users {
+		if user.DeletedAt != nil && user.DeletedAt.Before(cutoff) {
+			delete(r.users, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *MemoryUserRepository) Erase(ctx context.Context, id primitive.ObjectID, by string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	now := time.Now().UTC()
+	user.Anonymize(now)
+	if user.DeletedAt == nil {
+		user.DeletedAt, user.DeletedBy = &now, by
+	}
+	r.users[id] = user
+	user = cloneUser(user)
+	return &user, nil
+}
+
+func (r *MemoryUserRepository) AddClinic(ctx context.Context, id, clinicID primitive.ObjectID) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+	if !user.InClinic(clinicID) {
+		user.ClinicIDs = append(slices.Clone(user.ClinicIDs), clinicID)
+		r.users[id] = user
+	}
+	user = cloneUser(user)
+	return &user, nil
+}
+
+// cloneUser copies the pointer fields so callers can't mutate stored data.
+func cloneUser(u models.User) models.User {
+	u.ClinicIDs = slices.Clone(u.ClinicIDs)
+	if u.DateOfBirth != nil {
+		dob := *u.DateOfBirth
+		u.DateOfBirth = &dob
+	}
+	if u.Address != nil {
+		address := *u.Address
+		u.Address = &address
+	}
+	if u.EmergencyContact != nil {
+		contact := *u.EmergencyContact
+		u.EmergencyContact = &contact
+	}
+	return u
+}
+
+// --- Clinics ---
+
+type MemoryClinicRepository struct {
+	mu      sync.RWMutex
+	clinics map[primitive.ObjectID]models.Clinic
+}
+
+func NewMemoryClinicRepository() *MemoryClinicRepository {
+	return &MemoryClinicRepository{clinics: map[primitive.ObjectID]models.Clinic{}}
+}
+
+func (r *MemoryClinicRepository) Create(ctx context.Context, clinic *models.Clinic) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.clinics[clinic.ID]; exists {
+		return ErrDuplicate
+	}
+	r.clinics[clinic.ID] = cloneClinic(*clinic)
+	return nil
+}
+
+func (r *MemoryClinicRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Clinic, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	clinic, ok := r.clinics[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	clinic = cloneClinic(clinic)
+	return &clinic, nil
+}
+
+func (r *MemoryClinicRepository) Update(ctx context.Context, clinic *models.Clinic) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.clinics[clinic.ID]; !ok {
+		return ErrNotFound
+	}
+	r.clinics[clinic.ID] = cloneClinic(*clinic)
+	return nil
+}
+
+// cloneClinic copies the settings' pointer and slice fields.
+func cloneClinic(c models.Clinic) models.Clinic {
+	if c.Settings.Address != nil {
+		address := *c.Settings.Address
+		c.Settings.Address = &address
+	}
+	c.Settings.OpeningHours = slices.Clone(c.Settings.OpeningHours)
+	return c
+}
+
+func (r *MemoryClinicRepository) List(ctx context.Context, ids ...primitive.ObjectID) ([]models.Clinic, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	clinics := make([]models.Clinic, 0)
+	for id, clinic := range r.clinics {
+		if len(ids) == 0 || slices.Contains(ids, id) {
+			clinics = append(clinics, cloneClinic(clinic))
+		}
+	}
+	sort.Slice(clinics, func(i, j int) bool { return clinics[i].Name < clinics[j].Name })
+	return clinics, nil
+}
+
+// --- Appointments ---
+
+type MemoryAppointmentRepository struct {
+	mu           sync.RWMutex
+	appointments map[primitive.ObjectID]models.Appointment
+}
+
+func NewMemoryAppointmentRepository() *MemoryAppointmentRepository {
+	return &MemoryAppointmentRepository{appointments: map[primitive.ObjectID]models.Appointment{}}
+}
+
+func (r *MemoryAppointmentRepository) Create(ctx context.Context, apt *models.Appointment) error {
+	if err := assignClinic(ctx, &apt.ClinicID); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.appointments[apt.ID]; exists {
+		return ErrDuplicate
+	}
+	if apt.Version == 0 {
+		apt.Version = 1
+	}
+	r.appointments[apt.ID] = *apt
+	return nil
+}
+
+func (r *MemoryAppointmentRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Appointment, error) {
+	visible, err := clinicMatcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	apt, ok := r.appointments[id]
+	if !ok || apt.DeletedAt != nil || !visible(apt.ClinicID) {
+		return nil, ErrNotFound
+	}
+	return &apt, nil
+}
+
+func (r *MemoryAppointmentRepository) List(ctx context.Context, q AppointmentQuery) ([]models.Appointment, error) {
+	visible, err := clinicMatcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	appointments := make([]models.Appointment, 0)
+	for _, apt := range r.appointments {
+		if visible(apt.ClinicID) && matchesAppointment(&apt, q) {
+			appointments = append(appointments, apt)
+		}
+	}
+
+	sort.Slice(appointments, func(i, j int) bool {
+		cmp := compareAppointments(&appointments[i], &appointments[j], q.SortBy)
+		if q.Descending {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+	if q.Limit > 0 && int64(len(appointments)) > q.Limit {
+		appointments = appointments[:q.Limit]
+	}
+	return appointments, nil
+}
+
+func (r *MemoryAppointmentRepository) Search(ctx context.Context, text string, limit int64) ([]AppointmentMatch, error) {
+	visible, err := clinicMatcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	terms := foldWords(text)
+	matches := make([]AppointmentMatch, 0)
+	for _, apt := range r.appointments {
+		if apt.DeletedAt != nil || !visible(apt.ClinicID) {
+			continue
+		}
+		fields := map[string]string{"patientName": apt.PatientName, "service": apt.Service, "notes": apt.Notes}
+		if score := textScore(database.AppointmentTextWeights, fields, terms); score > 0 {
+			matches = append(matches, AppointmentMatch{Appointment: apt, Score: score})
+		}
+	}
+	return rankMatches(matches, func(m AppointmentMatch) float64 { return m.Score }, limit), nil
+}
+
+func (r *MemoryAppointmentRepository) SoftDelete(ctx context.Context, id primitive.ObjectID, by string) error {
+	visible, err := clinicMatcher(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	apt, ok := r.appointments[id]
+	if !ok || apt.DeletedAt != nil || !visible(apt.ClinicID) {
+		return ErrNotFound
+	}
+	now := time.Now().UTC()
+	apt.DeletedAt, apt.DeletedBy = &now, by
+	apt.Version++
+	r.appointments[id] = apt
+	return nil
+}
+
+func (r *MemoryAppointmentRepository) Restore(ctx context.Context, id primitive.ObjectID) (*models.Appointment, error) {
+	visible, err := clinicMatcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	apt, ok := r.appointments[id]
+	if !ok || apt.DeletedAt == nil || !visible(apt.ClinicID) {
+		return nil, ErrNotFound
+	}
+	apt.DeletedAt, apt.DeletedBy = nil, ""
+	apt.Version++
+	r.appointments[id] = apt
+	return &apt, nil
+}
+
+func (r *MemoryAppointmentRepository) PurgeDeleted(ctx context.Context, cutoff time.Time) (int64, error) {
+	visible, err := clinicMatcher(ctx)
+	if err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for id, apt := range r.appointments {
+		if apt.DeletedAt != nil && apt.DeletedAt.Before(cutoff) && visible(apt.ClinicID) {
+			delete(r.appointments, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *MemoryAppointmentRepository) ErasePatient(ctx context.Context, patientID primitive.ObjectID, name string) ([]primitive.ObjectID, error) {
+	visible, err := clinicMatcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([]primitive.ObjectID, 0)
+	for id, apt := range r.appointments {
+		if apt.PatientID == patientID && visible(apt.ClinicID) {
+			apt.PatientName = name
+			apt.Version++
+			r.appointments[id] = apt
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (r *MemoryAppointmentRepository) Count(ctx context.Context, q AppointmentQuery) (int64, error) {
+	visible, err := clinicMatcher(ctx)
+	if err != nil {
+		return 0, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var n int64
+	for _, apt := range r.appointments {
+		if visible(apt.ClinicID) && matchesAppointment(&apt, q) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func matchesAppointment(apt *models.Appointment, q AppointmentQuery) bool {
+	switch {
+	case apt.DeletedAt != nil && !q.IncludeDeleted:
+		return false
+	case q.PatientID != nil && apt.PatientID != *q.PatientID:
+		return false
+	case q.Status != "" && apt.Status != q.Status:
+		return false
+	case q.From != nil && apt.StartTime.Before(*q.From):
+		return false
+	case q.To != nil && apt.StartTime.After(*q.To):
+		return false
+	}
+	if q.After != nil {
+		cmp := compareToCursor(apt, q.SortBy, q.After)
+		if q.Descending {
+			return cmp < 0
+		}
+		return cmp > 0
+	}
+	return true
+}
+
+// appointmentSortValue returns the value of a sort field (see
+// AppointmentSortFields); an empty field means startTime.
+func appointmentSortValue(apt *models.Appointment, field string) any {
+	switch field {
+	case "endTime":
+		return apt.EndTime
+	case "patientName":
+		return apt.PatientName
+	case "service":
+		return apt.Service
+	case "status":
+		return apt.Status
+	}
+	return apt.StartTime
+}
+
+func compareValues(a, b any) int {
+	switch av := a.(type) {
+	case time.Time:
+		bv, _ := b.(time.Time)
+		return av.Compare(bv)
+	case string:
+		bv, _ := b.(string)
+		return strings.Compare(av, bv)
+	}
+	return 0
+}
+
+// compareAppointments orders by field, then by ID like the MongoDB listing.
+func compareAppointments(a, b *models.Appointment, field string) int {
+	if cmp := compareValues(appointmentSortValue(a, field), appointmentSortValue(b, field)); cmp != 0 {
+		return cmp
+	}
+	return bytes.Compare(a.ID[:], b.ID[:])
+}
+
+func compareToCursor(apt *models.Appointment, field string, after *Cursor) int {
+	if cmp := compareValues(appointmentSortValue(apt, field), after.Value); cmp != 0 {
+		return cmp
+	}
+	return bytes.Compare(apt.ID[:], after.ID[:])
+}
+
+func (r *MemoryAppointmentRepository) Update(ctx context.Context, apt *models.Appointment) error {
+	visible, err := clinicMatcher(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.appointments[apt.ID]
+	if !ok || stored.DeletedAt != nil || !visible(stored.ClinicID) {
+		return ErrNotFound
+	}
+	if stored.Version != apt.Version {
+		return ErrVersionConflict
+	}
+	apt.Version++
+	r.appointments[apt.ID] = *apt
+	return nil
+}
+
+// --- Verification tokens ---
+
+type MemoryVerificationTokenRepository struct {
+	mu     sync.Mutex
+	tokens map[primitive.ObjectID]models.VerificationToken
+}
+
+func NewMemoryVerificationTokenRepository() *MemoryVerificationTokenRepository {
+	return &MemoryVerificationTokenRepository{tokens: map[primitive.ObjectID]models.VerificationToken{}}
+}
+
+func (r *MemoryVerificationTokenRepository) Replace(ctx context.Context, token *models.VerificationToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deleteForUser(token.UserID, token.Purpose)
+	r.tokens[token.ID] = *token
+	return nil
+}
+
+func (r *MemoryVerificationTokenRepository) FindByHash(ctx context.Context, purpose, hash string) (*models.VerificationToken, error) {
+	return r.find(func(t models.VerificationToken) bool {
+		return t.Purpose == purpose && t.TokenHash == hash
+	})
+}
+
+func (r *MemoryVerificationTokenRepository) FindForUser(ctx context.Context, userID primitive.ObjectID, purpose string) (*models.VerificationToken, error) {
+	return r.find(func(t models.VerificationToken) bool {
+		return t.UserID == userID && t.Purpose == purpose
+	})
+}
+
+func (r *MemoryVerificationTokenRepository) find(match func(models.VerificationToken) bool) (*models.VerificationToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for _, t := range r.tokens {
+		if match(t) && t.ExpiresAt.After(now) {
+			return &t, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryVerificationTokenRepository) IssuedSince(ctx context.Context, userID primitive.ObjectID, purpose string, since time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.tokens {
+		if t.UserID == userID && t.Purpose == purpose && t.CreatedAt.After(since) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *MemoryVerificationTokenRepository) IncrementAttempts(ctx context.Context, id primitive.ObjectID, limit int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.tokens[id]
+	if !ok || t.Attempts >= limit {
+		return ErrNotFound
+	}
+	t.Attempts++
+	r.tokens[id] = t
+	return nil
+}
+
+func (r *MemoryVerificationTokenRepository) DeleteForUser(ctx context.Context, userID primitive.ObjectID, purpose string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deleteForUser(userID, purpose)
+	return nil
+}
+
+func (r *MemoryVerificationTokenRepository) deleteForUser(userID primitive.ObjectID, purpose string) {
+	for id, t := range r.tokens {
+		if t.UserID == userID && t.Purpose == purpose {
+			delete(r.tokens, id)
+		}
+	}
+}
+
+// --- Idempotency keys ---
+
+type MemoryIdempotencyRepository struct {
+	mu      sync.Mutex
+	records map[string]models.IdempotencyRecord
+}
+
+func NewMemoryIdempotencyRepository() *MemoryIdempotencyRepository {
+	return &MemoryIdempotencyRepository{records: map[string]models.IdempotencyRecord{}}
+}
+
+func (r *MemoryIdempotencyRepository) Reserve(ctx context.Context, rec *models.IdempotencyRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.records[rec.ID]; ok && existing.ExpiresAt.After(time.Now()) {
+		return ErrDuplicate
+	}
+	r.records[rec.ID] = *rec
+	return nil
+}
+
+func (r *MemoryIdempotencyRepository) Find(ctx context.Context, id string) (*models.IdempotencyRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, ok := r.records[id]
+	if !ok || !rec.ExpiresAt.After(time.Now()) {
+		return nil, ErrNotFound
+	}
+	return &rec, nil
+}
+
+func (r *MemoryIdempotencyRepository) Complete(ctx context.Context, id string, resp models.IdempotentResponse, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, ok := r.records[id]
+	if !ok {
+		return ErrNotFound
+	}
+	resp.Body = bytes.Clone(resp.Body)
+	rec.IdempotentResponse, rec.ExpiresAt = resp, expiresAt
+	r.records[id] = rec
+	return nil
+}
+
+func (r *MemoryIdempotencyRepository) Release(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.records, id)
+	return nil
+}
+
+// --- Audit log ---
+
+type MemoryAuditRepository struct {
+	mu      sync.RWMutex
+	entries []models.AuditEntry // In insertion order
+}
+
+func NewMemoryAuditRepository() *MemoryAuditRepository {
+	return &MemoryAuditRepository{}
+}
+
+func (r *MemoryAuditRepository) Append(ctx context.Context, entry *models.AuditEntry) error {
+	if clinicID, ok := tenant.ClinicID(ctx); ok {
+		entry.ClinicID = clinicID.Hex()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if entry.ID.IsZero() {
+		entry.ID = primitive.NewObjectID()
+	}
+	r.entries = append(r.entries, *entry)
+	return nil
+}
+
+func (r *MemoryAuditRepository) List(ctx context.Context, q AuditQuery) ([]models.AuditEntry, error) {
+	visible, err := auditMatcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	entries := make([]models.AuditEntry, 0)
+	for i := len(r.entries) - 1; i >= 0; i-- {
+		e := r.entries[i]
+		switch {
+		case e.ExpiresAt != nil && !e.ExpiresAt.After(now):
+		case !visible(e.ClinicID):
+		case q.ActorID != "" && e.ActorID != q.ActorID:
+		case q.Action != "" && e.Action != q.Action:
+		case q.TargetType != "" && e.TargetType != q.TargetType:
+		case q.TargetID != "" && e.TargetID != q.TargetID:
+		case q.From != nil && e.At.Before(*q.From):
+		case q.To != nil && e.At.After(*q.To):
+		case q.Before != nil && bytes.Compare(e.ID[:], q.Before[:]) >= 0:
+		default:
+			entries = append(entries, e)
+		}
+		if q.Limit > 0 && int64(len(entries)) == q.Limit {
+			break
+		}
+	}
+	return entries, nil
+}
+
+func (r *MemoryAuditRepository) Redact(ctx context.Context, targetType string, targetIDs []string, fields ...string) (int64, error) {
+	visible, err := auditMatcher(ctx)
+	if err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for i := range r.entries {
+		e := &r.entries[i]
+		if e.TargetType != targetType || !slices.Contains(targetIDs, e.TargetID) || !visible(e.ClinicID) {
+			continue
+		}
+		// Copy, as earlier List results share the slice
+		changes := slices.Clone(e.Changes)
+		touched := false
+		for j := range changes {
+			if len(fields) == 0 || slices.Contains(fields, changes[j].Field) {
+				changes[j].From, changes[j].To = nil, nil
+				touched = true
+			}
+		}
+		if touched {
+			e.Changes = changes
+			n++
+		}
+	}
+	return n, nil
+}
+
+// --- Conversations ---
+
+type MemoryConversationRepository struct {
+	mu            sync.RWMutex
+	conversations map[primitive.ObjectID]models.Conversation
+}
+
+func NewMemoryConversationRepository() *MemoryConversationRepository {
+	return &MemoryConversationRepository{conversations: map[primitive.ObjectID]models.Conversation{}}
+}
+
+func (r *MemoryConversationRepository) Create(ctx context.Context, conv *models.Conversation) error {
+	if err := assignClinic(ctx, &conv.ClinicID); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.conversations[conv.ID]; exists {
+		return ErrDuplicate
+	}
+	conv.Messages = slices.Clone(conv.Messages)
+	r.conversations[conv.ID] = *conv
+	return nil
+}
+
+// find returns the user's conversation, if ctx can see its clinic. The
+// caller holds the lock.
+func (r *MemoryConversationRepository) find(ctx context.Context, id, userID primitive.ObjectID) (models.Conversation, error) {
+	visible, err := clinicMatcher(ctx)
+	if err != nil {
+		return models.Conversation{}, err
+	}
+	conv, ok := r.conversations[id]
+	if !ok || conv.UserID != userID || !visible(conv.ClinicID) {
+		return models.Conversation{}, ErrNotFound
+	}
+	return conv, nil
+}
+
+func (r *MemoryConversationRepository) FindByID(ctx context.Context, id, userID primitive.ObjectID) (*models.Conversation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	conv, err := r.find(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+func (r *MemoryConversationRepository) List(ctx context.Context, userID primitive.ObjectID, limit int64) ([]models.Conversation, error) {
+	visible, err := clinicMatcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	conversations := make([]models.Conversation, 0)
+	for _, conv := range r.conversations {
+		if conv.UserID == userID && visible(conv.ClinicID) {
+			conversations = append(conversations, conv)
+		}
+	}
+	sort.Slice(conversations, func(i, j int) bool {
+		a, b := conversations[i], conversations[j]
+		if !a.UpdatedAt.Equal(b.UpdatedAt) {
+			return a.UpdatedAt.After(b.UpdatedAt)
+		}
+		return bytes.Compare(a.ID[:], b.ID[:]) > 0
+	})
+	if limit > 0 && int64(len(conversations)) > limit {
+		conversations = conversations[:limit]
+	}
+	return conversations, nil
+}
+
+func (r *MemoryConversationRepository) Append(ctx context.Context, id, userID primitive.ObjectID, messages []models.ChatMessage, keep int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conv, err := r.find(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	// A new slice, as earlier results share the old one
+	conv.Messages = slices.Concat(conv.Messages, messages)
+	if len(conv.Messages) > keep {
+		conv.Messages = conv.Messages[len(conv.Messages)-keep:]
+	}
+	conv.UpdatedAt = time.Now().UTC()
+	r.conversations[id] = conv
+	return nil
+}
+
+func (r *MemoryConversationRepository) Delete(ctx context.Context, id, userID primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.find(ctx, id, userID); err != nil {
+		return err
+	}
+	delete(r.conversations, id)
+	return nil
+}
+
+func (r *MemoryConversationRepository) DeleteForUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	visible, err := clinicMatcher(ctx)
+	if err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for id, conv := range r.conversations {
+		if conv.UserID == userID && visible(conv.ClinicID) {
+			delete(r.conversations, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// --- Notifications ---
+
+type MemoryNotificationRepository struct {
+	mu            sync.RWMutex
+	notifications []models.Notification
+}
+
+func NewMemoryNotificationRepository() *MemoryNotificationRepository {
+	return &MemoryNotificationRepository{}
+}
+
+func (r *MemoryNotificationRepository) Record(ctx context.Context, n *models.Notification) error {
+	if n.ClinicID.IsZero() {
+		if err := assignClinic(ctx, &n.ClinicID); err != nil {
+			return err
+		}
+	}
+	if n.ID.IsZero() {
+		n.ID = primitive.NewObjectID()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notifications = append(r.notifications, *n)
+	return nil
+}
+
+func (r *MemoryNotificationRepository) ListForUser(ctx context.Context, userID primitive.ObjectID) ([]models.Notification, error) {
+	visible, err := clinicMatcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	notifications := make([]models.Notification, 0)
+	for _, n := range r.notifications {
+		if n.UserID == userID && visible(n.ClinicID) {
+			notifications = append(notifications, n)
+		}
+	}
+	sort.Slice(notifications, func(i, j int) bool {
+		a, b := notifications[i], notifications[j]
+		if !a.SentAt.Equal(b.SentAt) {
+			return a.SentAt.After(b.SentAt)
+		}
+		return bytes.Compare(a.ID[:], b.ID[:]) > 0
+	})
+	return notifications, nil
+}
+
+func (r *MemoryNotificationRepository) AnonymizeForUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	visible, err := clinicMatcher(ctx)
+	if err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for i, notification := range r.notifications {
+		if notification.UserID == userID && visible(notification.ClinicID) {
+			r.notifications[i].Recipient = ""
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,828 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/harentsoaR/dentist-api/internal/database"
+	"github.com/harentsoaR/dentist-api/internal/models"
+	"github.com/harentsoaR/dentist-api/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NewMongoRepositories returns repositories backed by db.
+func NewMongoRepositories(db *mongo.Database) *Repositories {
+	return &Repositories{
+		Users:         &mongoUsers{c: db.Collection("users")},
+		Clinics:       &mongoClinics{c: db.Collection("clinics")},
+		Appointments:  &mongoAppointments{c: db.Collection("appointments")},
+		Tokens:        &mongoTokens{c: db.Collection("verificationTokens")},
+		Idempotency:   &mongoIdempotency{c: db.Collection("idempotencyKeys")},
+		Audit:         &mongoAudit{c: db.Collection("auditLog")},
+		Conversations: &mongoConversations{c: db.Collection("conversations")},
+		Notifications: &mongoNotifications{c: db.Collection("notifications")},
+	}
+}
+
+// mapError translates driver errors into repository errors.
+func mapError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return ErrNotFound
+	case mongo.IsDuplicateKeyError(err):
+		// The message names the index, e.g. "... index: phone_unique dup key: ..."
+		for _, field := range []string{"email", "phone"} {
+			if strings.Contains(err.Error(), "index: "+field+"_unique ") {
+				return &DuplicateError{Field: field}
+			}
+		}
+		return ErrDuplicate
+	default:
+		return err
+	}
+}
+
+// notDeleted matches documents that were never soft-deleted, or were restored.
+func notDeleted(filter bson.M) bson.M {
+	filter["deletedAt"] = nil
+	return filter
+}
+
+// inClinic restricts filter to the clinic of ctx, field holding the clinic
+// ID (or IDs) of the documents.
+func inClinic(ctx context.Context, filter bson.M, field string) (bson.M, error) {
+	clinicID, all, err := tenant.Scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !all {
+		filter[field] = clinicID
+	}
+	return filter, nil
+}
+
+// softDelete, restore and purgeDeleted back the methods of the same name on
+// users and appointments. filter selects the document by ID and clinic.
+func softDelete(ctx context.Context, c *mongo.Collection, filter bson.M, by string, extra bson.M) error {
+	update := bson.M{"$set": bson.M{"deletedAt": time.Now().UTC(), "deletedBy": by}}
+	for op, fields := range extra {
+		update[op] = fields
+	}
+	result, err := c.UpdateOne(ctx, notDeleted(filter), update)
+	if err != nil {
+		return mapError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func restore(ctx context.Context, c *mongo.Collection, filter bson.M, extra bson.M, out any) error {
+	update := bson.M{"$unset": bson.M{"deletedAt": "", "deletedBy": ""}}
+	for op, fields := range extra {
+		update[op] = fields
+	}
+	filter["deletedAt"] = bson.M{"$ne": nil}
+	err := c.FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(out)
+	return mapError(err)
+}
+
+func purgeDeleted(ctx context.Context, c *mongo.Collection, filter bson.M, cutoff time.Time) (int64, error) {
+	filter["deletedAt"] = bson.M{"$lt": cutoff}
+	result, err := c.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// --- Users ---
+
+type mongoUsers struct {
+	c *mongo.Collection
+}
+
+func (r *mongoUsers) Create(ctx context.Context, user *models.User) error {
+	_, err := r.c.InsertOne(ctx, user)
+	return mapError(err)
+}
+
+func (r *mongoUsers) FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	var user models.User
+	if err := r.c.FindOne(ctx, notDeleted(bson.M{"_id": id})).Decode(&user); err != nil {
+		return nil, mapError(err)
+	}
+	return &user, nil
+}
+
+func (r *mongoUsers) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	opts := options.FindOne().SetCollation(database.CaseInsensitive)
+	if err := r.c.FindOne(ctx, notDeleted(bson.M{"email": email}), opts).Decode(&user); err != nil {
+		return nil, mapError(err)
+	}
+	return &user, nil
+}
+
+func (r *mongoUsers) EmailTaken(ctx context.Context, email string, except primitive.ObjectID) (bool, error) {
+	opts := options.Count().SetCollation(database.CaseInsensitive).SetLimit(1)
+	n, err := r.c.CountDocuments(ctx, bson.M{"email": email, "_id": bson.M{"$ne": except}}, opts)
+	return n > 0, err
+}
+
+func (r *mongoUsers) PhoneTaken(ctx context.Context, phone string, except primitive.ObjectID) (bool, error) {
+	n, err := r.c.CountDocuments(ctx, bson.M{"phone": phone, "_id": bson.M{"$ne": except}}, options.Count().SetLimit(1))
+	return n > 0, err
+}
+
+func (r *mongoUsers) Update(ctx context.Context, user *models.User) error {
+	result, err := r.c.ReplaceOne(ctx, notDeleted(bson.M{"_id": user.ID}), user)
+	if err != nil {
+		return mapError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoUsers) SearchPatients(ctx context.Context, text string, limit int64) ([]UserMatch, error) {
+	filter, err := inClinic(ctx, notDeleted(bson.M{"role": "client"}), "clinicIds")
+	if err != nil {
+		return nil, err
+	}
+	return textSearch[UserMatch](ctx, r.c, filter, text, limit)
+}
+
+func (r *mongoUsers) SoftDelete(ctx context.Context, id primitive.ObjectID, by string) error {
+	return softDelete(ctx, r.c, bson.M{"_id": id}, by, nil)
+}
+
+func (r *mongoUsers) Restore(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	var user models.User
+	if err := restore(ctx, r.c, bson.M{"_id": id}, nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *mongoUsers) PurgeDeleted(ctx context.Context, cutoff time.Time) (int64, error) {
+	return purgeDeleted(ctx, r.c, bson.M{}, cutoff)
+}
+
+func (r *mongoUsers) Erase(ctx context.Context, id primitive.ObjectID, by string) (*models.User, error) {
+	var user models.User
+	if err := r.c.FindOne(ctx, bson.M{"_id": id}).Decode(&user); err != nil {
+		return nil, mapError(err)
+	}
+	now := time.Now().UTC()
+	user.Anonymize(now)
+	if user.DeletedAt == nil {
+		user.DeletedAt, user.DeletedBy = &now, by
+	}
+	result, err := r.c.ReplaceOne(ctx, bson.M{"_id": id}, &user)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	if result.MatchedCount == 0 {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (r *mongoUsers) AddClinic(ctx context.Context, id, clinicID primitive.ObjectID) (*models.User, error) {
+	var user models.User
+	err := r.c.FindOneAndUpdate(ctx, notDeleted(bson.M{"_id": id}), bson.M{"$addToSet": bson.M{"clinicIds": clinicID}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&user)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &user, nil
+}
+
+// textSearch runs a $text query (see database.UserTextWeights) on top of
+// filter, best score first.
+func textSearch[T any](ctx context.Context, c *mongo.Collection, filter bson.M, text string, limit int64) ([]T, error) {
+	filter["$text"] = bson.M{"$search": text}
+	score := bson.M{"score": bson.M{"$meta": "textScore"}}
+	findOptions := options.Find().SetProjection(score).SetSort(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}})
+	if limit > 0 {
+		findOptions.SetLimit(limit)
+	}
+
+	cursor, err := c.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	results := make([]T, 0)
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// --- Clinics ---
+
+type mongoClinics struct {
+	c *mongo.Collection
+}
+
+func (r *mongoClinics) Create(ctx context.Context, clinic *models.Clinic) error {
+	_, err := r.c.InsertOne(ctx, clinic)
+	return mapError(err)
+}
+
+func (r *mongoClinics) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Clinic, error) {
+	var clinic models.Clinic
+	if err := r.c.FindOne(ctx, bson.M{"_id": id}).Decode(&clinic); err != nil {
+		return nil, mapError(err)
+	}
+	return &clinic, nil
+}
+
+func (r *mongoClinics) Update(ctx context.Context, clinic *models.Clinic) error {
+	result, err := r.c.ReplaceOne(ctx, bson.M{"_id": clinic.ID}, clinic)
+	if err != nil {
+		return mapError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoClinics) List(ctx context.Context, ids ...primitive.ObjectID) ([]models.Clinic, error) {
+	filter := bson.M{}
+	if len(ids) > 0 {
+		filter["_id"] = bson.M{"$in": ids}
+	}
+	cursor, err := r.c.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	clinics := make([]models.Clinic, 0)
+	if err := cursor.All(ctx, &clinics); err != nil {
+		return nil, err
+	}
+	return clinics, nil
+}
+
+// --- Appointments ---
+
+type mongoAppointments struct {
+	c *mongo.Collection
+}
+
+func (r *mongoAppointments) Create(ctx context.Context, apt *models.Appointment) error {
+	if err := assignClinic(ctx, &apt.ClinicID); err != nil {
+		return err
+	}
+	if apt.Version == 0 {
+		apt.Version = 1
+	}
+	_, err := r.c.InsertOne(ctx, apt)
+	return mapError(err)
+}
+
+func (r *mongoAppointments) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Appointment, error) {
+	var apt models.Appointment
+	filter, err := inClinic(ctx, notDeleted(bson.M{"_id": id}), "clinicId")
+	if err != nil {
+		return nil, err
+	}
+	if err := r.c.FindOne(ctx, filter).Decode(&apt); err != nil {
+		return nil, mapError(err)
+	}
+	return &apt, nil
+}
+
+// appointmentFilter translates q into a MongoDB filter within the clinic of ctx.
+func appointmentFilter(ctx context.Context, q AppointmentQuery) (bson.M, error) {
+	filter := bson.M{}
+	if !q.IncludeDeleted {
+		filter = notDeleted(filter)
+	}
+	filter, err := inClinic(ctx, filter, "clinicId")
+	if err != nil {
+		return nil, err
+	}
+	if q.PatientID != nil {
+		filter["patientId"] = *q.PatientID
+	}
+	if q.Status != "" {
+		filter["status"] = q.Status
+	}
+	if q.From != nil || q.To != nil {
+		timeRange := bson.M{}
+		if q.From != nil {
+			timeRange["$gte"] = *q.From
+		}
+		if q.To != nil {
+			timeRange["$lte"] = *q.To
+		}
+		filter["startTime"] = timeRange
+	}
+	if q.After != nil {
+		op := "$gt"
+		if q.Descending {
+			op = "$lt"
+		}
+		field := appointmentSortField(q)
+		filter["$or"] = bson.A{
+			bson.M{field: bson.M{op: q.After.Value}},
+			bson.M{field: q.After.Value, "_id": bson.M{op: q.After.ID}},
+		}
+	}
+	return filter, nil
+}
+
+func appointmentSortField(q AppointmentQuery) string {
+	if q.SortBy == "" {
+		return "startTime"
+	}
+	return q.SortBy
+}
+
+func (r *mongoAppointments) List(ctx context.Context, q AppointmentQuery) ([]models.Appointment, error) {
+	order := 1
+	if q.Descending {
+		order = -1
+	}
+	field := appointmentSortField(q)
+	findOptions := options.Find().SetSort(bson.D{{Key: field, Value: order}, {Key: "_id", Value: order}})
+	if q.Limit > 0 {
+		findOptions.SetLimit(q.Limit)
+	}
+	if len(q.Fields) > 0 {
+		// The sort field is always loaded: the caller needs it for the next cursor
+		projection := bson.M{field: 1}
+		for _, f := range q.Fields {
+			projection[f] = 1
+		}
+		findOptions.SetProjection(projection)
+	}
+
+	filter, err := appointmentFilter(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := r.c.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	appointments := make([]models.Appointment, 0)
+	if err := cursor.All(ctx, &appointments); err != nil {
+		return nil, err
+	}
+	return appointments, nil
+}
+
+func (r *mongoAppointments) Search(ctx context.Context, text string, limit int64) ([]AppointmentMatch, error) {
+	filter, err := inClinic(ctx, notDeleted(bson.M{}), "clinicId")
+	if err != nil {
+		return nil, err
+	}
+	return textSearch[AppointmentMatch](ctx, r.c, filter, text, limit)
+}
+
+func (r *mongoAppointments) SoftDelete(ctx context.Context, id primitive.ObjectID, by string) error {
+	filter, err := inClinic(ctx, bson.M{"_id": id}, "clinicId")
+	if err != nil {
+		return err
+	}
+	return softDelete(ctx, r.c, filter, by, bson.M{"$inc": bson.M{"version": 1}})
+}
+
+func (r *mongoAppointments) Restore(ctx context.Context, id primitive.ObjectID) (*models.Appointment, error) {
+	filter, err := inClinic(ctx, bson.M{"_id": id}, "clinicId")
+	if err != nil {
+		return nil, err
+	}
+	var apt models.Appointment
+	if err := restore(ctx, r.c, filter, bson.M{"$inc": bson.M{"version": 1}}, &apt); err != nil {
+		return nil, err
+	}
+	return &apt, nil
+}
+
+func (r *mongoAppointments) PurgeDeleted(ctx context.Context, cutoff time.Time) (int64, error) {
+	filter, err := inClinic(ctx, bson.M{}, "clinicId")
+	if err != nil {
+		return 0, err
+	}
+	return purgeDeleted(ctx, r.c, filter, cutoff)
+}
+
+func (r *mongoAppointments) ErasePatient(ctx context.Context, patientID primitive.ObjectID, name string) ([]primitive.ObjectID, error) {
+	filter, err := inClinic(ctx, bson.M{"patientId": patientID}, "clinicId")
+	if err != nil {
+		return nil, err
+	}
+	values, err := r.c.Distinct(ctx, "_id", filter)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.c.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"patientName": name}, "$inc": bson.M{"version": 1}}); err != nil {
+		return nil, mapError(err)
+	}
+	ids := make([]primitive.ObjectID, 0, len(values))
+	for _, v := range values {
+		if id, ok := v.(primitive.ObjectID); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (r *mongoAppointments) Count(ctx context.Context, q AppointmentQuery) (int64, error) {
+	filter, err := appointmentFilter(ctx, q)
+	if err != nil {
+		return 0, err
+	}
+	return r.c.CountDocuments(ctx, filter)
+}
+
+func (r *mongoAppointments) Update(ctx context.Context, apt *models.Appointment) error {
+	filter, err := inClinic(ctx, notDeleted(bson.M{"_id": apt.ID}), "clinicId")
+	if err != nil {
+		return err
+	}
+	next := *apt
+	next.Version++
+	filter["version"] = apt.Version
+	result, err := r.c.ReplaceOne(ctx, filter, next)
+	if err != nil {
+		return mapError(err)
+	}
+	if result.MatchedCount == 0 {
+		// Gone, or saved by someone else since apt was read
+		delete(filter, "version")
+		n, err := r.c.CountDocuments(ctx, filter)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+		return ErrVersionConflict
+	}
+	apt.Version = next.Version
+	return nil
+}
+
+// --- Verification tokens ---
+
+type mongoTokens struct {
+	c *mongo.Collection
+}
+
+func (r *mongoTokens) Replace(ctx context.Context, token *models.VerificationToken) error {
+	if err := r.DeleteForUser(ctx, token.UserID, token.Purpose); err != nil {
+		return err
+	}
+	_, err := r.c.InsertOne(ctx, token)
+	return mapError(err)
+}
+
+func (r *mongoTokens) FindByHash(ctx context.Context, purpose, hash string) (*models.VerificationToken, error) {
+	return r.findOne(ctx, bson.M{"tokenHash": hash, "purpose": purpose})
+}
+
+func (r *mongoTokens) FindForUser(ctx context.Context, userID primitive.ObjectID, purpose string) (*models.VerificationToken, error) {
+	return r.findOne(ctx, bson.M{"userId": userID, "purpose": purpose})
+}
+
+// findOne only returns unexpired tokens; the TTL index removes the rest eventually.
+func (r *mongoTokens) findOne(ctx context.Context, filter bson.M) (*models.VerificationToken, error) {
+	filter["expiresAt"] = bson.M{"$gt": time.Now()}
+	var token models.VerificationToken
+	if err := r.c.FindOne(ctx, filter).Decode(&token); err != nil {
+		return nil, mapError(err)
+	}
+	return &token, nil
+}
+
+func (r *mongoTokens) IssuedSince(ctx context.Context, userID primitive.ObjectID, purpose string, since time.Time) (bool, error) {
+	n, err := r.c.CountDocuments(ctx, bson.M{
+		"userId":    userID,
+		"purpose":   purpose,
+		"createdAt": bson.M{"$gt": since},
+	}, options.Count().SetLimit(1))
+	return n > 0, err
+}
+
+func (r *mongoTokens) IncrementAttempts(ctx context.Context, id primitive.ObjectID, limit int) error {
+	result, err := r.c.UpdateOne(ctx,
+		bson.M{"_id": id, "attempts": bson.M{"$lt": limit}},
+		bson.M{"$inc": bson.M{"attempts": 1}},
+	)
+	if err != nil {
+		return mapError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoTokens) DeleteForUser(ctx context.Context, userID primitive.ObjectID, purpose string) error {
+	_, err := r.c.DeleteMany(ctx, bson.M{"userId": userID, "purpose": purpose})
+	return err
+}
+
+// --- Idempotency keys ---
+
+type mongoIdempotency struct {
+	c *mongo.Collection
+}
+
+func (r *mongoIdempotency) Reserve(ctx context.Context, rec *models.IdempotencyRecord) error {
+	// The TTL monitor runs about once a minute: clear an expired record
+	// it hasn't got to yet so it doesn't block the key.
+	if _, err := r.c.DeleteOne(ctx, bson.M{"_id": rec.ID, "expiresAt": bson.M{"$lte": time.Now()}}); err != nil {
+		return err
+	}
+	_, err := r.c.InsertOne(ctx, rec)
+	return mapError(err)
+}
+
+func (r *mongoIdempotency) Find(ctx context.Context, id string) (*models.IdempotencyRecord, error) {
+	var rec models.IdempotencyRecord
+	err := r.c.FindOne(ctx, bson.M{"_id": id, "expiresAt": bson.M{"$gt": time.Now()}}).Decode(&rec)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &rec, nil
+}
+
+func (r *mongoIdempotency) Complete(ctx context.Context, id string, resp models.IdempotentResponse, expiresAt time.Time) error {
+	result, err := r.c.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"status":      resp.Status,
+		"contentType": resp.ContentType,
+		"etag":        resp.ETag,
+		"location":    resp.Location,
+		"body":        resp.Body,
+		"expiresAt":   expiresAt,
+	}})
+	if err != nil {
+		return mapError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoIdempotency) Release(ctx context.Context, id string) error {
+	_, err := r.c.DeleteOne(ctx, bson.M{"_id": id})
+	return mapError(err)
+}
+
+// --- Audit log ---
+
+// auditScope restricts the audit log to the entries written for the clinic
+// of ctx. Audit entries store the clinic as a hex string, like their other IDs.
+func auditScope(ctx context.Context) (bson.M, error) {
+	clinicID, all, err := tenant.Scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if all {
+		return bson.M{}, nil
+	}
+	return bson.M{"clinicId": clinicID.Hex()}, nil
+}
+
+type mongoAudit struct {
+	c *mongo.Collection
+}
+
+func (r *mongoAudit) Append(ctx context.Context, entry *models.AuditEntry) error {
+	if clinicID, ok := tenant.ClinicID(ctx); ok {
+		entry.ClinicID = clinicID.Hex()
+	}
+	_, err := r.c.InsertOne(ctx, entry)
+	return mapError(err)
+}
+
+func (r *mongoAudit) List(ctx context.Context, q AuditQuery) ([]models.AuditEntry, error) {
+	filter, err := auditScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for field, value := range map[string]string{"actorId": q.ActorID, "action": q.Action, "targetType": q.TargetType, "targetId": q.TargetID} {
+		if value != "" {
+			filter[field] = value
+		}
+	}
+	at := bson.M{}
+	if q.From != nil {
+		at["$gte"] = *q.From
+	}
+	if q.To != nil {
+		at["$lte"] = *q.To
+	}
+	if len(at) > 0 {
+		filter["at"] = at
+	}
+	if q.Before != nil {
+		filter["_id"] = bson.M{"$lt": *q.Before}
+	}
+
+	// ObjectIDs grow with insertion time, so _id order is newest first
+	findOptions := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}})
+	if q.Limit > 0 {
+		findOptions.SetLimit(q.Limit)
+	}
+	cursor, err := r.c.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := make([]models.AuditEntry, 0)
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (r *mongoAudit) Redact(ctx context.Context, targetType string, targetIDs []string, fields ...string) (int64, error) {
+	if len(targetIDs) == 0 {
+		return 0, nil
+	}
+	filter, err := auditScope(ctx)
+	if err != nil {
+		return 0, err
+	}
+	// Array updates fail on documents without changes, so skip those
+	filter["targetType"] = targetType
+	filter["targetId"] = bson.M{"$in": targetIDs}
+	filter["changes.0"] = bson.M{"$exists": true}
+	arrayFilter := bson.M{"c.field": bson.M{"$exists": true}}
+	if len(fields) > 0 {
+		filter["changes.field"] = bson.M{"$in": fields}
+		arrayFilter = bson.M{"c.field": bson.M{"$in": fields}}
+	}
+	result, err := r.c.UpdateMany(ctx, filter,
+		bson.M{"$unset": bson.M{"changes.$[c].from": "", "changes.$[c].to": ""}},
+		options.Update().SetArrayFilters(options.ArrayFilters{Filters: []any{arrayFilter}}))
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// --- Conversations ---
+
+type mongoConversations struct {
+	c *mongo.Collection
+}
+
+func (r *mongoConversations) Create(ctx context.Context, conv *models.Conversation) error {
+	if err := assignClinic(ctx, &conv.ClinicID); err != nil {
+		return err
+	}
+	_, err := r.c.InsertOne(ctx, conv)
+	return mapError(err)
+}
+
+func (r *mongoConversations) FindByID(ctx context.Context, id, userID primitive.ObjectID) (*models.Conversation, error) {
+	filter, err := inClinic(ctx, bson.M{"_id": id, "userId": userID}, "clinicId")
+	if err != nil {
+		return nil, err
+	}
+	var conv models.Conversation
+	if err := r.c.FindOne(ctx, filter).Decode(&conv); err != nil {
+		return nil, mapError(err)
+	}
+	return &conv, nil
+}
+
+func (r *mongoConversations) List(ctx context.Context, userID primitive.ObjectID, limit int64) ([]models.Conversation, error) {
+	filter, err := inClinic(ctx, bson.M{"userId": userID}, "clinicId")
+	if err != nil {
+		return nil, err
+	}
+	findOptions := options.Find().SetSort(bson.D{{Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}})
+	if limit > 0 {
+		findOptions.SetLimit(limit)
+	}
+	cursor, err := r.c.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	conversations := make([]models.Conversation, 0)
+	if err := cursor.All(ctx, &conversations); err != nil {
+		return nil, err
+	}
+	return conversations, nil
+}
+
+func (r *mongoConversations) Append(ctx context.Context, id, userID primitive.ObjectID, messages []models.ChatMessage, keep int) error {
+	filter, err := inClinic(ctx, bson.M{"_id": id, "userId": userID}, "clinicId")
+	if err != nil {
+		return err
+	}
+	result, err := r.c.UpdateOne(ctx, filter, bson.M{
+		"$push": bson.M{"messages": bson.M{"$each": messages, "$slice": -keep}},
+		"$set":  bson.M{"updatedAt": time.Now().UTC()},
+	})
+	if err != nil {
+		return mapError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoConversations) Delete(ctx context.Context, id, userID primitive.ObjectID) error {
+	filter, err := inClinic(ctx, bson.M{"_id": id, "userId": userID}, "clinicId")
+	if err != nil {
+		return err
+	}
+	result, err := r.c.DeleteOne(ctx, filter)
+	if err != nil {
+		return mapError(err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoConversations) DeleteForUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	filter, err := inClinic(ctx, bson.M{"userId": userID}, "clinicId")
+	if err != nil {
+		return 0, err
+	}
+	result, err := r.c.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// --- Notifications ---
+
+type mongoNotifications struct {
+	c *mongo.Collection
+}
+
+func (r *mongoNotifications) Record(ctx context.Context, n *models.Notification) error {
+	if n.ClinicID.IsZero() {
+		if err := assignClinic(ctx, &n.ClinicID); err != nil {
+			return err
+		}
+	}
+	_, err := r.c.InsertOne(ctx, n)
+	return mapError(err)
+}
+
+func (r *mongoNotifications) ListForUser(ctx context.Context, userID primitive.ObjectID) ([]models.Notification, error) {
+	filter, err := inClinic(ctx, bson.M{"userId": userID}, "clinicId")
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := r.c.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "sentAt", Value: -1}, {Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	notifications := make([]models.Notification, 0)
+	if err := cursor.All(ctx, &notifications); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+func (r *mongoNotifications) AnonymizeForUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	filter, err := inClinic(ctx, bson.M{"userId": userID}, "clinicId")
+	if err != nil {
+		return 0, err
+	}
+	result, err := r.c.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"recipient": ""}})
+	if err != nil {
+		return 0, err
+	}
+	return result.MatchedCount, nil
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// duplicateKey is the error the driver returns when an insert clashes on index.
+func duplicateKey(index, key string) error {
+	return mongo.WriteException{WriteErrors: []mongo.WriteError{{
+		Code:    11000,
+		Message: fmt.Sprintf("E11000 duplicate key error collection: dentist.users index: %s dup key: { %s }", index, key),
+	}}}
+}
+
+func TestMapError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantField string // For a *DuplicateError
+		want      error
+	}{
+		{name: "email", err: duplicateKey("email_unique", `email: "rasoa@example.com"`), wantField: "email"},
+		{name: "phone", err: duplicateKey("phone_unique", `phone: "+261341234567"`), wantField: "phone"},
+		// "phone_unique_old" is not the phone index, whatever it starts with
+		{name: "other index", err: duplicateKey("phone_unique_old", `phone: "+261341234567"`), want: ErrDuplicate},
+		{name: "unnamed index", err: duplicateKey("_id_", `_id: ObjectId('66a1f0c2e4b0a1b2c3d4e5f6')`), want: ErrDuplicate},
+		{name: "no documents", err: mongo.ErrNoDocuments, want: ErrNotFound},
+		{name: "nil", err: nil, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mapError(tt.err)
+			if tt.wantField != "" {
+				var dup *DuplicateError
+				if !errors.As(got, &dup) || dup.Field != tt.wantField {
+					t.Fatalf("mapError = %v, want a duplicate %s", got, tt.wantField)
+				}
+				if !errors.Is(got, ErrDuplicate) {
+					t.Fatal("a *DuplicateError must still be ErrDuplicate")
+				}
+				return
+			}
+			var dup *DuplicateError
+			if got != tt.want || errors.As(got, &dup) {
+				t.Fatalf("mapError = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Anything else is passed through
+	timeout := errors.New("server selection timeout")
+	if got := mapError(timeout); got != timeout {
+		t.Fatalf("mapError = %v, want the error unchanged", got)
+	}
+}
@@ -0,0 +1,250 @@
+// Package repository hides how users, appointments and verification tokens
+// are stored. Handlers depend on the interfaces below; main wires the MongoDB
+// implementations and tests use the in-memory ones.
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/harentsoaR/dentist-api/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrNotFound is returned when no document matches.
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicate is returned when a write would break a unique constraint.
+	ErrDuplicate = errors.New("duplicate key")
+	// ErrVersionConflict is returned when a document changed since it was read.
+	ErrVersionConflict = errors.New("version conflict")
+)
+
+// DuplicateError is the ErrDuplicate of a write that clashed on a known
+// unique field, e.g. a user's "email" or "phone".
+type DuplicateError struct {
+	Field string
+}
+
+func (e *DuplicateError) Error() string { return "duplicate " + e.Field }
+
+func (e *DuplicateError) Is(target error) bool { return target == ErrDuplicate }
+
+// Clinic scoping: appointments, audit entries and patient search only see
+// the clinic of the context (see package tenant) and fail with
+// tenant.ErrNoClinic when it names none. Accounts are shared across clinics,
+// so the other user methods are not scoped.
+//
+// UserRepository and AppointmentRepository never return soft-deleted
+// records: they look absent (ErrNotFound) until restored. Only Restore,
+// PurgeDeleted and the erasure methods see them.
+type UserRepository interface {
+	Create(ctx context.Context, user *models.User) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error)
+	// FindByEmail matches emails case-insensitively.
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	// EmailTaken and PhoneTaken ignore the user identified by except. They
+	// do count deleted accounts, which can still be restored. Create and
+	// Update enforce both with a *DuplicateError naming the field.
+	EmailTaken(ctx context.Context, email string, except primitive.ObjectID) (bool, error)
+	PhoneTaken(ctx context.Context, phone string, except primitive.ObjectID) (bool, error)
+	// Update replaces the stored user with user.
+	Update(ctx context.Context, user *models.User) error
+	// SearchPatients returns the clients of the context's clinic whose name,
+	// email or phone contains one of the words of text, best match first.
+	SearchPatients(ctx context.Context, text string, limit int64) ([]UserMatch, error)
+	// SoftDelete marks the user deleted by the user with ID by.
+	SoftDelete(ctx context.Context, id primitive.ObjectID, by string) error
+	// Restore undoes SoftDelete; ErrNotFound means there is no such deleted user.
+	Restore(ctx context.Context, id primitive.ObjectID) (*models.User, error)
+	// PurgeDeleted removes for good the users deleted before cutoff.
+	PurgeDeleted(ctx context.Context, cutoff time.Time) (int64, error)
+	// Erase anonymizes the user (see models.User.Anonymize) and marks the
+	// account deleted by the user with ID by, if it wasn't already. It
+	// finds deleted users too.
+	Erase(ctx context.Context, id primitive.ObjectID, by string) (*models.User, error)
+	// AddClinic makes the user a member of the clinic; it is a no-op if
+	// they already are.
+	AddClinic(ctx context.Context, id, clinicID primitive.ObjectID) (*models.User, error)
+}
+
+type ClinicRepository interface {
+	Create(ctx context.Context, clinic *models.Clinic) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Clinic, error)
+	// Update replaces the stored clinic with clinic.
+	Update(ctx context.Context, clinic *models.Clinic) error
+	// List returns the clinics with the given IDs, or all of them if none are
+	// given, by name.
+	List(ctx context.Context, ids ...primitive.ObjectID) ([]models.Clinic, error)
+}
+
+// UserMatch is a search result with its relevance; higher is better.
+type UserMatch struct {
+	models.User `bson:",inline"`
+	Score       float64 `bson:"score" json:"score"`
+}
+
+// AppointmentMatch is a search result with its relevance; higher is better.
+type AppointmentMatch struct {
+	models.Appointment `bson:",inline"`
+	Score              float64 `bson:"score" json:"score"`
+}
+
+// AppointmentQuery filters, orders and pages appointment listings. Zero
+// values mean "no constraint".
+type AppointmentQuery struct {
+	PatientID *primitive.ObjectID
+	Status    string
+	From      *time.Time // startTime >= From
+	To        *time.Time // startTime <= To
+	// IncludeDeleted also returns soft-deleted appointments not yet purged.
+	IncludeDeleted bool
+
+	// SortBy is one of AppointmentSortFields; empty means startTime. Ties are
+	// broken by _id so the order is total and pages never overlap.
+	SortBy     string
+	Descending bool
+	// After resumes a listing just past this position (keyset pagination).
+	After *Cursor
+	// Limit caps the number of results; 0 means no limit.
+	Limit int64
+	// Fields restricts which stored fields are loaded; empty loads all. The
+	// in-memory repository ignores it.
+	Fields []string
+}
+
+// AppointmentSortFields are the fields listings can be ordered by.
+var AppointmentSortFields = []string{"startTime", "endTime", "patientName", "service", "status"}
+
+// Cursor is a position in a sorted listing: the sort field's value and the
+// _id of the last item returned. Value is a time.Time for time fields and a
+// string otherwise.
+type Cursor struct {
+	Value any
+	ID    primitive.ObjectID
+}
+
+type AppointmentRepository interface {
+	// Create stores apt in the context's clinic; a zero Version starts at 1.
+	// Under tenant.AllClinics, apt.ClinicID must already be set.
+	Create(ctx context.Context, apt *models.Appointment) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Appointment, error)
+	List(ctx context.Context, q AppointmentQuery) ([]models.Appointment, error)
+	// Count returns how many appointments List would return, ignoring Limit.
+	Count(ctx context.Context, q AppointmentQuery) (int64, error)
+	// Update replaces the stored appointment with apt and bumps apt.Version,
+	// provided the stored one is still at apt.Version. Otherwise someone
+	// else saved first and it returns ErrVersionConflict.
+	Update(ctx context.Context, apt *models.Appointment) error
+	// Search returns the appointments whose patient name, service or notes
+	// contain one of the words of text, best match first.
+	Search(ctx context.Context, text string, limit int64) ([]AppointmentMatch, error)
+	// SoftDelete marks the appointment deleted by the user with ID by and
+	// bumps its Version.
+	SoftDelete(ctx context.Context, id primitive.ObjectID, by string) error
+	// Restore undoes SoftDelete and bumps the Version; ErrNotFound means
+	// there is no such deleted appointment.
+	Restore(ctx context.Context, id primitive.ObjectID) (*models.Appointment, error)
+	// PurgeDeleted removes for good the appointments deleted before cutoff.
+	PurgeDeleted(ctx context.Context, cutoff time.Time) (int64, error)
+	// ErasePatient replaces the patient name on all of the patient's
+	// appointments, deleted ones included, bumps their Version and returns
+	// their IDs.
+	ErasePatient(ctx context.Context, patientID primitive.ObjectID, name string) ([]primitive.ObjectID, error)
+}
+
+type VerificationTokenRepository interface {
+	// Replace removes any pending token with the same user and purpose, then stores token.
+	Replace(ctx context.Context, token *models.VerificationToken) error
+	// FindByHash returns the unexpired token with this purpose and hash.
+	FindByHash(ctx context.Context, purpose, hash string) (*models.VerificationToken, error)
+	// FindForUser returns the user's unexpired token for purpose.
+	FindForUser(ctx context.Context, userID primitive.ObjectID, purpose string) (*models.VerificationToken, error)
+	// IssuedSince reports whether a token for purpose was created after since.
+	IssuedSince(ctx context.Context, userID primitive.ObjectID, purpose string, since time.Time) (bool, error)
+	// IncrementAttempts counts one more try at the token, in a single update
+	// that matches only while it has had fewer than limit. ErrNotFound means
+	// the tries are used up (or the token is gone).
+	IncrementAttempts(ctx context.Context, id primitive.ObjectID, limit int) error
+	DeleteForUser(ctx context.Context, userID primitive.ObjectID, purpose string) error
+}
+
+// ConversationRepository keeps the chats with the assistant. Every method
+// acts on the conversations of userID in the clinic of ctx; someone else's
+// conversation is reported as ErrNotFound.
+type ConversationRepository interface {
+	// Create stores conv in the clinic of ctx.
+	Create(ctx context.Context, conv *models.Conversation) error
+	FindByID(ctx context.Context, id, userID primitive.ObjectID) (*models.Conversation, error)
+	// List returns the user's conversations, most recently active first.
+	// limit 0 means no limit.
+	List(ctx context.Context, userID primitive.ObjectID, limit int64) ([]models.Conversation, error)
+	// Append adds messages to the conversation and bumps UpdatedAt, then
+	// drops the oldest messages beyond keep.
+	Append(ctx context.Context, id, userID primitive.ObjectID, messages []models.ChatMessage, keep int) error
+	Delete(ctx context.Context, id, userID primitive.ObjectID) error
+	// DeleteForUser removes all of the user's conversations and returns how many there were.
+	DeleteForUser(ctx context.Context, userID primitive.ObjectID) (int64, error)
+}
+
+// NotificationRepository keeps a record of the SMS and emails sent, for the
+// personal data export. Reads are scoped to the clinic of ctx.
+type NotificationRepository interface {
+	// Record stores n in n.ClinicID, or in the clinic of ctx when that is zero.
+	Record(ctx context.Context, n *models.Notification) error
+	// ListForUser returns what was sent to the user, newest first.
+	ListForUser(ctx context.Context, userID primitive.ObjectID) ([]models.Notification, error)
+	// AnonymizeForUser clears the recipient of the user's notifications and
+	// returns how many there were.
+	AnonymizeForUser(ctx context.Context, userID primitive.ObjectID) (int64, error)
+}
+
+// AuditQuery filters the audit log. Zero values mean "no constraint".
+type AuditQuery struct {
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	From       *time.Time // at >= From
+	To         *time.Time // at <= To
+	// Before resumes a listing below this entry (entries come newest first).
+	Before *primitive.ObjectID
+	Limit  int64 // 0 means no limit
+}
+
+// AuditRepository is append-only: entries cannot be removed through it,
+// only expire, and the only change allowed is Redact.
+type AuditRepository interface {
+	Append(ctx context.Context, entry *models.AuditEntry) error
+	// List returns matching entries, newest first.
+	List(ctx context.Context, q AuditQuery) ([]models.AuditEntry, error)
+	// Redact drops the from and to values of the given fields (all fields
+	// if none are given) in the entries about these targets, keeping which
+	// fields changed. It returns how many entries it touched.
+	Redact(ctx context.Context, targetType string, targetIDs []string, fields ...string) (int64, error)
+}
+
+type IdempotencyRepository interface {
+	// Reserve stores a pending record, or returns ErrDuplicate when an
+	// unexpired record with the same ID exists.
+	Reserve(ctx context.Context, rec *models.IdempotencyRecord) error
+	// Find returns the unexpired record with this ID.
+	Find(ctx context.Context, id string) (*models.IdempotencyRecord, error)
+	// Complete saves the response of a reserved request and keeps it until expiresAt.
+	Complete(ctx context.Context, id string, resp models.IdempotentResponse, expiresAt time.Time) error
+	// Release forgets a reservation so the request can be retried.
+	Release(ctx context.Context, id string) error
+}
+
+// Repositories bundles every repository the handlers need.
+type Repositories struct {
+	Users         UserRepository
+	Clinics       ClinicRepository
+	Appointments  AppointmentRepository
+	Tokens        VerificationTokenRepository
+	Idempotency   IdempotencyRepository
+	Audit         AuditRepository
+	Conversations ConversationRepository
+	Notifications NotificationRepository
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/harentsoaR/dentist-api/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// assignClinic files a new document (an appointment, a conversation) under
+// the clinic of ctx by setting its clinic ID field.
+func assignClinic(ctx context.Context, field *primitive.ObjectID) error {
+	clinicID, all, err := tenant.Scope(ctx)
+	switch {
+	case err != nil:
+		return err
+	case !all:
+		*field = clinicID
+	case field.IsZero():
+		return tenant.ErrNoClinic
+	}
+	return nil
+}
+
+// clinicMatcher reports which clinic IDs ctx may see, for the in-memory
+// repositories.
+func clinicMatcher(ctx context.Context) (func(primitive.ObjectID) bool, error) {
+	clinicID, all, err := tenant.Scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return func(id primitive.ObjectID) bool { return all || id == clinicID }, nil
+}
+
+// auditMatcher is clinicMatcher for the hex clinic IDs of audit entries.
+func auditMatcher(ctx context.Context) (func(string) bool, error) {
+	clinicID, all, err := tenant.Scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return func(id string) bool { return all || id == clinicID.Hex() }, nil
+}
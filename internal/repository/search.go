@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// This file mimics MongoDB's $text search for the in-memory repositories:
+// case and accents are ignored ("Hery Rakotoarivélo" matches "rakotoarivelo"),
+// words must match whole, and each field counts with its index weight.
+
+// foldWords lowercases s, strips accents and splits it into words.
+func foldWords(s string) []string {
+	folded, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), s)
+	if err != nil {
+		folded = s
+	}
+	return strings.FieldsFunc(strings.ToLower(folded), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// textScore scores fields (keyed like the weights) against the search
+// words; 0 means no match.
+func textScore(weights bson.D, fields map[string]string, terms []string) float64 {
+	var score float64
+	for _, w := range weights {
+		words := foldWords(fields[w.Key])
+		for _, term := range terms {
+			for _, word := range words {
+				if word == term {
+					score += float64(w.Value.(int))
+				}
+			}
+		}
+	}
+	return score
+}
+
+// rankMatches sorts by descending score and applies the limit.
+func rankMatches[T any](matches []T, score func(T) float64, limit int64) []T {
+	sort.SliceStable(matches, func(i, j int) bool { return score(matches[i]) > score(matches[j]) })
+	if limit > 0 && int64(len(matches)) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/harentsoaR/dentist-api/internal/config"
+	"github.com/harentsoaR/dentist-api/internal/models"
+	"github.com/harentsoaR/dentist-api/internal/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Roles of the turns in a ChatRequest, as stored in conversations.
+const (
+	ChatRoleUser      = models.ChatRoleUser
+	ChatRoleAssistant = models.ChatRoleAssistant
+)
+
+// ErrEmptyReply means the model answered without any text, or only whitespace.
+var ErrEmptyReply = errors.New("AI returned an empty response")
+
+// ChatMessage is one turn of the conversation.
+type ChatMessage struct {
+	Role string // ChatRoleUser or ChatRoleAssistant
+	Text string
+}
+
+// ChatRequest is what the assistant sends to the model: its instructions
+// and the conversation so far, ending with the user's question.
+type ChatRequest struct {
+	System   string
+	Messages []ChatMessage
+}
+
+// ChatReply is the model's answer and what it cost.
+type ChatReply struct {
+	Text         string
+	InputTokens  int
+	OutputTokens int
+}
+
+// ChatModel is the AI provider behind the assistant. Implementations talk
+// to Gemini or an OpenAI-compatible server; FakeChatModel answers offline.
+type ChatModel interface {
+	// Generate answers the request. ctx bounds the call.
+	Generate(ctx context.Context, req ChatRequest) (*ChatReply, error)
+	// Ping checks the provider accepts our credentials without spending tokens.
+	Ping(ctx context.Context) error
+	// Provider and Model name the backend, for metrics and traces.
+	Provider() string
+	Model() string
+}
+
+// NewChatModel builds the provider selected by cfg.Provider.
+func NewChatModel(cfg config.Chat) (ChatModel, error) {
+	switch cfg.Provider {
+	case "gemini":
+		return NewGeminiChatModel(cfg), nil
+	case "openai":
+		return NewOpenAIChatModel(cfg), nil
+	case "fake":
+		return NewFakeChatModel(), nil
+	default:
+		return nil, fmt.Errorf("unknown chat provider %q", cfg.Provider)
+	}
+}
+
+// newChatHTTPClient traces every call to the AI provider. timeout bounds a
+// call in addition to the request's own deadline.
+func newChatHTTPClient(cfg config.Chat) *http.Client {
+	return &http.Client{Timeout: cfg.Timeout, Transport: otelhttp.NewTransport(http.DefaultTransport)}
+}
+
+// startChatSpan opens the client span of a model call, named after the
+// provider's operation (e.g. "gemini.generateContent").
+func startChatSpan(ctx context.Context, m ChatModel, operation string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, m.Provider()+"."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("gen_ai.system", m.Provider()), attribute.String("gen_ai.request.model", m.Model())))
+}
+
+// endChatSpan records the outcome of a model call on its span.
+func endChatSpan(span trace.Span, reply *ChatReply, err error) {
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(
+			attribute.Int("gen_ai.usage.input_tokens", reply.InputTokens),
+			attribute.Int("gen_ai.usage.output_tokens", reply.OutputTokens),
+		)
+	}
+	span.End()
+}
+
+// doChatRequest sends a request to the provider and decodes its JSON answer
+// into out (which may be nil). Credentials go in headers: URLs end up in
+// traces and logs. Error bodies can echo the patient's prompt, so only their
+// codes are logged (see errorSummary).
+func doChatRequest(ctx context.Context, client *http.Client, method, url string, header http.Header, body, out any) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("encoding AI request: %w", err)
+		}
+		payload = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, payload)
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("AI service unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading AI response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		slog.WarnContext(ctx, "AI service returned an error", "status", resp.StatusCode, "error", errorSummary(respBody), "body_bytes", len(respBody))
+		return fmt.Errorf("AI service returned %s", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("parsing AI response: %w", err)
+	}
+	return nil
+}
+
+// errorSummary keeps the machine-readable parts of a provider error body,
+// e.g. "INVALID_ARGUMENT" from Gemini or "invalid_request_error" from OpenAI.
+// The human-readable message is dropped: it may quote the prompt.
+func errorSummary(body []byte) string {
+	var parsed struct {
+		Error struct {
+			Status string `json:"status"` // Gemini
+			Type   string `json:"type"`   // OpenAI
+			Code   any    `json:"code"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &parsed) != nil {
+		return "unparsable"
+	}
+	var parts []string
+	for _, part := range []any{parsed.Error.Status, parsed.Error.Type, parsed.Error.Code} {
+		if s := fmt.Sprint(part); part != nil && s != "" {
+			parts = append(parts, s)
+		}
+	}
+	if len(parts) == 0 {
+		return "unknown"
+	}
+	return strings.Join(parts, " ")
+}
+
+// --- Fake ---
+
+// FakeChatModel answers without a network: it echoes the last user message.
+// It keeps the requests it received so tests can inspect the prompt.
+type FakeChatModel struct {
+	// Err, when set, is returned by Generate and Ping instead of answering.
+	Err error
+
+	mu       sync.Mutex
+	requests []ChatRequest
+}
+
+func NewFakeChatModel() *FakeChatModel {
+	return &FakeChatModel{}
+}
+
+func (f *FakeChatModel) Generate(_ context.Context, req ChatRequest) (*ChatReply, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, req)
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	var question string
+	for _, msg := range req.Messages {
+		if msg.Role == ChatRoleUser {
+			question = msg.Text
+		}
+	}
+	return &ChatReply{
+		Text:         "echo: " + question,
+		InputTokens:  len(strings.Fields(req.System)) + len(strings.Fields(question)),
+		OutputTokens: len(strings.Fields(question)) + 1,
+	}, nil
+}
+
+// Requests returns the requests received so far, oldest first.
+func (f *FakeChatModel) Requests() []ChatRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]ChatRequest(nil), f.requests...)
+}
+
+func (f *FakeChatModel) Ping(context.Context) error { return f.Err }
+func (f *FakeChatModel) Provider() string           { return "fake" }
+func (f *FakeChatModel) Model() string              { return "echo" }
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/harentsoaR/dentist-api/internal/metrics"
+	"github.com/harentsoaR/dentist-api/internal/models"
+	"github.com/harentsoaR/dentist-api/internal/tracing"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type smtpConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// SendEmailVerification emails the user a link containing their verification token.
+func (s *NotificationService) SendEmailVerification(ctx context.Context, user *models.User, token string) {
+	if user.Email == "" {
+		slog.InfoContext(ctx, "verification email not sent: user has no email address", "user_id", user.ID.Hex())
+		return
+	}
+
+	body := fmt.Sprintf(
+		"Hello %s,\r\n\r\nPlease confirm your email address by opening the link below:\r\n\r\n%s\r\n\r\nThe link expires in 24 hours. If you did not create an account, you can ignore this message.\r\n",
+		user.FullName,
+		s.verificationLink(token),
+	)
+
+	sent := notification(ctx, user, models.NotificationEmail, user.Email, models.TemplateEmailVerification)
+
+	s.dispatch(ctx, func(ctx context.Context) { s.sendEmailWithSMTP(ctx, "Confirm your email address", body, sent) })
+}
+
+// verificationLink appends the token to the configured frontend URL, falling
+// back to the raw token when no URL is configured.
+func (s *NotificationService) verificationLink(token string) string {
+	if s.verifyURL == "" {
+		return token
+	}
+	u, err := url.Parse(s.verifyURL)
+	if err != nil {
+		return token
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// --- Private Helper Function for SMTP ---
+// sendEmailWithSMTP emails sent.Recipient and records sent once the server
+// accepts the message.
+func (s *NotificationService) sendEmailWithSMTP(ctx context.Context, subject, body string, sent models.Notification) {
+	to := sent.Recipient
+	if s.smtp.Host == "" || s.smtp.From == "" {
+		slog.WarnContext(ctx, "email not sent: SMTP_HOST/SMTP_FROM not configured", "email", to)
+		metrics.NotificationsSent.WithLabelValues("email", "skipped").Inc()
+		return
+	}
+	port := s.smtp.Port
+	if port == "" {
+		port = "587"
+	}
+
+	msg := strings.Join([]string{
+		"From: " + s.smtp.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	ctx, span := tracing.Tracer().Start(ctx, "smtp.send", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	err := s.deliverSMTP(s.smtp.Host+":"+port, to, []byte(msg))
+	metrics.NotificationsSent.WithLabelValues("email", metrics.Outcome(err)).Inc()
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		slog.ErrorContext(ctx, "failed to send email", "email", to, "error", err)
+		return
+	}
+	slog.InfoContext(ctx, "email sent", "email", to)
+	s.logSent(ctx, sent)
+}
+
+// deliverSMTP is smtp.SendMail with a deadline on the whole conversation.
+func (s *NotificationService) deliverSMTP(addr, to string, msg []byte) error {
+	conn, err := net.DialTimeout("tcp", addr, s.timeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(s.timeout))
+
+	client, err := smtp.NewClient(conn, s.smtp.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.smtp.Host}); err != nil {
+			return err
+		}
+	}
+	if s.smtp.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.smtp.Username, s.smtp.Password, s.smtp.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(s.smtp.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/harentsoaR/dentist-api/internal/config"
+)
+
+// Gemini defaults, used when the configuration leaves them empty.
+const (
+	DefaultGeminiBaseURL = "https://generativelanguage.googleapis.com"
+	DefaultGeminiModel   = "gemini-1.5-flash"
+)
+
+// GeminiChatModel calls Google's Gemini generateContent API.
+type GeminiChatModel struct {
+	baseURL     string
+	apiKey      string
+	model       string
+	temperature float64
+	client      *http.Client
+}
+
+// NewGeminiChatModel builds the Gemini provider from its configuration
+// section; the key is GeminiAPIKey.
+func NewGeminiChatModel(cfg config.Chat) *GeminiChatModel {
+	m := &GeminiChatModel{
+		baseURL:     strings.TrimSuffix(cfg.BaseURL, "/"),
+		apiKey:      cfg.GeminiAPIKey,
+		model:       cfg.Model,
+		temperature: cfg.Temperature,
+		client:      newChatHTTPClient(cfg),
+	}
+	if m.baseURL == "" {
+		m.baseURL = DefaultGeminiBaseURL
+	}
+	if m.model == "" {
+		m.model = DefaultGeminiModel
+	}
+	return m
+}
+
+// --- Gemini request and response bodies ---
+
+type geminiPart struct {
+	Text string `json:"text"`
+}
+
+// geminiContent is one turn; Role is "user" or "model".
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiRequest struct {
+	SystemInstruction *geminiContent  `json:"systemInstruction,omitempty"`
+	Contents          []geminiContent `json:"contents"`
+	GenerationConfig  struct {
+		Temperature float64 `json:"temperature"`
+	} `json:"generationConfig"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content geminiContent `json:"content"`
+	} `json:"candidates"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+	} `json:"usageMetadata"`
+}
+
+func (m *GeminiChatModel) Generate(ctx context.Context, req ChatRequest) (reply *ChatReply, err error) {
+	ctx, span := startChatSpan(ctx, m, "generateContent")
+	defer func() { endChatSpan(span, reply, err) }()
+
+	if m.apiKey == "" {
+		return nil, errors.New("GEMINI_API_KEY is not set")
+	}
+
+	body := geminiRequest{}
+	if req.System != "" {
+		body.SystemInstruction = &geminiContent{Parts: []geminiPart{{Text: req.System}}}
+	}
+	for _, msg := range req.Messages {
+		role := "user"
+		if msg.Role == ChatRoleAssistant {
+			role = "model"
+		}
+		body.Contents = append(body.Contents, geminiContent{Role: role, Parts: []geminiPart{{Text: msg.Text}}})
+	}
+	body.GenerationConfig.Temperature = m.temperature
+
+	var resp geminiResponse
+	if err := doChatRequest(ctx, m.client, http.MethodPost, m.modelURL()+":generateContent", m.header(), body, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 ||
+		strings.TrimSpace(resp.Candidates[0].Content.Parts[0].Text) == "" {
+		return nil, ErrEmptyReply
+	}
+	return &ChatReply{
+		Text:         resp.Candidates[0].Content.Parts[0].Text,
+		InputTokens:  resp.UsageMetadata.PromptTokenCount,
+		OutputTokens: resp.UsageMetadata.CandidatesTokenCount,
+	}, nil
+}
+
+// Ping fetches the model's metadata, which costs no tokens.
+func (m *GeminiChatModel) Ping(ctx context.Context) error {
+	if m.apiKey == "" {
+		return errors.New("GEMINI_API_KEY is not set")
+	}
+	return doChatRequest(ctx, m.client, http.MethodGet, m.modelURL(), m.header(), nil, nil)
+}
+
+func (m *GeminiChatModel) Provider() string { return "gemini" }
+func (m *GeminiChatModel) Model() string    { return m.model }
+
+func (m *GeminiChatModel) modelURL() string {
+	return m.baseURL + "/v1beta/models/" + url.PathEscape(m.model)
+}
+
+// header carries the key; in the query string it would be logged.
+func (m *GeminiChatModel) header() http.Header {
+	return http.Header{"X-Goog-Api-Key": {m.apiKey}}
+}
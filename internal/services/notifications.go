@@ -2,57 +2,244 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
+	"sync"
+	"time"
 
+	"github.com/harentsoaR/dentist-api/internal/config"
+	"github.com/harentsoaR/dentist-api/internal/metrics"
 	"github.com/harentsoaR/dentist-api/internal/models"
+	"github.com/harentsoaR/dentist-api/internal/tenant"
+	"github.com/harentsoaR/dentist-api/internal/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// The service is now simpler, only handling SMS.
-type NotificationService struct{}
+// DefaultSendTimeout bounds a single SMS or email delivery attempt.
+const DefaultSendTimeout = 15 * time.Second
 
-// NewNotificationService is now much simpler.
-func NewNotificationService() *NotificationService {
-	return &NotificationService{}
+// Notifier is how handlers reach patients. NotificationService is the real
+// implementation; tests substitute a recorder. ctx is the request's context:
+// delivery outlives the request but keeps its trace and request ID.
+type Notifier interface {
+	// SendAppointmentConfirmationSMS tells the patient the appointment's
+	// status. clinic may be nil if it could not be loaded.
+	SendAppointmentConfirmationSMS(ctx context.Context, patient *models.User, apt *models.Appointment, clinic *models.Clinic)
+	SendEmailVerification(ctx context.Context, user *models.User, token string)
+	SendPhoneVerificationCode(ctx context.Context, user *models.User, code string)
+}
+
+// NotificationLog keeps a record of what was sent, for the personal data
+// export. repository.NotificationRepository implements it.
+type NotificationLog interface {
+	Record(ctx context.Context, n *models.Notification) error
+}
+
+// NotificationService sends SMS through Textbelt and email through SMTP.
+// Messages are delivered in the background; Shutdown waits for them.
+type NotificationService struct {
+	// Log records each message the provider accepted; nil keeps no record
+	Log NotificationLog
+
+	smtp        smtpConfig
+	textbeltKey string // Textbelt free key allows 1 SMS per day. Get a paid key for more.
+	verifyURL   string // Frontend page that receives ?token=... from verification emails
+	timeout     time.Duration
+	client      *http.Client
+
+	pending sync.WaitGroup
+}
+
+// NewNotificationService builds the service from its configuration section.
+// A zero SendTimeout means DefaultSendTimeout.
+func NewNotificationService(cfg config.Notifications) *NotificationService {
+	sendTimeout := cfg.SendTimeout
+	if sendTimeout <= 0 {
+		sendTimeout = DefaultSendTimeout
+	}
+	return &NotificationService{
+		smtp: smtpConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.SMTPFrom,
+		},
+		textbeltKey: cfg.TextbeltKey,
+		verifyURL:   cfg.EmailVerificationURL,
+		timeout:     sendTimeout,
+		client:      &http.Client{Timeout: sendTimeout, Transport: otelhttp.NewTransport(http.DefaultTransport)},
+	}
+}
+
+// dispatch runs send in a goroutine so it doesn't block the API response,
+// and keeps track of it so Shutdown can wait for delivery. The request's
+// cancellation is dropped so the send survives the response being written.
+func (s *NotificationService) dispatch(ctx context.Context, send func(ctx context.Context)) {
+	ctx = context.WithoutCancel(ctx)
+	s.pending.Add(1)
+	go func() {
+		defer s.pending.Done()
+		send(ctx)
+	}()
+}
+
+// Shutdown waits for notifications still being sent, or for ctx to end.
+func (s *NotificationService) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("notifications still pending: %w", ctx.Err())
+	}
+}
+
+// logSent records a message the provider accepted. A failure to record is
+// logged; the message has gone either way.
+func (s *NotificationService) logSent(ctx context.Context, n models.Notification) {
+	if s.Log == nil {
+		return
+	}
+	n.SentAt = time.Now().UTC()
+	if err := s.Log.Record(ctx, &n); err != nil {
+		slog.ErrorContext(ctx, "failed to record sent notification", "channel", n.Channel, "template", n.Template, "user_id", n.UserID.Hex(), "error", err)
+	}
+}
+
+// notification starts the record of a message to user about no appointment,
+// filed under the clinic of ctx or else the user's first clinic.
+func notification(ctx context.Context, user *models.User, channel, recipient, template string) models.Notification {
+	n := models.Notification{UserID: user.ID, Channel: channel, Recipient: recipient, Template: template}
+	if clinicID, ok := tenant.ClinicID(ctx); ok {
+		n.ClinicID = clinicID
+	} else if len(user.ClinicIDs) > 0 {
+		n.ClinicID = user.ClinicIDs[0]
+	}
+	return n
+}
+
+// CheckConfig reports which delivery channels are missing their settings,
+// for the readiness probe. Nothing is sent.
+func (s *NotificationService) CheckConfig() error {
+	var missing []error
+	if s.textbeltKey == "" {
+		missing = append(missing, errors.New("SMS disabled: TEXTBELT_API_KEY is not set"))
+	}
+	if s.smtp.Host == "" || s.smtp.From == "" {
+		missing = append(missing, errors.New("email disabled: SMTP_HOST/SMTP_FROM are not set"))
+	}
+	return errors.Join(missing...)
 }
 
 // This function will now call the Textbelt API
-func (s *NotificationService) SendAppointmentConfirmationSMS(patient *models.User, apt *models.Appointment) {
+func (s *NotificationService) SendAppointmentConfirmationSMS(ctx context.Context, patient *models.User, apt *models.Appointment, clinic *models.Clinic) {
 	if patient.Phone == "" {
-		log.Println("SMS not sent: Patient has no phone number.")
+		slog.InfoContext(ctx, "SMS not sent: patient has no phone number", "user_id", patient.ID.Hex())
+		metrics.NotificationsSent.WithLabelValues("sms", "skipped").Inc()
+		return
+	}
+	if !patient.PhoneVerified {
+		slog.InfoContext(ctx, "SMS not sent: patient phone number is not verified", "user_id", patient.ID.Hex())
+		metrics.NotificationsSent.WithLabelValues("sms", "skipped").Inc()
 		return
 	}
 
-	// The message for the SMS
-	smsBody := fmt.Sprintf(
-		"Appointment Confirmed: %s with %s on %s.",
-		apt.Service,
-		patient.FullName,
-		apt.StartTime.Format("Jan 2 at 3:04 PM"),
-	)
+	smsBody := AppointmentSMS(patient, apt, clinic)
+	template := models.TemplateAppointmentConfirmed
+	if apt.Status == models.StatusCancelled {
+		template = models.TemplateAppointmentCancelled
+	}
+	aptID := apt.ID
+	sent := models.Notification{
+		UserID:        patient.ID,
+		ClinicID:      apt.ClinicID,
+		Channel:       models.NotificationSMS,
+		Recipient:     patient.Phone,
+		Template:      template,
+		AppointmentID: &aptID,
+	}
 
-	// Send in a goroutine so it doesn't block the API response
-	go sendSmsWithTextbelt(patient.Phone, smsBody)
+	s.dispatch(ctx, func(ctx context.Context) { s.sendSmsWithTextbelt(ctx, smsBody, sent) })
+}
+
+// AppointmentSMS is the text sent when an appointment is booked or
+// cancelled. The time is given in the clinic's time zone.
+func AppointmentSMS(patient *models.User, apt *models.Appointment, clinic *models.Clinic) string {
+	status := "Confirmed"
+	if apt.Status == models.StatusCancelled {
+		status = "Cancelled"
+	}
+	var settings models.ClinicSettings
+	where := ""
+	if clinic != nil {
+		settings = clinic.Settings
+		where = " at " + clinic.Name
+	}
+
+	msg := fmt.Sprintf("Appointment %s%s: %s with %s on %s.",
+		status, where, apt.Service, patient.FullName,
+		apt.StartTime.In(settings.Location()).Format("Jan 2 at 3:04 PM"))
+	if status == "Confirmed" && settings.CancellationPolicy.MinNoticeHours > 0 {
+		msg += fmt.Sprintf(" Please cancel at least %dh ahead.", settings.CancellationPolicy.MinNoticeHours)
+	}
+	if settings.Contact.Phone != "" {
+		msg += " Questions: " + settings.Contact.Phone
+	}
+	return msg
+}
+
+// SendPhoneVerificationCode texts a one-time code to the user's (not yet verified) number.
+func (s *NotificationService) SendPhoneVerificationCode(ctx context.Context, user *models.User, code string) {
+	if user.Phone == "" {
+		slog.InfoContext(ctx, "verification code not sent: user has no phone number", "user_id", user.ID.Hex())
+		return
+	}
+
+	smsBody := fmt.Sprintf("Your DentistFlow verification code is %s. It expires in 10 minutes.", code)
+
+	sent := notification(ctx, user, models.NotificationSMS, user.Phone, models.TemplatePhoneVerification)
+
+	s.dispatch(ctx, func(ctx context.Context) { s.sendSmsWithTextbelt(ctx, smsBody, sent) })
 }
 
 // --- Private Helper Function for Textbelt ---
-func sendSmsWithTextbelt(phone, message string) {
-	// Textbelt free key allows 1 SMS per day. Get a paid key for more.
-	// We'll get this from our .env file.
-	textbeltKey := os.Getenv("TEXTBELT_API_KEY")
+// sendSmsWithTextbelt texts message to sent.Recipient and records sent once
+// Textbelt accepts it.
+func (s *NotificationService) sendSmsWithTextbelt(ctx context.Context, message string, sent models.Notification) {
+	phone := sent.Recipient
+	ctx, span := tracing.Tracer().Start(ctx, "textbelt.send", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
 
 	postBody, _ := json.Marshal(map[string]string{
 		"phone":   phone,
 		"message": message,
-		"key":     textbeltKey,
+		"key":     s.textbeltKey,
 	})
 
-	resp, err := http.Post("https://textbelt.com/text", "application/json", bytes.NewBuffer(postBody))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://textbelt.com/text", bytes.NewBuffer(postBody))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
 	if err != nil {
-		log.Printf("Failed to send Textbelt request for number %s: %v", phone, err)
+		slog.ErrorContext(ctx, "failed to send Textbelt request", "phone", phone, "error", err)
+		metrics.NotificationsSent.WithLabelValues("sms", "failure").Inc()
+		span.SetStatus(codes.Error, err.Error())
 		return
 	}
 	defer resp.Body.Close()
@@ -63,8 +250,12 @@ func sendSmsWithTextbelt(phone, message string) {
 	success, _ := result["success"].(bool)
 	if !success {
 		errorMsg, _ := result["error"].(string)
-		log.Printf("Failed to send SMS via Textbelt to %s. Reason: %s", phone, errorMsg)
+		slog.ErrorContext(ctx, "Textbelt rejected the SMS", "phone", phone, "reason", errorMsg)
+		metrics.NotificationsSent.WithLabelValues("sms", "failure").Inc()
+		span.SetStatus(codes.Error, errorMsg)
 	} else {
-		log.Printf("Successfully sent SMS via Textbelt to %s", phone)
+		slog.InfoContext(ctx, "SMS sent via Textbelt", "phone", phone)
+		metrics.NotificationsSent.WithLabelValues("sms", "success").Inc()
+		s.logSent(ctx, sent)
 	}
 }
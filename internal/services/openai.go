@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/harentsoaR/dentist-api/internal/config"
+)
+
+// DefaultOpenAIBaseURL is used when the configuration leaves BaseURL empty.
+// Local servers expose the same API, e.g. Ollama at http://localhost:11434/v1.
+const DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+// OpenAIChatModel calls an OpenAI-compatible chat completions API.
+type OpenAIChatModel struct {
+	baseURL     string
+	apiKey      string
+	model       string
+	temperature float64
+	client      *http.Client
+}
+
+// NewOpenAIChatModel builds the OpenAI-compatible provider from its
+// configuration section; the key is APIKey and may be empty for local servers.
+func NewOpenAIChatModel(cfg config.Chat) *OpenAIChatModel {
+	m := &OpenAIChatModel{
+		baseURL:     strings.TrimSuffix(cfg.BaseURL, "/"),
+		apiKey:      cfg.APIKey,
+		model:       cfg.Model,
+		temperature: cfg.Temperature,
+		client:      newChatHTTPClient(cfg),
+	}
+	if m.baseURL == "" {
+		m.baseURL = DefaultOpenAIBaseURL
+	}
+	return m
+}
+
+// --- Chat completions request and response bodies ---
+
+type openAIMessage struct {
+	Role    string `json:"role"` // system, user or assistant
+	Content string `json:"content"`
+}
+
+type openAIRequest struct {
+	Model       string          `json:"model"`
+	Messages    []openAIMessage `json:"messages"`
+	Temperature float64         `json:"temperature"`
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message openAIMessage `json:"message"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+func (m *OpenAIChatModel) Generate(ctx context.Context, req ChatRequest) (reply *ChatReply, err error) {
+	ctx, span := startChatSpan(ctx, m, "chat.completions")
+	defer func() { endChatSpan(span, reply, err) }()
+
+	body := openAIRequest{Model: m.model, Temperature: m.temperature}
+	if req.System != "" {
+		body.Messages = append(body.Messages, openAIMessage{Role: "system", Content: req.System})
+	}
+	for _, msg := range req.Messages {
+		body.Messages = append(body.Messages, openAIMessage{Role: msg.Role, Content: msg.Text})
+	}
+
+	var resp openAIResponse
+	if err := doChatRequest(ctx, m.client, http.MethodPost, m.baseURL+"/chat/completions", m.header(), body, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Choices) == 0 || strings.TrimSpace(resp.Choices[0].Message.Content) == "" {
+		return nil, ErrEmptyReply
+	}
+	return &ChatReply{
+		Text:         resp.Choices[0].Message.Content,
+		InputTokens:  resp.Usage.PromptTokens,
+		OutputTokens: resp.Usage.CompletionTokens,
+	}, nil
+}
+
+// Ping lists the models, which costs no tokens.
+func (m *OpenAIChatModel) Ping(ctx context.Context) error {
+	return doChatRequest(ctx, m.client, http.MethodGet, m.baseURL+"/models", m.header(), nil, nil)
+}
+
+func (m *OpenAIChatModel) Provider() string { return "openai" }
+func (m *OpenAIChatModel) Model() string    { return m.model }
+
+func (m *OpenAIChatModel) header() http.Header {
+	if m.apiKey == "" {
+		return nil
+	}
+	return http.Header{"Authorization": {"Bearer " + m.apiKey}}
+}
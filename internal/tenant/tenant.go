@@ -0,0 +1,54 @@
+// Package tenant carries the clinic a request acts for. The auth middleware
+// puts the clinic of the access token in the request context, and the
+// repositories restrict every clinic-owned query to it.
+package tenant
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrNoClinic is returned for clinic-owned data when the context names no
+// clinic and was not opened up with AllClinics.
+var ErrNoClinic = errors.New("no clinic selected")
+
+type ctxKey struct{}
+
+// scope is stored in the context; all means no restriction.
+type scope struct {
+	clinicID primitive.ObjectID
+	all      bool
+}
+
+// WithClinic restricts ctx to clinicID.
+func WithClinic(ctx context.Context, clinicID primitive.ObjectID) context.Context {
+	return context.WithValue(ctx, ctxKey{}, scope{clinicID: clinicID})
+}
+
+// AllClinics lifts the restriction, for work that spans clinics on purpose:
+// background jobs and a patient's own data export or erasure.
+func AllClinics(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxKey{}, scope{all: true})
+}
+
+// ClinicID returns the clinic ctx is restricted to, if any.
+func ClinicID(ctx context.Context) (primitive.ObjectID, bool) {
+	s, ok := ctx.Value(ctxKey{}).(scope)
+	if !ok || s.all {
+		return primitive.NilObjectID, false
+	}
+	return s.clinicID, true
+}
+
+// Scope returns the clinic ctx is restricted to, or all = true after
+// AllClinics. A context with neither fails with ErrNoClinic, so forgetting
+// the clinic never leaks another clinic's data.
+func Scope(ctx context.Context) (clinicID primitive.ObjectID, all bool, err error) {
+	s, ok := ctx.Value(ctxKey{}).(scope)
+	if !ok {
+		return primitive.NilObjectID, false, ErrNoClinic
+	}
+	return s.clinicID, s.all, nil
+}
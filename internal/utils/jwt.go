@@ -1,45 +1,288 @@
 package utils
 
 import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+// DefaultTokenTTL is how long a freshly issued token stays valid.
+const DefaultTokenTTL = 24 * time.Hour
 
 type Claims struct {
 	UserID string `json:"userId"`
 	Role   string `json:"role"`
+	// ClinicID is the clinic the token acts for; empty for an admin who
+	// has not picked one.
+	ClinicID string `json:"clinicId,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateJWT creates a new JWT token for a given user.
-func GenerateJWT(userID, role string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+// verificationKey is a public key that is still accepted for incoming tokens.
+type verificationKey struct {
+	method jwt.SigningMethod
+	public crypto.PublicKey
+}
+
+// KeySet holds the key used to sign new tokens and every key still accepted
+// for verification, indexed by key ID ("kid"). Rotating keys means adding the
+// new private key, switching the active kid, and keeping the old public key
+// around until the tokens it signed have expired.
+type KeySet struct {
+	Issuer   string
+	Audience string
+	TTL      time.Duration
+
+	activeKID string
+	private   map[string]crypto.Signer
+	verify    map[string]verificationKey
+}
+
+// NewKeySet returns an empty key set. Keys are added with AddKey.
+func NewKeySet(issuer, audience string, ttl time.Duration) *KeySet {
+	if ttl <= 0 {
+		ttl = DefaultTokenTTL
+	}
+	return &KeySet{
+		Issuer:   issuer,
+		Audience: audience,
+		TTL:      ttl,
+		private:  map[string]crypto.Signer{},
+		verify:   map[string]verificationKey{},
+	}
+}
+
+// LoadKeySet builds a key set from the PEM files in dir and signs with activeKID.
+func LoadKeySet(dir, activeKID, issuer, audience string, ttl time.Duration) (*KeySet, error) {
+	ks := NewKeySet(issuer, audience, ttl)
+	if err := ks.LoadDir(dir); err != nil {
+		return nil, err
+	}
+	if err := ks.SetActive(activeKID); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// LoadDir adds every "<kid>.pem" file in dir. Private keys (PKCS#8, or PKCS#1
+// for RSA) can sign and verify; public keys (PKIX) are verification only.
+func (ks *KeySet) LoadDir(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no .pem keys found in %s", dir)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		key, err := parsePEMKey(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		if err := ks.AddKey(kid, key); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// AddKey registers a key under kid. key may be an *rsa.PrivateKey,
+// ed25519.PrivateKey, *rsa.PublicKey or ed25519.PublicKey.
+func (ks *KeySet) AddKey(kid string, key any) error {
+	if kid == "" {
+		return errors.New("key ID cannot be empty")
+	}
+	if _, exists := ks.verify[kid]; exists {
+		return fmt.Errorf("duplicate key ID %q", kid)
+	}
+
+	var public crypto.PublicKey
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		ks.private[kid] = k
+		public = &k.PublicKey
+	case ed25519.PrivateKey:
+		ks.private[kid] = k
+		public = k.Public()
+	default:
+		public = key
+	}
+
+	method, err := signingMethodFor(public)
+	if err != nil {
+		delete(ks.private, kid)
+		return err
+	}
+	ks.verify[kid] = verificationKey{method: method, public: public}
+	return nil
+}
+
+// SetActive selects the private key used to sign new tokens.
+func (ks *KeySet) SetActive(kid string) error {
+	if kid == "" {
+		return errors.New("no active key ID given")
+	}
+	if _, ok := ks.private[kid]; !ok {
+		return fmt.Errorf("no private key with ID %q", kid)
+	}
+	ks.activeKID = kid
+	return nil
+}
+
+// GenerateJWT creates a new JWT token for a given user acting for clinicID.
+func (ks *KeySet) GenerateJWT(userID, role, clinicID string) (string, error) {
+	signer, ok := ks.private[ks.activeKID]
+	if !ok {
+		return "", errors.New("no active signing key")
+	}
+
+	now := time.Now()
 	claims := &Claims{
-		UserID: userID,
-		Role:   role,
+		UserID:   userID,
+		Role:     role,
+		ClinicID: clinicID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			Issuer:    ks.Issuer,
+			Subject:   userID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ks.TTL)),
+			Audience:  jwt.ClaimStrings{ks.Audience},
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	token := jwt.NewWithClaims(ks.verify[ks.activeKID].method, claims)
+	token.Header["kid"] = ks.activeKID
+	return token.SignedString(signer)
 }
 
-// ValidateJWT validates a given token string.
-func ValidateJWT(tokenStr string) (*Claims, error) {
+// ValidateJWT validates a given token string. The algorithm is pinned to the
+// one registered for the token's kid, and the issuer and audience must match
+// the key set's. A key set without them rejects every token.
+func (ks *KeySet) ValidateJWT(tokenStr string) (*Claims, error) {
+	if ks.Issuer == "" || ks.Audience == "" {
+		return nil, errors.New("key set has no issuer or audience configured")
+	}
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithIssuer(ks.Issuer),
+		jwt.WithAudience(ks.Audience),
+	}
+
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ks.verify[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key ID %q", kid)
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), kid)
+		}
+		return key.public, nil
+	}, opts...)
 
-	if err != nil || !token.Valid {
+	if err != nil {
 		return nil, err
 	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
 
 	return claims, nil
 }
+
+// JWK is a single public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns every verification key so other services can check our tokens.
+func (ks *KeySet) JWKS() JWKS {
+	kids := make([]string, 0, len(ks.verify))
+	for kid := range ks.verify {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	set := JWKS{Keys: make([]JWK, 0, len(kids))}
+	for _, kid := range kids {
+		key := ks.verify[kid]
+		jwk := JWK{Kid: kid, Use: "sig", Alg: key.method.Alg()}
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// signingMethodFor maps a public key to the only algorithm we accept for it.
+func signingMethodFor(public crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", public)
+	}
+}
+
+func parsePEMKey(data []byte) (any, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// DefaultCountryCode is used for numbers written in national format (Madagascar).
+const DefaultCountryCode = "261"
+
+var ErrInvalidPhone = errors.New("invalid phone number")
+
+// nationalNumberLength pins the national significant number length for the
+// countries we know; others only get the generic E.164 bounds.
+var nationalNumberLength = map[string]int{
+	"261": 9,  // Madagascar: 03X XX XXX XX
+	"33":  9,  // France
+	"262": 9,  // Réunion / Mayotte
+	"230": 8,  // Mauritius
+	"1":   10, // North America
+}
+
+// NormalizePhone converts a user-entered phone number to E.164 (+2613XXXXXXXX).
+// Numbers without an international prefix are assumed to belong to
+// defaultCountryCode, with a leading trunk "0" removed.
+func NormalizePhone(raw, defaultCountryCode string) (string, error) {
+	if defaultCountryCode == "" {
+		defaultCountryCode = DefaultCountryCode
+	}
+
+	s := strings.TrimSpace(raw)
+	international := false
+	switch {
+	case strings.HasPrefix(s, "+"):
+		s, international = s[1:], true
+	case strings.HasPrefix(s, "00"):
+		s, international = s[2:], true
+	}
+
+	var digits strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+			// Common separators
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+	number := digits.String()
+
+	if !international {
+		switch {
+		case strings.HasPrefix(number, "0"):
+			number = defaultCountryCode + number[1:]
+		case strings.HasPrefix(number, defaultCountryCode) &&
+			len(number) == len(defaultCountryCode)+nationalNumberLength[defaultCountryCode]:
+			// Already includes the country code, just without the "+"
+		default:
+			number = defaultCountryCode + number
+		}
+	}
+
+	if len(number) < 8 || len(number) > 15 || number[0] == '0' {
+		return "", ErrInvalidPhone
+	}
+	if cc := knownCountryCode(number); cc != "" && len(number)-len(cc) != nationalNumberLength[cc] {
+		return "", ErrInvalidPhone
+	}
+
+	return "+" + number, nil
+}
+
+// knownCountryCode returns the longest known country code prefixing number.
+func knownCountryCode(number string) string {
+	best := ""
+	for cc := range nationalNumberLength {
+		if strings.HasPrefix(number, cc) && len(cc) > len(best) {
+			best = cc
+		}
+	}
+	return best
+}
+
+// GenerateOTP returns a random numeric one-time code of the given length.
+func GenerateOTP(length int) (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(length)), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", length, n), nil
+}
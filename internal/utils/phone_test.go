@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		raw, country, want string
+		wantErr            bool
+	}{
+		{raw: "0341234567", want: "+261341234567"},
+		{raw: "032 12 345 67", want: "+261321234567"},
+		{raw: "034-12-345-67", want: "+261341234567"},
+		{raw: "(034) 12.345.67", want: "+261341234567"},
+		{raw: "  0381234567  ", want: "+261381234567"},
+		{raw: "+261 34 12 345 67", want: "+261341234567"},
+		{raw: "00261341234567", want: "+261341234567"},
+		{raw: "261341234567", want: "+261341234567"},
+		{raw: "341234567", want: "+261341234567"},
+		{raw: "06 12 34 56 78", country: "33", want: "+33612345678"},
+		{raw: "+33 6 12 34 56 78", want: "+33612345678"},
+		{raw: "", wantErr: true},
+		{raw: "034123456", wantErr: true},   // One digit short
+		{raw: "03412345678", wantErr: true}, // One digit too many
+		{raw: "+261 34 12 345 6", wantErr: true},
+		{raw: "034 12 345 6x", wantErr: true}, // Letters
+		{raw: "+0341234567", wantErr: true},
+		{raw: "+1234567890123456", wantErr: true}, // Longer than E.164 allows
+	}
+	for _, tt := range tests {
+		got, err := NormalizePhone(tt.raw, tt.country)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidPhone) {
+				t.Errorf("NormalizePhone(%q) = %q, %v; want ErrInvalidPhone", tt.raw, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizePhone(%q, %q) = %q, %v; want %q", tt.raw, tt.country, got, err, tt.want)
+		}
+	}
+}
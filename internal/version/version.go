@@ -0,0 +1,60 @@
+// Package version reports what build is running. Release builds stamp the
+// values at link time:
+//
+//	go build -ldflags "-X github.com/harentsoaR/dentist-api/internal/version.Version=v1.4.0 \
+//	  -X github.com/harentsoaR/dentist-api/internal/version.Commit=$(git rev-parse HEAD) \
+//	  -X github.com/harentsoaR/dentist-api/internal/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/api
+//
+// Without them, the VCS information embedded by the Go toolchain is used.
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set with -ldflags "-X ...".
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"buildTime,omitempty"`
+	Modified  bool   `json:"modified,omitempty"` // Built from a dirty working tree
+	GoVersion string `json:"goVersion"`
+}
+
+// Get returns the build information, preferring link-time values.
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+		if info.Version == "dev" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+	}
+	return info
+}